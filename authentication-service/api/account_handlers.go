@@ -0,0 +1,187 @@
+package api
+
+import (
+	"authentification/data"
+	"common/apiclient"
+	"common/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DeleteMe deletes the account of the signed in user, who confirms with their password.
+// Their car requests are anonymized and their cars deleted in the car service first, which
+// refuses while the user is in the middle of a ride, so that nothing is left pointing at the
+// deleted account. Nothing undoes the erasure when the account can not be deleted after it:
+// the account is kept until the last step instead, and the user retries, which is safe as
+// erasing the ride data again does nothing. Users who only signed in with an external
+// provider can set a password with the forgotten password flow.
+func (app *Config) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	var requestPayload struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	valid, err := user.PasswordMatches(requestPayload.Password)
+	if err != nil || !valid {
+		app.errorJSON(w, errors.New("Invalid Credentials"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Cars.DeleteMyData(r.Context(), auth.BearerToken(r))
+	if err != nil {
+		app.carServiceErrorJSON(w, err)
+		return
+	}
+
+	err = app.deleteAccount(user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the access token of the request is still valid for a few minutes otherwise
+	if principal.TokenID != "" {
+		err = app.Models.RevokedToken.Revoke(principal.TokenID, user.ID, principal.ExpiresAt)
+		if err != nil {
+			log.Println("Error revoking access token:", err)
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Account %s deleted", user.Email),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// accountExport is everything stored about a user, across services.
+type accountExport struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	User          *data.User           `json:"user"`
+	Identities    []*data.Identity     `json:"identities"`
+	TwoFactor     *data.MFA            `json:"two_factor,omitempty"`
+	Sessions      []*data.RefreshToken `json:"sessions"`
+	LoginAttempts []*data.LoginAttempt `json:"login_attempts"`
+	CarService    json.RawMessage      `json:"car_service"`
+}
+
+// ExportMe returns every piece of data stored about the signed in user, in this service and
+// in the car service, as a JSON file to download.
+func (app *Config) ExportMe(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	user, err := app.Models.User.GetOne(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	export := accountExport{
+		ExportedAt:    time.Now().UTC(),
+		User:          user,
+		Identities:    []*data.Identity{},
+		Sessions:      []*data.RefreshToken{},
+		LoginAttempts: []*data.LoginAttempt{},
+	}
+
+	identities, err := app.Models.Identity.GetAllForUser(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	export.Identities = append(export.Identities, identities...)
+
+	mfa, err := app.Models.MFA.GetByUser(user.ID)
+	if err == nil && mfa.ConfirmedAt != nil {
+		export.TwoFactor = mfa
+	}
+
+	sessions, err := app.Models.RefreshToken.GetAllForUser(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	export.Sessions = append(export.Sessions, sessions...)
+
+	attempts, err := app.Models.LoginAttempt.GetByEmail(user.Email)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	export.LoginAttempts = append(export.LoginAttempts, attempts...)
+
+	carData, err := app.Cars.ExportUserData(r.Context(), auth.BearerToken(r))
+	if err != nil {
+		app.carServiceErrorJSON(w, err)
+		return
+	}
+	export.CarService = carData
+
+	headers := http.Header{}
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d-%s.json"`, user.ID, export.ExportedAt.Format("20060102")))
+
+	app.writeJSON(w, http.StatusOK, export, headers)
+}
+
+// deleteAccount removes the user and everything tied to their account in this service.
+// Lockouts are kept, as the audit trail of attacks on the account. The user is deleted
+// last, so that an account left half deleted by a failure can still sign in and be deleted
+// again.
+func (app *Config) deleteAccount(user *data.User) error {
+	err := app.Models.RefreshToken.DeleteForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.OneTimeToken.DeleteForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.MFA.Disable(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.Identity.DeleteForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.LoginAttempt.DeleteByEmail(user.Email)
+	if err != nil {
+		return err
+	}
+
+	return app.Models.User.DeleteByID(user.ID)
+}
+
+// carServiceErrorJSON passes conflicts reported by the car service on to the user, and
+// answers any other failure with 502 Bad Gateway.
+func (app *Config) carServiceErrorJSON(w http.ResponseWriter, err error) {
+	if errors.Is(err, apiclient.ErrConflict) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	log.Println("Error calling car service:", err)
+	app.errorJSON(w, errors.New("the ride data of the account could not be reached, try again later"), http.StatusBadGateway)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"authentification/data"
+	"common/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestExportMe(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	resp := app.do(t, "GET", "/users/me/export", s.Token, nil)
+	if resp.Status != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.Status)
+	}
+	if resp.Header.Get("Content-Disposition") == "" {
+		t.Fatal("the export is not a download")
+	}
+
+	app.cars.mu.Lock()
+	defer app.cars.mu.Unlock()
+	if len(app.cars.calls) != 1 || app.cars.calls[0] != "GET /users/me/data" {
+		t.Fatalf("got car service calls %v, want the export of the ride data", app.cars.calls)
+	}
+}
+
+func TestDeleteMe(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	app.do(t, "DELETE", "/users/me", s.Token, map[string]any{"password": "wrong-Password-1"}).expect(t, http.StatusBadRequest)
+
+	app.cars.mu.Lock()
+	app.cars.Conflict = true
+	app.cars.mu.Unlock()
+	app.do(t, "DELETE", "/users/me", s.Token, map[string]any{"password": testPassword}).expect(t, http.StatusConflict)
+
+	app.cars.mu.Lock()
+	app.cars.Conflict = false
+	app.cars.mu.Unlock()
+	app.do(t, "DELETE", "/users/me", s.Token, map[string]any{"password": testPassword}).expect(t, http.StatusAccepted)
+
+	app.do(t, "POST", "/check_token", s.Token, nil).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": testPassword}).
+		expect(t, http.StatusBadRequest)
+}
+
+// failingUserDeletion fails the deletion of users once.
+type failingUserDeletion struct {
+	data.UserRepository
+	failed bool
+}
+
+func (r *failingUserDeletion) DeleteByID(id int) error {
+	if !r.failed {
+		r.failed = true
+		return errors.New("connection reset")
+	}
+	return r.UserRepository.DeleteByID(id)
+}
+
+func TestDeleteMeCanBeRetried(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+	app.Models.User = &failingUserDeletion{UserRepository: app.Models.User}
+
+	// the ride data is erased, but the account is still there to try again
+	app.do(t, "DELETE", "/users/me", s.Token, map[string]any{"password": testPassword}).expect(t, http.StatusInternalServerError)
+	retry := app.signIn(t, "rita@example.com")
+	app.do(t, "DELETE", "/users/me", retry.Token, map[string]any{"password": testPassword}).expect(t, http.StatusAccepted)
+
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": testPassword}).
+		expect(t, http.StatusBadRequest)
+
+	app.cars.mu.Lock()
+	defer app.cars.mu.Unlock()
+	if len(app.cars.calls) != 2 || app.cars.calls[0] != "DELETE /users/me/data" || app.cars.calls[1] != app.cars.calls[0] {
+		t.Fatalf("got car service calls %v, want the ride data erased on both attempts", app.cars.calls)
+	}
+}
+
+func TestAdminDeletesUser(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	rider := app.signIn(t, "rita@example.com")
+	admin := app.staff(t, "admin@example.com", auth.RoleAdmin)
+	support := app.staff(t, "support@example.com", auth.RoleSupport)
+
+	var list struct {
+		Users []json.RawMessage `json:"users"`
+	}
+	app.do(t, "GET", "/admin/users", rider.Token, nil).expect(t, http.StatusForbidden)
+	app.do(t, "GET", "/admin/users", support.Token, nil).expect(t, http.StatusForbidden)
+	app.do(t, "GET", "/admin/users", admin.Token, nil).expect(t, http.StatusAccepted).decode(t, &list)
+	if len(list.Users) != 3 {
+		t.Fatalf("got %d users, want 3", len(list.Users))
+	}
+
+	app.do(t, "DELETE", fmt.Sprintf("/admin/users/%d", admin.User.ID), admin.Token, nil).expect(t, http.StatusBadRequest)
+	app.do(t, "DELETE", fmt.Sprintf("/admin/users/%d", rider.User.ID), admin.Token, nil).expect(t, http.StatusAccepted)
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": rider.RefreshToken}).expect(t, http.StatusUnauthorized)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"authentification/data"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ListUsers returns every user account, for admins only.
+func (app *Config) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.Models.User.GetAll()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	type UsersResponse struct {
+		Users []*data.User `json:"users"`
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Users retrieved successfully"),
+		Data:    UsersResponse{Users: users},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// DeleteUser deletes a user account, erases its ride data and signs it out of every
+// session. Access tokens already issued to the user stop working when they expire. Like
+// DeleteMe, it is retried when it fails after the ride data was erased.
+func (app *Config) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	userID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if userID == principal.UserID {
+		app.errorJSON(w, errors.New("you can not delete your own account"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	err = app.Cars.DeleteUserData(r.Context(), auth.BearerToken(r), user.ID)
+	if err != nil {
+		app.carServiceErrorJSON(w, err)
+		return
+	}
+
+	err = app.deleteAccount(user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("User %s deleted", user.Email),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// UnlockUser lifts the sign in lockout of a user account and resets its failed attempts.
+func (app *Config) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	userID, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	user, err := app.Models.User.GetOne(userID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	locked, err := app.Models.Lockout.UnlockAccount(user.Email, principal.UserID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d unlocked sign in for account %s\n", principal.UserID, user.Email)
+
+	message := fmt.Sprintf("User %s unlocked", user.Email)
+	if !locked {
+		message = fmt.Sprintf("User %s was not locked, failed attempts have been reset", user.Email)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: message,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ListLockouts returns the latest sign in lockouts, newest first.
+func (app *Config) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	lockouts, err := app.Models.Lockout.GetAll(limit)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	type LockoutsResponse struct {
+		Lockouts []*data.Lockout `json:"lockouts"`
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Lockouts retrieved successfully"),
+		Data:    LockoutsResponse{Lockouts: lockouts},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
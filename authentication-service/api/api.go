@@ -0,0 +1,37 @@
+// Package api holds the HTTP handlers of the authentication service. The service binary
+// in cmd/api wires them to Postgres, and tests to the in-memory store.
+package api
+
+import (
+	"authentification/data"
+	"authentification/mailer"
+	"authentification/oidc"
+	"authentification/passwords"
+	"common/carclient"
+	"database/sql"
+	"net/netip"
+)
+
+type Config struct {
+	DB     *sql.DB
+	Models data.Models
+	Mailer mailer.Mailer
+
+	// FrontendURL is where links sent by email point to, and PublicURL where this service
+	// is reachable from outside, for links handled by the service itself.
+	FrontendURL string
+	PublicURL   string
+
+	// PasswordPolicy is what the passwords users choose must satisfy.
+	PasswordPolicy *passwords.Policy
+
+	// Cars calls the car service, to export and erase the ride data of users.
+	Cars *carclient.Client
+
+	// OIDCProviders are the external identity providers users can sign in with, by name.
+	OIDCProviders map[string]*oidc.Provider
+
+	// TrustedProxies are the networks whose X-Forwarded-For header is believed, such as
+	// the broker's, when throttling sign in attempts by client.
+	TrustedProxies []netip.Prefix
+}
@@ -0,0 +1,575 @@
+package api
+
+import (
+	"authentification/data"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (app *Config) Authenticate(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ip := app.clientIP(r)
+
+	block, err := app.checkLoginAllowed(requestPayload.Email, ip)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		app.writeLoginBlock(w, block)
+		return
+	}
+
+	//validate the user agains the database
+	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	valid := false
+	if err == nil {
+		valid, err = user.PasswordMatches(requestPayload.Password)
+	}
+	if err != nil || !valid {
+		// unknown emails count too, so that guessing them is throttled the same way
+		err = app.recordLoginFailure(requestPayload.Email, ip)
+		if err != nil {
+			log.Println("Error recording failed sign in:", err)
+		}
+		app.errorJSON(w, errors.New("Invalid Credentials"), http.StatusBadRequest)
+		return
+	}
+
+	if !user.Active {
+		app.errorJSON(w, errors.New("verify your email address before signing in"), http.StatusForbidden)
+		return
+	}
+
+	mfaEnabled, err := app.Models.MFA.IsEnabled(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if mfaEnabled {
+		app.requireSecondFactor(w, user)
+		return
+	}
+
+	app.completeSignIn(w, user, ip)
+}
+
+// completeSignIn records the successful sign in and answers with the user and their tokens.
+func (app *Config) completeSignIn(w http.ResponseWriter, user *data.User, ip string) {
+	err := app.Models.LoginAttempt.Record(user.Email, ip, true)
+	if err != nil {
+		log.Println("Error recording sign in:", err)
+	}
+
+	type response struct {
+		User *data.User `json:"user"`
+		tokenPair
+	}
+
+	tokens, err := app.issueTokens(user, "")
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Logged in user %s", user.Email),
+		Data: response{
+			User:      user,
+			tokenPair: tokens,
+		},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) Register(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		FirstName            string `json:"first_name,omitempty"`
+		LastName             string `json:"last_name,omitempty"`
+		Email                string `json:"email"`
+		City                 string `json:"city"`
+		Type                 string `json:"type"`
+		Password             string `json:"password"`
+		PasswordConfirmation string `json:"password_confirmation"`
+	}
+	log.Printf("Struct: %+v", requestPayload)
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	//check if email is uniq
+	_, err = app.Models.User.GetByEmail(requestPayload.Email)
+	if err == nil {
+		// An error occurred during the database query
+		app.errorJSON(w, errors.New("email already exists"), http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.PasswordConfirmation != requestPayload.Password {
+		app.errorJSON(w, errors.New("password and password confirmation do not match"), http.StatusBadRequest)
+		return
+	}
+
+	if len(requestPayload.LastName) == 0 || len(requestPayload.FirstName) == 0 {
+		app.errorJSON(w, errors.New("first name and last name should not be empty"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.PasswordPolicy.Validate(requestPayload.Password, requestPayload.Email)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !auth.SelfAssignableRole(requestPayload.Type) {
+		app.errorJSON(w, fmt.Errorf("type should be %s or %s", auth.RoleCustomer, auth.RoleDriver), http.StatusBadRequest)
+		return
+	}
+
+	newUser := data.User{
+		Email:     requestPayload.Email,
+		Password:  requestPayload.Password,
+		FirstName: requestPayload.FirstName,
+		LastName:  requestPayload.LastName,
+		City:      requestPayload.City,
+		Type:      requestPayload.Type,
+	}
+
+	newUser.ID, err = app.Models.User.Insert(newUser)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the account works once the email is verified; a failed email can be sent again
+	err = app.sendVerificationEmail(&newUser)
+	if err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("User registered successfully, a verification link has been sent to %s", newUser.Email),
+		Data:    newUser,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) Update(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	var requestPayload struct {
+		FirstName string `json:"first_name,omitempty"`
+		LastName  string `json:"last_name,omitempty"`
+		City      string `json:"city"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+		return
+	}
+
+	err = verifyToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	err = app.checkTokenData(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	intUserId, _ := strconv.Atoi(userID)
+	user, err := app.Models.User.GetOne(intUserId)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	if len(requestPayload.LastName) == 0 || len(requestPayload.FirstName) == 0 {
+		app.errorJSON(w, errors.New("first name and last name should not be empty"), http.StatusBadRequest)
+		return
+	}
+
+	user.City = requestPayload.City
+	user.FirstName = requestPayload.FirstName
+	user.LastName = requestPayload.LastName
+
+	err = app.Models.User.Update(user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("User registered successfully"),
+		Data:    user,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+		return
+	}
+
+	err := verifyToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	err = app.checkTokenData(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	intUserId, _ := strconv.Atoi(userID)
+	user, err := app.Models.User.GetOne(intUserId)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("User retrieved successfully"),
+		Data:    user,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// maxUserNames is how many users GetUserNames looks up at once.
+const maxUserNames = 100
+
+// GetUserNames returns the display names of the users listed in the ids query parameter, as
+// comma separated ids. Other services call it to show who their data belongs to, so that
+// they do not need to copy user data.
+func (app *Config) GetUserNames(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+	for _, field := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil || id < 1 {
+			app.errorJSON(w, fmt.Errorf("invalid user id %q", field), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if len(ids) > maxUserNames {
+		app.errorJSON(w, fmt.Errorf("at most %d users can be looked up at once", maxUserNames), http.StatusBadRequest)
+		return
+	}
+
+	names := []*data.UserName{}
+	if len(ids) > 0 {
+		found, err := app.Models.User.GetNames(ids)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		names = append(names, found...)
+	}
+
+	type UserNamesResponse struct {
+		Users []*data.UserName `json:"users"`
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("User names retrieved successfully"),
+		Data:    UserNamesResponse{Users: names},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) CheckToken(w http.ResponseWriter, r *http.Request) {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+		return
+	}
+
+	err := verifyToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	err = app.checkTokenData(tokenString)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	tkData, err := extractFieldsFromToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Token verified"),
+		Data:    tkData,
+	}
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// JWKS publishes the public keys tokens are signed with, so other services can verify
+// tokens locally instead of calling CheckToken.
+func (app *Config) JWKS(w http.ResponseWriter, r *http.Request) {
+	jwks := struct {
+		Keys []jwk `json:"keys"`
+	}{
+		Keys: signingKeys.jwks(),
+	}
+
+	headers := http.Header{}
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	app.writeJSON(w, http.StatusOK, jwks, headers)
+}
+
+// RevokedTokens lists the ids of access tokens that were revoked and have not expired yet,
+// and the users whose tokens issued before a cutoff are revoked, for services that verify
+// tokens locally with the JWKS.
+func (app *Config) RevokedTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.Models.RevokedToken.GetActive()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	cutoffs, err := app.Models.RevokedToken.GetActiveCutoffs()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	type revokedToken struct {
+		TokenId   string    `json:"jti"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	type revokedUser struct {
+		UserId       int       `json:"user_id"`
+		IssuedBefore time.Time `json:"issued_before"`
+	}
+
+	revoked := []revokedToken{}
+	for _, token := range tokens {
+		revoked = append(revoked, revokedToken{TokenId: token.TokenID, ExpiresAt: token.ExpiresAt})
+	}
+
+	revokedUsers := []revokedUser{}
+	for _, cutoff := range cutoffs {
+		revokedUsers = append(revokedUsers, revokedUser{UserId: cutoff.UserID, IssuedBefore: cutoff.IssuedBefore})
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Revoked tokens retrieved"),
+		Data: struct {
+			RevokedTokens []revokedToken `json:"revoked_tokens"`
+			RevokedUsers  []revokedUser  `json:"revoked_users"`
+		}{revoked, revokedUsers},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token. Each
+// refresh token works once; presenting one that was already used revokes every token
+// descending from the same sign in, since it means the token was stolen.
+func (app *Config) Refresh(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	refreshToken, err := app.Models.RefreshToken.GetByToken(requestPayload.RefreshToken)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid refresh token"), http.StatusUnauthorized)
+		return
+	}
+
+	if refreshToken.RevokedAt != nil {
+		_ = app.Models.RefreshToken.RevokeFamily(refreshToken.FamilyID)
+		app.errorJSON(w, errors.New("invalid refresh token"), http.StatusUnauthorized)
+		return
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		app.errorJSON(w, errors.New("refresh token expired"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(refreshToken.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid refresh token"), http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := app.issueTokens(user, refreshToken.FamilyID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	rotated, err := app.Models.RefreshToken.MarkReplaced(refreshToken, tokens.refreshTokenID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !rotated {
+		// another request used the same refresh token first
+		_ = app.Models.RefreshToken.RevokeFamily(refreshToken.FamilyID)
+		app.errorJSON(w, errors.New("invalid refresh token"), http.StatusUnauthorized)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Token refreshed"),
+		Data:    tokens,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// Logout revokes the access token used to call it and, when given, the refresh token of the
+// session, so neither can be used again.
+func (app *Config) Logout(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &requestPayload)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || tokenString == "" {
+		app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+		return
+	}
+
+	err := verifyToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	tkData, err := extractFieldsFromToken(tokenString)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+		return
+	}
+
+	if len(tkData.TokenId) > 0 {
+		err = app.Models.RevokedToken.Revoke(tkData.TokenId, tkData.UserId, tkData.ExpiresAt)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if len(requestPayload.RefreshToken) > 0 {
+		refreshToken, err := app.Models.RefreshToken.GetByToken(requestPayload.RefreshToken)
+		if err == nil && refreshToken.UserID == tkData.UserId {
+			err = app.Models.RefreshToken.RevokeFamily(refreshToken.FamilyID)
+			if err != nil {
+				app.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Logged out"),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// PurgeExpiredTokens periodically removes refresh tokens, revocation entries, one time
+// tokens, login attempts and OIDC sign ins that are no longer needed. It is meant to run
+// in its own goroutine.
+func (app *Config) PurgeExpiredTokens() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := app.Models.RefreshToken.DeleteExpired(now); err != nil {
+			log.Println("Error purging refresh tokens:", err)
+		}
+		if err := app.Models.RevokedToken.DeleteExpired(now); err != nil {
+			log.Println("Error purging revoked tokens:", err)
+		}
+		if err := app.Models.OneTimeToken.DeleteExpired(now); err != nil {
+			log.Println("Error purging one time tokens:", err)
+		}
+		if err := app.Models.LoginAttempt.DeleteBefore(now.Add(-loginAttemptRetention)); err != nil {
+			log.Println("Error purging login attempts:", err)
+		}
+		if err := app.Models.OIDCState.DeleteExpired(now); err != nil {
+			log.Println("Error purging OIDC sign ins:", err)
+		}
+	}
+}
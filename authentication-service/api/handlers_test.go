@@ -0,0 +1,181 @@
+package api
+
+import (
+	"common/auth"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterVerifyAndSignIn(t *testing.T) {
+	app := newTestApp(t)
+
+	payload := map[string]any{
+		"first_name":            "Rita",
+		"last_name":             "Rider",
+		"email":                 "rita@example.com",
+		"city":                  "Bucharest",
+		"type":                  auth.RoleCustomer,
+		"password":              testPassword,
+		"password_confirmation": testPassword,
+	}
+	app.do(t, "POST", "/register", "", payload).expect(t, http.StatusAccepted)
+	app.do(t, "POST", "/register", "", payload).expect(t, http.StatusBadRequest)
+
+	admin := map[string]any{}
+	for key, value := range payload {
+		admin[key] = value
+	}
+	admin["email"], admin["type"] = "mallory@example.com", auth.RoleAdmin
+	app.do(t, "POST", "/register", "", admin).expect(t, http.StatusBadRequest)
+
+	weak := map[string]any{}
+	for key, value := range payload {
+		weak[key] = value
+	}
+	weak["email"], weak["password"], weak["password_confirmation"] = "weak@example.com", "password", "password"
+	app.do(t, "POST", "/register", "", weak).expect(t, http.StatusBadRequest)
+
+	credentials := map[string]any{"email": "rita@example.com", "password": testPassword}
+	app.do(t, "POST", "/authenticate", "", credentials).expect(t, http.StatusForbidden)
+
+	app.do(t, "GET", "/verify_email?token=not-a-token", "", nil).expect(t, http.StatusBadRequest)
+	app.do(t, "GET", "/verify_email?token="+app.mailer.lastToken(t, "rita@example.com"), "", nil).expect(t, http.StatusAccepted)
+
+	s := app.signIn(t, "rita@example.com")
+	if s.User.Email != "rita@example.com" || !s.User.Active {
+		t.Fatalf("got user %+v, want rita active", s.User)
+	}
+
+	app.do(t, "POST", "/check_token", s.Token, nil).expect(t, http.StatusAccepted)
+}
+
+func TestResendVerificationEmailAnswersAlike(t *testing.T) {
+	app := newTestApp(t)
+
+	app.do(t, "POST", "/register", "", map[string]any{
+		"first_name":            "Rita",
+		"last_name":             "Rider",
+		"email":                 "rita@example.com",
+		"city":                  "Bucharest",
+		"type":                  auth.RoleCustomer,
+		"password":              testPassword,
+		"password_confirmation": testPassword,
+	}).expect(t, http.StatusAccepted)
+	sent := len(app.mailer.messages)
+
+	// the link was sent a moment ago: no email, but the answer of an unknown address
+	unknown := app.do(t, "POST", "/verify_email/resend", "", map[string]any{"email": "nobody@example.com"}).
+		expect(t, http.StatusAccepted)
+	throttled := app.do(t, "POST", "/verify_email/resend", "", map[string]any{"email": "rita@example.com"}).
+		expect(t, http.StatusAccepted)
+	if throttled.Message != unknown.Message || throttled.Header.Get("Retry-After") != "" {
+		t.Fatalf("got %q for the account, want %q as for an unknown address", throttled.Message, unknown.Message)
+	}
+	if len(app.mailer.messages) != sent {
+		t.Fatalf("got %d emails, want %d", len(app.mailer.messages), sent)
+	}
+}
+
+func TestTokensVerifyWithJWKS(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "dana@example.com", auth.RoleDriver)
+	s := app.signIn(t, "dana@example.com")
+
+	server := httptest.NewServer(app.handler)
+	defer server.Close()
+
+	principal, err := auth.NewVerifier(server.URL).Verify(context.Background(), s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.UserID != s.User.ID || principal.Name != "Test User" || !principal.Can(auth.PermDriveRides) {
+		t.Fatalf("got principal %+v, want the driver", principal)
+	}
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	var rotated session
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": s.RefreshToken}).
+		expect(t, http.StatusAccepted).decode(t, &rotated)
+	if rotated.RefreshToken == "" || rotated.RefreshToken == s.RefreshToken {
+		t.Fatal("the refresh token was not rotated")
+	}
+
+	// replaying the first token revokes the whole family, rotated token included
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": s.RefreshToken}).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": rotated.RefreshToken}).expect(t, http.StatusUnauthorized)
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	app.do(t, "POST", "/logout", s.Token, map[string]any{"refresh_token": s.RefreshToken}).expect(t, http.StatusAccepted)
+
+	app.do(t, "POST", "/check_token", s.Token, nil).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": s.RefreshToken}).expect(t, http.StatusUnauthorized)
+
+	var revoked struct {
+		RevokedTokens []struct {
+			TokenId string `json:"jti"`
+		} `json:"revoked_tokens"`
+	}
+	app.do(t, "GET", "/revoked_tokens", "", nil).expect(t, http.StatusAccepted).decode(t, &revoked)
+	if len(revoked.RevokedTokens) != 1 {
+		t.Fatalf("got %d revoked tokens, want 1", len(revoked.RevokedTokens))
+	}
+}
+
+func TestMalformedAuthorizationIsUnauthorized(t *testing.T) {
+	app := newTestApp(t)
+
+	endpoints := []struct{ method, path string }{
+		{"POST", "/logout"},
+		{"POST", "/check_token"},
+		{"GET", "/users/1"},
+		{"PUT", "/users/1"},
+	}
+	for _, e := range endpoints {
+		for _, header := range []string{"", "Bearer", "Bearer ", "Basic", "Basic dXNlcjpwYXNz"} {
+			request := httptest.NewRequest(e.method, e.path, strings.NewReader("{}"))
+			request.Header.Set("Authorization", header)
+
+			recorder := httptest.NewRecorder()
+			app.handler.ServeHTTP(recorder, request)
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("%s %s with Authorization %q answered %d, want %d", e.method, e.path, header, recorder.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+}
+
+func TestUserNamesNeedPermission(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	app.register(t, "dana@example.com", auth.RoleDriver)
+	rider := app.signIn(t, "rita@example.com")
+	driver := app.signIn(t, "dana@example.com")
+
+	path := fmt.Sprintf("/users/names?ids=%d,%d,999", rider.User.ID, driver.User.ID)
+	app.do(t, "GET", path, rider.Token, nil).expect(t, http.StatusForbidden)
+
+	var names struct {
+		Users []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"users"`
+	}
+	app.do(t, "GET", path, driver.Token, nil).expect(t, http.StatusAccepted).decode(t, &names)
+	if len(names.Users) != 2 || names.Users[0].Name != "Test User" {
+		t.Fatalf("got %+v, want the names of both users", names.Users)
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"authentification/data"
+	"common/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type jsonResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (app *Config) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
+	maxBytes := 1048576 //one megabyte
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must have only a single JSON value")
+	}
+
+	return nil
+}
+
+func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			w.Header()[key] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) error {
+	statusCode := http.StatusBadRequest
+
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	var payload jsonResponse
+	payload.Error = true
+	payload.Message = err.Error()
+
+	return app.writeJSON(w, statusCode, payload)
+}
+
+func (app *Config) checkTokenData(tokenString string) error {
+	tkData, err := extractFieldsFromToken(tokenString)
+	if err != nil {
+		return fmt.Errorf("invalid token (extracting data)")
+	}
+
+	user, err := app.Models.User.GetByEmail(tkData.Email)
+	if err != nil {
+		return fmt.Errorf("the token contains invalid data")
+	}
+
+	if user.ID != tkData.UserId {
+		return fmt.Errorf("the token contains invalid data")
+	}
+
+	if len(tkData.TokenId) > 0 {
+		revoked, err := app.Models.RevokedToken.IsRevoked(tkData.TokenId)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return fmt.Errorf("the token has been revoked")
+		}
+	}
+
+	issuedBefore, err := app.Models.RevokedToken.IssuedBefore(tkData.UserId)
+	if err != nil {
+		return err
+	}
+	if tkData.IssuedAt.Before(issuedBefore) {
+		return fmt.Errorf("the token has been revoked")
+	}
+
+	return nil
+}
+
+// tokenPair is what a client receives when it signs in or refreshes its session.
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	refreshTokenID int
+}
+
+// issueTokens creates an access token and a refresh token for the user. The refresh token
+// joins familyID, or starts a new family when it is empty.
+func (app *Config) issueTokens(user *data.User, familyID string) (tokenPair, error) {
+	tokenString, err := createToken(user.FirstName+" "+user.LastName, user.Email, user.ID, user.Type)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshToken, stored, err := app.Models.RefreshToken.Insert(user.ID, familyID, refreshTokenTTL)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		Token:          tokenString,
+		RefreshToken:   refreshToken,
+		ExpiresIn:      int(accessTokenTTL.Seconds()),
+		refreshTokenID: stored.ID,
+	}, nil
+}
+
+// revokeAccessTokens revokes every access token issued to the user so far. Services that
+// verify tokens locally learn of it with the revocation list.
+func (app *Config) revokeAccessTokens(userID int) error {
+	now := time.Now().Truncate(time.Millisecond)
+	return app.Models.RevokedToken.RevokeIssuedBefore(userID, now, now.Add(accessTokenTTL))
+}
+
+// authenticated authenticates the request with its bearer token and stores the user in the
+// request context as an auth.Principal.
+func (app *Config) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || tokenString == "" {
+			app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+			return
+		}
+
+		err := verifyToken(tokenString)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+			return
+		}
+
+		err = app.checkTokenData(tokenString)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+			return
+		}
+
+		tkData, err := extractFieldsFromToken(tokenString)
+		if err != nil {
+			app.errorJSON(w, errors.New("invalid token"), http.StatusUnauthorized)
+			return
+		}
+
+		principal := &auth.Principal{
+			UserID:      tkData.UserId,
+			Name:        tkData.Username,
+			Email:       tkData.Email,
+			Type:        tkData.Type,
+			Permissions: tkData.Permissions,
+			TokenID:     tkData.TokenId,
+			ExpiresAt:   tkData.ExpiresAt,
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+// requirePermission authenticates the request like authenticated and only lets it through
+// when the user was granted the permission.
+func (app *Config) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return app.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.Current(r).Can(permission) {
+				app.errorJSON(w, errors.New("your account is not allowed to do this"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"authentification/data"
+	"common/auth"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// signingKeys holds the keys tokens are signed and verified with. It is loaded by LoadSigningKeys.
+var signingKeys *keySet
+
+const (
+	// accessTokenTTL is kept short because access tokens can only be revoked one by one.
+	accessTokenTTL = 15 * time.Minute
+
+	// refreshTokenTTL is how long a user stays signed in without authenticating again.
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type tokenData struct {
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	UserId      int       `json:"user_id"`
+	Type        string    `json:"type"`
+	Permissions []string  `json:"permissions"`
+	TokenId     string    `json:"-"`
+	IssuedAt    time.Time `json:"-"`
+	ExpiresAt   time.Time `json:"-"`
+}
+
+func createToken(username, email string, userID int, userType string) (string, error) {
+	tokenId, err := data.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	// iat is kept to the millisecond, so that tokens issued right after the user's tokens
+	// were revoked are not revoked as well
+	now := time.Now()
+	tokenString, err := signingKeys.sign(jwt.MapClaims{
+		"username":    username,
+		"email":       email,
+		"type":        userType,
+		"permissions": auth.PermissionsFor(userType),
+		"id":          userID,
+		"jti":         tokenId,
+		"iat":         float64(now.UnixMilli()) / 1000,
+		"exp":         now.Add(accessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return tokenString, nil
+}
+
+func parseTokenClaims(tokenString string) (jwt.MapClaims, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+func extractFieldsFromToken(tokenString string) (tokenData, error) {
+
+	tkData := tokenData{}
+
+	// Verify the token
+	claims, err := parseTokenClaims(tokenString)
+	if err != nil {
+		return tkData, err
+	}
+
+	// Access fields from claims
+	tkData.Username = claims["username"].(string)
+	tkData.Email = claims["email"].(string)
+	tkData.UserId = int(claims["id"].(float64))
+	tkData.Type = claims["type"].(string)
+
+	// tokens issued before permissions were embedded get those of their role
+	tkData.Permissions = auth.PermissionsFor(tkData.Type)
+	if permissions, ok := claims["permissions"].([]any); ok {
+		tkData.Permissions = []string{}
+		for _, permission := range permissions {
+			if p, ok := permission.(string); ok {
+				tkData.Permissions = append(tkData.Permissions, p)
+			}
+		}
+	}
+
+	// tokens issued before revocation support have no jti
+	tkData.TokenId, _ = claims["jti"].(string)
+	tkData.IssuedAt = auth.IssuedAt(claims)
+	if exp, ok := claims["exp"].(float64); ok {
+		tkData.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return tkData, nil
+}
+
+func verifyToken(tokenString string) error {
+	token, err := jwt.Parse(tokenString, signingKeys.keyFunc)
+
+	if err != nil {
+		return err
+	}
+
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+
+	return nil
+}
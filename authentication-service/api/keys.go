@@ -0,0 +1,310 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// legacyKeyID identifies the shared HS256 secret. Tokens signed with it before key ids
+// were introduced carry no kid header at all.
+const legacyKeyID = "hs256"
+
+// devSecret is the HS256 secret of local development, which must never sign real tokens.
+const devSecret = "secret-key"
+
+// signingKey is one key tokens can be signed or verified with. Private is nil for keys that
+// are only kept around to verify tokens issued before a rotation.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private any
+	Public  any
+}
+
+// keySet holds every key currently accepted for verification and the one used for signing.
+type keySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// SigningKeySettings say which keys sign and verify tokens, from the JWT_* settings.
+type SigningKeySettings struct {
+	// Dir is a directory of PEM files named <kid>.pem holding RSA (RS256) or P-256 (ES256)
+	// keys. Private keys sign and verify, public keys only verify.
+	Dir string
+
+	// SigningKeyID picks the private key that signs new tokens. It defaults to the last kid
+	// in lexical order, so naming keys by date rotates to the newest one.
+	SigningKeyID string
+
+	// Secret is an HS256 secret. It signs tokens only when no private key is configured,
+	// and otherwise keeps tokens signed with it valid during a migration.
+	Secret string
+
+	// DevMode signs tokens with the well known development secret when neither keys nor a
+	// secret are configured. Without it, loading fails rather than issue tokens anyone can
+	// forge.
+	DevMode bool
+}
+
+// loadKeySet builds the key set described by the settings.
+func loadKeySet(settings SigningKeySettings) (*keySet, error) {
+	ks := &keySet{keys: make(map[string]*signingKey)}
+
+	if settings.Dir != "" {
+		err := ks.loadDir(settings.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	secret := settings.Secret
+	if secret == "" && len(ks.keys) == 0 {
+		if !settings.DevMode {
+			return nil, errors.New("no JWT keys configured: set JWT_KEYS_DIR or JWT_SECRET, or JWT_DEV_MODE to sign tokens with the development secret")
+		}
+		log.Println("No JWT keys configured, signing tokens with the development secret")
+		secret = devSecret
+	}
+	if secret != "" {
+		ks.keys[legacyKeyID] = &signingKey{
+			ID:      legacyKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: []byte(secret),
+			Public:  []byte(secret),
+		}
+	}
+
+	signingID := settings.SigningKeyID
+	if signingID == "" {
+		signingID = ks.defaultSigningID()
+	}
+
+	key, ok := ks.keys[signingID]
+	if !ok || key.Private == nil {
+		return nil, fmt.Errorf("no private key with id %q to sign tokens with", signingID)
+	}
+	ks.signing = key
+
+	return ks, nil
+}
+
+// LoadSigningKeys loads the key set described by the settings and makes it the one tokens
+// are signed and verified with.
+func LoadSigningKeys(settings SigningKeySettings) error {
+	keys, err := loadKeySet(settings)
+	if err != nil {
+		return err
+	}
+
+	signingKeys = keys
+	log.Printf("Signing tokens with key %s\n", signingKeys.signing.ID)
+
+	return nil
+}
+
+// loadDir reads every <kid>.pem file of dir.
+func (ks *keySet) loadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .pem key files in %s", dir)
+	}
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		if kid == legacyKeyID {
+			return fmt.Errorf("%s: the key id %q is reserved", file, legacyKeyID)
+		}
+
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		key, err := parseKey(kid, contents)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		ks.keys[kid] = key
+	}
+
+	return nil
+}
+
+// defaultSigningID returns the last asymmetric private key id in lexical order, or the
+// HS256 secret when there is none.
+func (ks *keySet) defaultSigningID() string {
+	var ids []string
+	for id, key := range ks.keys {
+		if id != legacyKeyID && key.Private != nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return legacyKeyID
+	}
+
+	sort.Strings(ids)
+	return ids[len(ids)-1]
+}
+
+// parseKey decodes a PEM encoded RSA or P-256 key, private or public.
+func parseKey(kid string, contents []byte) (*signingKey, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private, public any
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private = k
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private = k
+	case "EC PRIVATE KEY":
+		k, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private = k
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public = k
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		public = &k.PublicKey
+	case nil:
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{ID: kid, Method: jwt.SigningMethodRS256, Private: private, Public: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 elliptic curve keys are supported")
+		}
+		return &signingKey{ID: kid, Method: jwt.SigningMethodES256, Private: private, Public: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// sign signs the claims with the current signing key and sets the kid header.
+func (ks *keySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != legacyKeyID {
+		token.Header["kid"] = ks.signing.ID
+	}
+
+	return token.SignedString(ks.signing.Private)
+}
+
+// keyFunc resolves the verification key of a token from its kid header. Tokens without a
+// kid were signed with the HS256 secret.
+func (ks *keySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyKeyID
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return key.Public, nil
+}
+
+// jwk is the JSON Web Key representation of a public key (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jwks returns the public keys other services may verify tokens with. The HS256 secret is
+// never published.
+func (ks *keySet) jwks() []jwk {
+	keys := []jwk{}
+
+	for _, key := range ks.keys {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "RSA",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			ecdhKey, err := public.ECDH()
+			if err != nil {
+				continue
+			}
+			// uncompressed point: 0x04 || X || Y
+			point := ecdhKey.Bytes()
+			keys = append(keys, jwk{
+				Kty: "EC",
+				Kid: key.ID,
+				Alg: key.Method.Alg(),
+				Use: "sig",
+				Crv: "P-256",
+				X:   base64.RawURLEncoding.EncodeToString(point[1:33]),
+				Y:   base64.RawURLEncoding.EncodeToString(point[33:]),
+			})
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+
+	return keys
+}
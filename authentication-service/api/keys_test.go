@@ -0,0 +1,25 @@
+package api
+
+import "testing"
+
+func TestKeySetNeedsKeysOutsideDevMode(t *testing.T) {
+	if _, err := loadKeySet(SigningKeySettings{}); err == nil {
+		t.Fatal("the key set loaded without keys, a secret or dev mode")
+	}
+
+	keys, err := loadKeySet(SigningKeySettings{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.signing.ID != legacyKeyID || string(keys.signing.Private.([]byte)) != devSecret {
+		t.Fatalf("got signing key %s, want the development secret in dev mode", keys.signing.ID)
+	}
+
+	keys, err = loadKeySet(SigningKeySettings{Secret: "a production secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(keys.signing.Private.([]byte)) != "a production secret" {
+		t.Fatal("the configured secret does not sign tokens")
+	}
+}
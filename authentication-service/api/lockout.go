@@ -0,0 +1,219 @@
+package api
+
+import (
+	"authentification/data"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// failureWindow is how far back failed sign in attempts are counted.
+	failureWindow = 15 * time.Minute
+
+	// freeAttempts is how many failed attempts on an account are allowed without delay.
+	// Each failure after that doubles the delay before the next attempt, up to maxDelay.
+	freeAttempts = 3
+	maxDelay     = 30 * time.Second
+
+	// accountLockoutThreshold and ipLockoutThreshold are the failed attempts within
+	// failureWindow after which an account, or an IP address, is locked for lockoutDuration.
+	accountLockoutThreshold = 10
+	ipLockoutThreshold      = 50
+	lockoutDuration         = 15 * time.Minute
+
+	// loginAttemptRetention is how long sign in attempts are kept. Lockouts are kept for
+	// good as an audit trail.
+	loginAttemptRetention = 30 * 24 * time.Hour
+)
+
+// loginBlock tells a client when it may try to sign in again.
+type loginBlock struct {
+	Message string
+	Until   time.Time
+}
+
+// checkLoginAllowed returns a block when the account or the IP address is locked out, or
+// when the previous failure on the account was too recent.
+func (app *Config) checkLoginAllowed(email, ip string) (*loginBlock, error) {
+	lockout, err := app.Models.Lockout.GetActive(email, ip)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if lockout != nil {
+		return &loginBlock{
+			Message: "sign in is temporarily locked after too many failed attempts",
+			Until:   lockout.LockedUntil,
+		}, nil
+	}
+
+	failures, err := app.Models.LoginAttempt.AccountFailures(email, time.Now().Add(-failureWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	delay := attemptDelay(failures.Count)
+	if delay > 0 && failures.Latest != nil && time.Since(*failures.Latest) < delay {
+		return &loginBlock{
+			Message: "too many failed sign in attempts, wait before trying again",
+			Until:   failures.Latest.Add(delay),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// attemptDelay returns how long to wait after the given number of consecutive failures.
+func attemptDelay(failures int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+
+	delay := time.Second << (failures - freeAttempts)
+	if delay > maxDelay || delay <= 0 {
+		return maxDelay
+	}
+
+	return delay
+}
+
+// recordLoginFailure stores a failed attempt and locks the account or the IP address when
+// it crossed its threshold.
+func (app *Config) recordLoginFailure(email, ip string) error {
+	err := app.Models.LoginAttempt.Record(email, ip, false)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-failureWindow)
+
+	accountFailures, err := app.Models.LoginAttempt.AccountFailures(email, since)
+	if err != nil {
+		return err
+	}
+	if accountFailures.Count >= accountLockoutThreshold {
+		err = app.lock(data.Lockout{Email: &email, FailedAttempts: accountFailures.Count})
+		if err != nil {
+			return err
+		}
+	}
+
+	ipFailures, err := app.Models.LoginAttempt.IPFailures(ip, since)
+	if err != nil {
+		return err
+	}
+	if ipFailures.Count >= ipLockoutThreshold {
+		err = app.lock(data.Lockout{IP: &ip, FailedAttempts: ipFailures.Count})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lock stores the lockout, which is also its audit record.
+func (app *Config) lock(lockout data.Lockout) error {
+	lockout.LockedUntil = time.Now().Add(lockoutDuration)
+
+	_, err := app.Models.Lockout.Insert(lockout)
+	if err != nil {
+		return err
+	}
+
+	if lockout.Email != nil {
+		log.Printf("Locked sign in for account %s after %d failed attempts\n", *lockout.Email, lockout.FailedAttempts)
+	} else {
+		log.Printf("Locked sign in from %s after %d failed attempts\n", *lockout.IP, lockout.FailedAttempts)
+	}
+
+	return nil
+}
+
+// writeLoginBlock answers a blocked sign in attempt with 429 Too Many Requests.
+func (app *Config) writeLoginBlock(w http.ResponseWriter, block *loginBlock) {
+	retryAfter := int(time.Until(block.Until).Seconds()) + 1
+
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.Itoa(retryAfter))
+
+	payload := jsonResponse{
+		Error:   true,
+		Message: fmt.Sprintf("%s, try again in %d seconds", block.Message, retryAfter),
+	}
+
+	app.writeJSON(w, http.StatusTooManyRequests, payload, headers)
+}
+
+// ParseTrustedProxies parses a comma separated list of addresses and networks, such as
+// "10.0.0.0/8, 192.168.1.10", for Config.TrustedProxies.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			entry = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For when the request
+// comes from a trusted proxy.
+func (app *Config) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || !app.isTrustedProxy(addr.Unmap()) {
+		return addr.Unmap().String()
+	}
+
+	// the last entry was added by the trusted proxy itself
+	entries := strings.Split(forwarded, ",")
+	client := strings.TrimSpace(entries[len(entries)-1])
+	if _, err := netip.ParseAddr(client); err != nil {
+		return addr.Unmap().String()
+	}
+
+	return client
+}
+
+func (app *Config) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"common/auth"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFailedSignInsAreThrottled(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+
+	wrong := map[string]any{"email": "rita@example.com", "password": "wrong-Password-1"}
+	for i := 0; i < freeAttempts; i++ {
+		app.do(t, "POST", "/authenticate", "", wrong).expect(t, http.StatusBadRequest)
+	}
+
+	// even the right password waits for the delay to pass
+	resp := app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": testPassword})
+	resp.expect(t, http.StatusTooManyRequests)
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+}
+
+func TestAdminUnlocksLockedAccount(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	admin := app.staff(t, "admin@example.com", auth.RoleAdmin)
+	support := app.staff(t, "support@example.com", auth.RoleSupport)
+
+	for i := 0; i < accountLockoutThreshold; i++ {
+		err := app.recordLoginFailure("rita@example.com", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	credentials := map[string]any{"email": "rita@example.com", "password": testPassword}
+	app.do(t, "POST", "/authenticate", "", credentials).expect(t, http.StatusTooManyRequests)
+
+	var lockouts struct {
+		Lockouts []struct {
+			Email string `json:"email"`
+		} `json:"lockouts"`
+	}
+	app.do(t, "GET", "/admin/lockouts", support.Token, nil).expect(t, http.StatusAccepted).decode(t, &lockouts)
+	if len(lockouts.Lockouts) != 1 || lockouts.Lockouts[0].Email != "rita@example.com" {
+		t.Fatalf("got lockouts %+v, want the one of rita", lockouts.Lockouts)
+	}
+
+	user, err := app.Models.User.GetByEmail("rita@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/admin/users/%d/unlock", user.ID)
+
+	app.do(t, "PUT", path, support.Token, nil).expect(t, http.StatusForbidden)
+	app.do(t, "PUT", path, admin.Token, nil).expect(t, http.StatusAccepted)
+
+	app.signIn(t, "rita@example.com")
+}
+
+func TestClientIPTrustsConfiguredProxies(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8, broker"); err == nil {
+		t.Fatal("an invalid trusted proxy was accepted")
+	}
+
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &Config{TrustedProxies: proxies}
+
+	for remote, want := range map[string]string{
+		"10.1.2.3:4000":     "203.0.113.7",
+		"192.168.1.10:4000": "203.0.113.7",
+		"192.168.1.11:4000": "192.168.1.11",
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/authenticate", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+
+		if got := app.clientIP(r); got != want {
+			t.Fatalf("got client %s from %s, want %s", got, remote, want)
+		}
+	}
+}
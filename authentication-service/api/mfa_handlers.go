@@ -0,0 +1,367 @@
+package api
+
+import (
+	"authentification/data"
+	"authentification/totp"
+	"common/auth"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// mfaIssuer is the account issuer shown by authenticator apps.
+	mfaIssuer = "Uber App"
+
+	// mfaPendingTTL is how long a user has to enter their code after their password.
+	mfaPendingTTL = 5 * time.Minute
+
+	// mfaSkew is how many 30 second steps of clock drift are tolerated either way.
+	mfaSkew = 1
+
+	// recoveryCodeCount is how many recovery codes a user gets.
+	recoveryCodeCount = 10
+)
+
+// mfaRoles are the roles allowed to enable two factor authentication.
+var mfaRoles = []string{auth.RoleDriver, auth.RoleAdmin, auth.RoleSupport}
+
+// EnrollMFA generates a TOTP secret for the user. It is only enabled once ConfirmMFA
+// receives a valid code, proving the authenticator app was set up.
+func (app *Config) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	if !principal.HasRole(mfaRoles...) {
+		app.errorJSON(w, errors.New("two factor authentication is only available to drivers and staff"), http.StatusForbidden)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.Models.MFA.Enroll(principal.UserID, secret)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Add the secret to your authenticator app, then confirm with a code"),
+		Data: struct {
+			Secret     string `json:"secret"`
+			OtpauthURI string `json:"otpauth_uri"`
+		}{
+			Secret:     secret,
+			OtpauthURI: totp.URI(mfaIssuer, principal.Email, secret),
+		},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ConfirmMFA enables two factor authentication with a code from the enrolled secret and
+// returns the recovery codes, which are shown this one time only.
+func (app *Config) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	var requestPayload struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := app.Models.MFA.GetByUser(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("start the enrollment first"), http.StatusBadRequest)
+		return
+	}
+	if mfa.ConfirmedAt != nil {
+		app.errorJSON(w, errors.New("two factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	if !app.validateTOTP(mfa, requestPayload.Code) {
+		app.errorJSON(w, errors.New("invalid code"), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := app.replaceRecoveryCodes(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.Models.MFA.Confirm(mfa)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Two factor authentication enabled, store the recovery codes somewhere safe"),
+		Data: struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{codes},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// DisableMFA turns two factor authentication off, given a current code or a recovery code.
+func (app *Config) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	var requestPayload struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := app.Models.MFA.GetByUser(principal.UserID)
+	if err != nil || mfa.ConfirmedAt == nil {
+		app.errorJSON(w, errors.New("two factor authentication is not enabled"), http.StatusBadRequest)
+		return
+	}
+
+	ok, err := app.checkSecondFactor(mfa, requestPayload.Code, requestPayload.RecoveryCode)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		app.errorJSON(w, errors.New("invalid code"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.MFA.Disable(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Two factor authentication disabled"),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, given a current code.
+func (app *Config) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	var requestPayload struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	mfa, err := app.Models.MFA.GetByUser(principal.UserID)
+	if err != nil || mfa.ConfirmedAt == nil {
+		app.errorJSON(w, errors.New("two factor authentication is not enabled"), http.StatusBadRequest)
+		return
+	}
+
+	if !app.validateTOTP(mfa, requestPayload.Code) {
+		app.errorJSON(w, errors.New("invalid code"), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := app.replaceRecoveryCodes(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Recovery codes regenerated, the previous ones no longer work"),
+		Data: struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{codes},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// AuthenticateMFA completes a sign in started by Authenticate for a user with two factor
+// authentication, exchanging the mfa_pending token and a code for the user's tokens. Wrong
+// codes count as failed sign in attempts.
+func (app *Config) AuthenticateMFA(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	pending, err := app.Models.OneTimeToken.Get(data.PurposeMFAPending, requestPayload.MFAToken)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired mfa token, sign in again"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(pending.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired mfa token, sign in again"), http.StatusUnauthorized)
+		return
+	}
+
+	ip := app.clientIP(r)
+
+	block, err := app.checkLoginAllowed(user.Email, ip)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		app.writeLoginBlock(w, block)
+		return
+	}
+
+	mfa, err := app.Models.MFA.GetByUser(user.ID)
+	if err != nil || mfa.ConfirmedAt == nil {
+		app.errorJSON(w, errors.New("two factor authentication is not enabled"), http.StatusBadRequest)
+		return
+	}
+
+	ok, err := app.checkSecondFactor(mfa, requestPayload.Code, requestPayload.RecoveryCode)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		err = app.recordLoginFailure(user.Email, ip)
+		if err != nil {
+			log.Println("Error recording failed sign in:", err)
+		}
+		app.errorJSON(w, errors.New("invalid code"), http.StatusBadRequest)
+		return
+	}
+
+	// the token works once, even when two requests race with valid codes
+	_, err = app.Models.OneTimeToken.Use(data.PurposeMFAPending, requestPayload.MFAToken)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired mfa token, sign in again"), http.StatusUnauthorized)
+		return
+	}
+
+	app.completeSignIn(w, user, ip)
+}
+
+// requireSecondFactor answers a correct password of a user with two factor authentication
+// with an mfa_pending token, to be exchanged at AuthenticateMFA.
+func (app *Config) requireSecondFactor(w http.ResponseWriter, user *data.User) {
+	token, _, err := app.Models.OneTimeToken.Insert(user.ID, data.PurposeMFAPending, mfaPendingTTL)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Enter the code from your authenticator app"),
+		Data: struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}{
+			MFARequired: true,
+			MFAToken:    token,
+			ExpiresIn:   int(mfaPendingTTL.Seconds()),
+		},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// checkSecondFactor validates a TOTP code, or a recovery code when no TOTP code is given.
+func (app *Config) checkSecondFactor(mfa *data.MFA, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		return app.validateTOTP(mfa, code), nil
+	}
+
+	if recoveryCode == "" {
+		return false, nil
+	}
+
+	return app.Models.RecoveryCode.Use(mfa.UserID, normalizeRecoveryCode(recoveryCode))
+}
+
+// validateTOTP checks the code and marks its time step as used.
+func (app *Config) validateTOTP(mfa *data.MFA, code string) bool {
+	step, ok := totp.Validate(mfa.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return false
+	}
+
+	fresh, err := app.Models.MFA.UseStep(mfa, step)
+	if err != nil {
+		log.Println("Error recording used code:", err)
+		return false
+	}
+
+	return fresh
+}
+
+// replaceRecoveryCodes generates and stores a new set of recovery codes for the user.
+func (app *Config) replaceRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		code := base32.StdEncoding.EncodeToString(b)
+		codes[i] = strings.ToLower(code[:4] + "-" + code[4:])
+	}
+
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = normalizeRecoveryCode(code)
+	}
+
+	err := app.Models.RecoveryCode.Replace(userID, normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case and separators, so codes can be typed loosely.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"authentification/totp"
+	"common/auth"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// code returns the TOTP code of the secret, steps time steps from now.
+func code(t *testing.T, secret string, steps int64) string {
+	t.Helper()
+
+	c, err := totp.Code(secret, totp.Step(time.Now())+steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestTwoFactorSignIn(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	app.register(t, "dana@example.com", auth.RoleDriver)
+
+	rider := app.signIn(t, "rita@example.com")
+	app.do(t, "POST", "/mfa/enroll", rider.Token, nil).expect(t, http.StatusForbidden)
+
+	driver := app.signIn(t, "dana@example.com")
+
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	app.do(t, "POST", "/mfa/enroll", driver.Token, nil).expect(t, http.StatusAccepted).decode(t, &enrollment)
+
+	app.do(t, "POST", "/mfa/confirm", driver.Token, map[string]any{"code": "000000"}).expect(t, http.StatusBadRequest)
+
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	app.do(t, "POST", "/mfa/confirm", driver.Token, map[string]any{"code": code(t, enrollment.Secret, -1)}).
+		expect(t, http.StatusAccepted).decode(t, &confirmed)
+	if len(confirmed.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(confirmed.RecoveryCodes), recoveryCodeCount)
+	}
+
+	app.do(t, "POST", "/mfa/enroll", driver.Token, nil).expect(t, http.StatusConflict)
+
+	// the password alone only gets a pending token
+	var pending struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "dana@example.com", "password": testPassword}).
+		expect(t, http.StatusAccepted).decode(t, &pending)
+	if !pending.MFARequired || pending.MFAToken == "" {
+		t.Fatalf("got %+v, want a second factor required", pending)
+	}
+
+	// the code used to confirm can not be replayed
+	app.do(t, "POST", "/authenticate/mfa", "", map[string]any{"mfa_token": pending.MFAToken, "code": code(t, enrollment.Secret, -1)}).
+		expect(t, http.StatusBadRequest)
+
+	var s session
+	app.do(t, "POST", "/authenticate/mfa", "", map[string]any{"mfa_token": pending.MFAToken, "code": code(t, enrollment.Secret, 0)}).
+		expect(t, http.StatusAccepted).decode(t, &s)
+	if s.Token == "" {
+		t.Fatal("no token after the second factor")
+	}
+
+	app.do(t, "POST", "/authenticate/mfa", "", map[string]any{"mfa_token": pending.MFAToken, "code": code(t, enrollment.Secret, 1)}).
+		expect(t, http.StatusUnauthorized)
+
+	// a recovery code works once
+	recovery := map[string]any{"recovery_code": confirmed.RecoveryCodes[0]}
+	app.do(t, "POST", "/mfa/disable", s.Token, recovery).expect(t, http.StatusAccepted)
+
+	app.signIn(t, "dana@example.com")
+}
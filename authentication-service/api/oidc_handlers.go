@@ -0,0 +1,247 @@
+package api
+
+import (
+	"authentification/data"
+	"authentification/oidc"
+	"common/auth"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// oidcStateTTL is how long a user has to sign in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// ListOIDCProviders returns the names of the providers users can sign in with.
+func (app *Config) ListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for name := range app.OIDCProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("OIDC providers"),
+		Data:    names,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// OIDCLogin redirects the user to the sign in page of the provider.
+func (app *Config) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.OIDCProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.errorJSON(w, errors.New("unknown provider"), http.StatusNotFound)
+		return
+	}
+
+	codeVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	state, err := app.Models.OIDCState.Insert(data.OIDCState{
+		Provider:     provider.Name,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+	}, oidcStateTTL)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Println("Error starting OIDC sign in:", err)
+		app.errorJSON(w, fmt.Errorf("%s is not available, try again later", provider.Name), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback completes a sign in at the provider. The provider account is linked to the
+// user with the same verified email address, or to a new rider account, and the user gets
+// the same answer as from Authenticate.
+func (app *Config) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.OIDCProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.errorJSON(w, errors.New("unknown provider"), http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		app.errorJSON(w, fmt.Errorf("%s sign in failed: %s %s", provider.Name, providerError, query.Get("error_description")), http.StatusUnauthorized)
+		return
+	}
+
+	state, err := app.Models.OIDCState.Use(provider.Name, query.Get("state"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired sign in, start again"), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Println("Error completing OIDC sign in:", err)
+		app.errorJSON(w, fmt.Errorf("could not sign in with %s", provider.Name), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.userForIdentity(provider.Name, claims)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// the provider vouches for the email address, so it needs no verification by us
+	if !user.Active && claims.EmailVerified && strings.EqualFold(claims.Email, user.Email) {
+		err = app.Models.User.Activate(user)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if !user.Active {
+		app.errorJSON(w, errors.New("verify your email address before signing in"), http.StatusForbidden)
+		return
+	}
+
+	mfaEnabled, err := app.Models.MFA.IsEnabled(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if mfaEnabled {
+		app.requireSecondFactor(w, user)
+		return
+	}
+
+	app.completeSignIn(w, user, app.clientIP(r))
+}
+
+// userForIdentity returns the user linked to the provider account. An account signing in
+// for the first time is linked to the user with its email address, which the provider must
+// have verified so that nobody can take over an account by claiming its email address. A
+// rider account is created when there is no such user, and the credentials of a user that
+// never verified the address are cleared before linking it.
+func (app *Config) userForIdentity(provider string, claims *oidc.Claims) (*data.User, error) {
+	identity, err := app.Models.Identity.GetBySubject(provider, claims.Subject)
+	if err == nil {
+		err = app.Models.Identity.Touch(identity, claims.Email)
+		if err != nil {
+			log.Println("Error recording OIDC sign in:", err)
+		}
+		return app.Models.User.GetOne(identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("%s did not confirm your email address", provider)
+	}
+
+	user, err := app.Models.User.GetByEmail(claims.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = app.createUserForIdentity(claims)
+	case err == nil && !user.Active:
+		err = app.clearCredentials(user)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = app.Models.Identity.Insert(data.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Linked %s account %s to user %d\n", provider, claims.Subject, user.ID)
+	return user, nil
+}
+
+// clearCredentials removes the password, second factor and sessions of an account whose
+// email address was never verified. Whoever registered it did not prove owning the address,
+// so they must not keep access once its owner signs in with a provider.
+func (app *Config) clearCredentials(user *data.User) error {
+	password, err := data.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.User.ResetPassword(user, password)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.MFA.Disable(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.OneTimeToken.DeleteForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Cleared the credentials of unverified user %d before linking a provider account\n", user.ID)
+	return app.Models.RefreshToken.RevokeAllForUser(user.ID)
+}
+
+// createUserForIdentity creates a rider account for a provider account. Its password is
+// random and unknown to anybody; the user can still set one with the forgotten password
+// flow.
+func (app *Config) createUserForIdentity(claims *oidc.Claims) (*data.User, error) {
+	password, err := data.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := data.User{
+		Email:     claims.Email,
+		Password:  password,
+		FirstName: firstName,
+		LastName:  lastName,
+		Type:      auth.RoleCustomer,
+		Active:    true,
+	}
+
+	user.ID, err = app.Models.User.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
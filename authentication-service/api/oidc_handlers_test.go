@@ -0,0 +1,178 @@
+package api
+
+import (
+	"authentification/oidc"
+	"authentification/oidc/mockoidc"
+	"common/auth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// withMockProvider lets users of the app sign in with a mock provider named "mock".
+func (a *testApp) withMockProvider(t *testing.T) {
+	t.Helper()
+
+	mock, err := mockoidc.New("", "", "uber-app", "mock-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	mock.Issuer, mock.InternalURL = server.URL, server.URL
+
+	a.OIDCProviders = map[string]*oidc.Provider{
+		"mock": oidc.NewProvider(oidc.Config{
+			Name:         "mock",
+			Issuer:       server.URL,
+			ClientID:     "uber-app",
+			ClientSecret: "mock-secret",
+			RedirectURL:  "http://auth.test/oidc/mock/callback",
+		}),
+	}
+}
+
+// startOIDCSignIn goes through the provider, signing in with the answers of its form, and
+// returns the callback the provider sends the browser back to.
+func (a *testApp) startOIDCSignIn(t *testing.T, answers url.Values) *url.URL {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	a.handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/oidc/mock/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login answered %d: %s", recorder.Code, recorder.Body)
+	}
+
+	authorize, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	for key, values := range answers {
+		query[key] = values
+	}
+	authorize.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authorize.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	callback, err := url.Parse(response.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		t.Fatalf("provider answered %d without sending the browser back", response.StatusCode)
+	}
+	return callback
+}
+
+// oidcSignIn signs in with the provider as the email address, verified by the provider.
+func (a *testApp) oidcSignIn(t *testing.T, email string) response {
+	t.Helper()
+
+	callback := a.startOIDCSignIn(t, url.Values{"login_hint": {email}})
+	return a.do(t, "GET", callback.RequestURI(), "", nil)
+}
+
+func TestOIDCSignInCreatesRider(t *testing.T) {
+	app := newTestApp(t)
+	app.withMockProvider(t)
+
+	var first session
+	app.oidcSignIn(t, "rita@example.com").expect(t, http.StatusAccepted).decode(t, &first)
+	if first.Token == "" || first.User.Email != "rita@example.com" || first.User.Type != auth.RoleCustomer || !first.User.Active {
+		t.Fatalf("got %+v, want a new active rider signed in", first)
+	}
+
+	var again session
+	app.oidcSignIn(t, "rita@example.com").expect(t, http.StatusAccepted).decode(t, &again)
+	if again.User.ID != first.User.ID {
+		t.Fatalf("got user %d signing in again, want %d", again.User.ID, first.User.ID)
+	}
+}
+
+func TestOIDCLinksVerifiedUser(t *testing.T) {
+	app := newTestApp(t)
+	app.withMockProvider(t)
+	app.register(t, "dana@example.com", auth.RoleDriver)
+
+	var s session
+	app.oidcSignIn(t, "dana@example.com").expect(t, http.StatusAccepted).decode(t, &s)
+	if s.User.Type != auth.RoleDriver {
+		t.Fatalf("got %+v, want the existing driver", s.User)
+	}
+
+	identities, err := app.Models.Identity.GetAllForUser(s.User.ID)
+	if err != nil || len(identities) != 1 || identities[0].Provider != "mock" {
+		t.Fatalf("got identities %+v (%v), want the mock account linked", identities, err)
+	}
+
+	// the password keeps working
+	app.signIn(t, "dana@example.com")
+}
+
+func TestOIDCRefusesUnverifiedEmail(t *testing.T) {
+	app := newTestApp(t)
+	app.withMockProvider(t)
+	app.register(t, "dana@example.com", auth.RoleDriver)
+
+	callback := app.startOIDCSignIn(t, url.Values{"email": {"dana@example.com"}, "email_verified": {"false"}})
+	app.do(t, "GET", callback.RequestURI(), "", nil).expect(t, http.StatusBadRequest)
+
+	user, err := app.Models.User.GetByEmail("dana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	identities, _ := app.Models.Identity.GetAllForUser(user.ID)
+	if len(identities) != 0 {
+		t.Fatalf("got identities %+v, want none linked", identities)
+	}
+}
+
+func TestOIDCClearsCredentialsOfUnverifiedAccount(t *testing.T) {
+	app := newTestApp(t)
+	app.withMockProvider(t)
+
+	// somebody registers the address of the victim, with a password they know
+	app.do(t, "POST", "/register", "", map[string]any{
+		"first_name":            "Mallory",
+		"last_name":             "Attacker",
+		"email":                 "rita@example.com",
+		"city":                  "Bucharest",
+		"type":                  auth.RoleCustomer,
+		"password":              testPassword,
+		"password_confirmation": testPassword,
+	}).expect(t, http.StatusAccepted)
+
+	var s session
+	app.oidcSignIn(t, "rita@example.com").expect(t, http.StatusAccepted).decode(t, &s)
+	if !s.User.Active {
+		t.Fatalf("got %+v, want the account activated for its owner", s.User)
+	}
+
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": testPassword}).
+		expect(t, http.StatusBadRequest)
+}
+
+func TestOIDCRejectsForgedCallbacks(t *testing.T) {
+	app := newTestApp(t)
+	app.withMockProvider(t)
+
+	callback := app.startOIDCSignIn(t, url.Values{"login_hint": {"rita@example.com"}})
+	query := callback.Query()
+	query.Set("state", "forged")
+	app.do(t, "GET", "/oidc/mock/callback?"+query.Encode(), "", nil).expect(t, http.StatusBadRequest)
+
+	// the code of one sign in with the state of another fails the PKCE check
+	first := app.startOIDCSignIn(t, url.Values{"login_hint": {"rita@example.com"}})
+	second := app.startOIDCSignIn(t, url.Values{"login_hint": {"rita@example.com"}})
+	query = first.Query()
+	query.Set("state", second.Query().Get("state"))
+	app.do(t, "GET", "/oidc/mock/callback?"+query.Encode(), "", nil).expect(t, http.StatusUnauthorized)
+
+	if _, err := app.Models.User.GetByEmail("rita@example.com"); err == nil {
+		t.Fatal("a forged callback created a user")
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"authentification/data"
+	"authentification/mailer"
+	"common/auth"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// passwordResetTTL is how long a password reset link stays valid.
+const passwordResetTTL = time.Hour
+
+// ForgotPassword emails a password reset link to the user. It answers the same whether or
+// not the email belongs to an account, so it can not be used to find out who is registered.
+func (app *Config) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("If the email belongs to an account, a password reset link has been sent to it"),
+	}
+
+	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	if err != nil {
+		app.writeJSON(w, http.StatusAccepted, payload)
+		return
+	}
+
+	token, _, err := app.Models.OneTimeToken.Insert(user.ID, data.PurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset_password?token=%s", app.FrontendURL, url.QueryEscape(token))
+	err = app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not ask to reset your password, you can ignore this email.\n",
+			user.FirstName, passwordResetTTL, link),
+	})
+	if err != nil {
+		log.Println("Error sending password reset email:", err)
+		app.errorJSON(w, errors.New("the email could not be sent, try again later"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ResetPassword sets a new password with a token from a password reset email, and signs the
+// user out of every session, revoking the access tokens already issued as well.
+func (app *Config) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Token                string `json:"token"`
+		Password             string `json:"password"`
+		PasswordConfirmation string `json:"password_confirmation"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.PasswordConfirmation != requestPayload.Password {
+		app.errorJSON(w, errors.New("password and password confirmation do not match"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := app.Models.OneTimeToken.Get(data.PurposePasswordReset, requestPayload.Token)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired password reset token"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(token.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	// the token is only used up by an acceptable password, so that the user can try again
+	err = app.PasswordPolicy.Validate(requestPayload.Password, user.Email)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.Models.OneTimeToken.Use(data.PurposePasswordReset, requestPayload.Token)
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired password reset token"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.User.ResetPassword(user, requestPayload.Password)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	// the reset link proved the user owns the address
+	if !user.Active {
+		err = app.Models.User.Activate(user)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = app.Models.RefreshToken.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.revokeAccessTokens(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Password has been reset"),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ChangePassword sets a new password for the signed in user, who confirms with their
+// current password. Every session is signed out and its access tokens revoked, and the
+// client gets new tokens.
+// Wrong current passwords count as failed sign in attempts, so that a stolen access token
+// can not be used to guess the password.
+func (app *Config) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+
+	var requestPayload struct {
+		CurrentPassword      string `json:"current_password"`
+		Password             string `json:"password"`
+		PasswordConfirmation string `json:"password_confirmation"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(principal.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	ip := app.clientIP(r)
+
+	block, err := app.checkLoginAllowed(user.Email, ip)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		app.writeLoginBlock(w, block)
+		return
+	}
+
+	valid, err := user.PasswordMatches(requestPayload.CurrentPassword)
+	if err != nil || !valid {
+		err = app.recordLoginFailure(user.Email, ip)
+		if err != nil {
+			log.Println("Error recording failed sign in:", err)
+		}
+		app.errorJSON(w, errors.New("current password is incorrect"), http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.PasswordConfirmation != requestPayload.Password {
+		app.errorJSON(w, errors.New("password and password confirmation do not match"), http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.Password == requestPayload.CurrentPassword {
+		app.errorJSON(w, errors.New("the new password should differ from the current one"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.PasswordPolicy.Validate(requestPayload.Password, user.Email)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.User.ResetPassword(user, requestPayload.Password)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.Models.RefreshToken.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = app.revokeAccessTokens(user.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := app.issueTokens(user, "")
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("Password has been changed, other sessions were signed out"),
+		Data:    tokens,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"common/auth"
+	"net/http"
+	"testing"
+)
+
+func TestForgotAndResetPassword(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	// unknown emails get the same answer
+	app.do(t, "POST", "/password/forgot", "", map[string]any{"email": "nobody@example.com"}).expect(t, http.StatusAccepted)
+	app.do(t, "POST", "/password/forgot", "", map[string]any{"email": "rita@example.com"}).expect(t, http.StatusAccepted)
+	token := app.mailer.lastToken(t, "rita@example.com")
+
+	newPassword := "another-Horse-staple"
+	reset := map[string]any{"token": token, "password": "short", "password_confirmation": "short"}
+	app.do(t, "POST", "/password/reset", "", reset).expect(t, http.StatusBadRequest)
+
+	reset["password"], reset["password_confirmation"] = newPassword, newPassword
+	app.do(t, "POST", "/password/reset", "", reset).expect(t, http.StatusAccepted)
+	app.do(t, "POST", "/password/reset", "", reset).expect(t, http.StatusBadRequest)
+
+	// every session was signed out, and the access tokens already issued were revoked
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": s.RefreshToken}).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/check_token", s.Token, nil).expect(t, http.StatusUnauthorized)
+
+	var revoked struct {
+		RevokedUsers []struct {
+			UserID int `json:"user_id"`
+		} `json:"revoked_users"`
+	}
+	app.do(t, "GET", "/revoked_tokens", "", nil).expect(t, http.StatusAccepted).decode(t, &revoked)
+	if len(revoked.RevokedUsers) != 1 || revoked.RevokedUsers[0].UserID != s.User.ID {
+		t.Fatalf("got revoked users %+v, want user %d", revoked.RevokedUsers, s.User.ID)
+	}
+
+	var again session
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": newPassword}).
+		expect(t, http.StatusAccepted).decode(t, &again)
+	app.do(t, "POST", "/check_token", again.Token, nil).expect(t, http.StatusAccepted)
+}
+
+func TestChangePassword(t *testing.T) {
+	app := newTestApp(t)
+	app.register(t, "rita@example.com", auth.RoleCustomer)
+	s := app.signIn(t, "rita@example.com")
+
+	newPassword := "another-Horse-staple"
+	change := map[string]any{"current_password": "wrong-Password-1", "password": newPassword, "password_confirmation": newPassword}
+	app.do(t, "PUT", "/users/me/password", s.Token, change).expect(t, http.StatusBadRequest)
+
+	change["current_password"] = testPassword
+	var changed session
+	app.do(t, "PUT", "/users/me/password", s.Token, change).expect(t, http.StatusAccepted).decode(t, &changed)
+
+	// the tokens issued before the change were revoked, not those it returned
+	app.do(t, "POST", "/check_token", s.Token, nil).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/refresh", "", map[string]any{"refresh_token": s.RefreshToken}).expect(t, http.StatusUnauthorized)
+	app.do(t, "POST", "/check_token", changed.Token, nil).expect(t, http.StatusAccepted)
+
+	app.do(t, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": newPassword}).
+		expect(t, http.StatusAccepted)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"common/auth"
+	"expvar"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"net/http"
+)
+
+// Routes returns the handler serving every endpoint of the service.
+func (app *Config) Routes() http.Handler {
+	mux := chi.NewRouter()
+
+	//specify who is allowed to connect
+	mux.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	mux.Use(middleware.Heartbeat("/ping"))
+	mux.Post("/authenticate", app.Authenticate)
+	mux.Post("/authenticate/mfa", app.AuthenticateMFA)
+	mux.Post("/register", app.Register)
+	mux.Get("/oidc/providers", app.ListOIDCProviders)
+	mux.Get("/oidc/{provider}/login", app.OIDCLogin)
+	mux.Get("/oidc/{provider}/callback", app.OIDCCallback)
+	mux.Post("/check_token", app.CheckToken)
+	mux.Post("/refresh", app.Refresh)
+	mux.Post("/logout", app.Logout)
+	mux.Post("/password/forgot", app.ForgotPassword)
+	mux.Post("/password/reset", app.ResetPassword)
+	mux.Get("/verify_email", app.VerifyEmail)
+	mux.Post("/verify_email/resend", app.ResendVerificationEmail)
+	mux.Get("/.well-known/jwks.json", app.JWKS)
+	mux.Get("/revoked_tokens", app.RevokedTokens)
+	mux.Put("/users/{id:[0-9]+}", app.Update)
+	mux.Get("/users/{id:[0-9]+}", app.GetUser)
+	mux.With(app.requirePermission(auth.PermReadUserNames)).Get("/users/names", app.GetUserNames)
+	mux.With(app.authenticated).Put("/users/me/password", app.ChangePassword)
+	mux.With(app.authenticated).Delete("/users/me", app.DeleteMe)
+	mux.With(app.authenticated).Get("/users/me/export", app.ExportMe)
+	mux.With(app.authenticated).Post("/mfa/enroll", app.EnrollMFA)
+	mux.With(app.authenticated).Post("/mfa/confirm", app.ConfirmMFA)
+	mux.With(app.authenticated).Post("/mfa/disable", app.DisableMFA)
+	mux.With(app.authenticated).Post("/mfa/recovery_codes", app.RegenerateRecoveryCodes)
+	mux.With(app.requirePermission(auth.PermListUsers)).Get("/admin/users", app.ListUsers)
+	mux.With(app.requirePermission(auth.PermManageUsers)).Delete("/admin/users/{id:[0-9]+}", app.DeleteUser)
+	mux.With(app.requirePermission(auth.PermManageUsers)).Put("/admin/users/{id:[0-9]+}/unlock", app.UnlockUser)
+	mux.With(app.requirePermission(auth.PermReadUsers)).Get("/admin/lockouts", app.ListLockouts)
+	mux.With(app.requirePermission(auth.PermReadMetrics)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+	return mux
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"authentification/data"
+	"authentification/mailer"
+	"authentification/passwords"
+	"bytes"
+	"common/carclient"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testPassword satisfies the default password policy.
+const testPassword = "correct-Horse-battery"
+
+// fakeMailer keeps the messages sent instead of sending them.
+type fakeMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *fakeMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([^\s&]+)`)
+
+// lastToken returns the token of the link in the last message sent to the address.
+func (m *fakeMailer) lastToken(t *testing.T, to string) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+
+		match := linkToken.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("no link in %q", m.messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Fatalf("no message sent to %s", to)
+	return ""
+}
+
+// fakeCarService stands in for the car service, recording the calls it receives.
+type fakeCarService struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls []string
+
+	// Conflict makes the car service refuse to erase the data of users.
+	Conflict bool
+}
+
+func newFakeCarService(t *testing.T) *fakeCarService {
+	t.Helper()
+
+	fake := &fakeCarService{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.calls = append(fake.calls, r.Method+" "+r.URL.Path)
+		conflict := fake.Conflict
+		fake.mu.Unlock()
+
+		if r.Method == http.MethodDelete && conflict {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error":true,"message":"finish or cancel the ongoing ride before deleting the account"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"error":false,"message":"User data","data":{"car_requests":[],"cars":[]}}`)
+	}))
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+// testApp is the service running on in-memory repositories.
+type testApp struct {
+	*Config
+	mailer  *fakeMailer
+	cars    *fakeCarService
+	handler http.Handler
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signing := &signingKey{ID: "test", Method: jwt.SigningMethodES256, Private: key, Public: &key.PublicKey}
+	signingKeys = &keySet{signing: signing, keys: map[string]*signingKey{signing.ID: signing}}
+
+	fakeMailer := &fakeMailer{}
+	fakeCars := newFakeCarService(t)
+
+	app := &Config{
+		Models:         data.NewMemory(),
+		Mailer:         fakeMailer,
+		FrontendURL:    "http://frontend.test",
+		PublicURL:      "http://auth.test",
+		PasswordPolicy: passwords.DefaultPolicy(),
+		Cars:           carclient.New(fakeCars.URL, time.Second),
+	}
+
+	return &testApp{Config: app, mailer: fakeMailer, cars: fakeCars, handler: app.Routes()}
+}
+
+// response is the envelope every handler answers with, with the data left to decode.
+type response struct {
+	Status  int
+	Header  http.Header
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do sends a request with the token, when not empty, and a JSON body, when not nil.
+func (a *testApp) do(t *testing.T, method, path, token string, body any) response {
+	t.Helper()
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		encoded, err = json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.handler.ServeHTTP(recorder, request)
+
+	var resp response
+	err := json.Unmarshal(recorder.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("%s %s answered %d with %q: %v", method, path, recorder.Code, recorder.Body.String(), err)
+	}
+	resp.Status = recorder.Code
+	resp.Header = recorder.Header()
+
+	return resp
+}
+
+// decode unmarshals the data of the response into v.
+func (r response) decode(t *testing.T, v any) {
+	t.Helper()
+
+	err := json.Unmarshal(r.Data, v)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", r.Data, err)
+	}
+}
+
+// expect fails the test when the response does not have the given status.
+func (r response) expect(t *testing.T, status int) response {
+	t.Helper()
+
+	if r.Status != status {
+		t.Fatalf("got status %d (%s), want %d", r.Status, r.Message, status)
+	}
+	return r
+}
+
+// session is what a client holds once signed in.
+type session struct {
+	User         data.User `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// register creates an account of the given type and verifies its email.
+func (a *testApp) register(t *testing.T, email, userType string) {
+	t.Helper()
+
+	a.do(t, "POST", "/register", "", map[string]any{
+		"first_name":            "Test",
+		"last_name":             "User",
+		"email":                 email,
+		"city":                  "Bucharest",
+		"type":                  userType,
+		"password":              testPassword,
+		"password_confirmation": testPassword,
+	}).expect(t, http.StatusAccepted)
+
+	a.do(t, "GET", "/verify_email?token="+url.QueryEscape(a.mailer.lastToken(t, email)), "", nil).
+		expect(t, http.StatusAccepted)
+}
+
+// signIn authenticates with the password of the account.
+func (a *testApp) signIn(t *testing.T, email string) session {
+	t.Helper()
+
+	var s session
+	a.do(t, "POST", "/authenticate", "", map[string]any{"email": email, "password": testPassword}).
+		expect(t, http.StatusAccepted).decode(t, &s)
+	if s.Token == "" {
+		t.Fatalf("signing in %s returned no token", email)
+	}
+
+	return s
+}
+
+// staff creates an active account with a role users can not pick themselves.
+func (a *testApp) staff(t *testing.T, email, userType string) session {
+	t.Helper()
+
+	_, err := a.Models.User.Insert(data.User{
+		Email:     email,
+		FirstName: "Staff",
+		LastName:  "Member",
+		Password:  testPassword,
+		Type:      userType,
+		Active:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.signIn(t, email)
+}
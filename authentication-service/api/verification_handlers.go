@@ -0,0 +1,125 @@
+package api
+
+import (
+	"authentification/data"
+	"authentification/mailer"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// emailVerificationTTL is how long an email verification link stays valid.
+	emailVerificationTTL = 48 * time.Hour
+
+	// verificationResendInterval is the minimum time between two verification emails.
+	verificationResendInterval = time.Minute
+
+	// maxVerificationEmailsPerDay caps the verification emails sent to one address.
+	maxVerificationEmailsPerDay = 5
+)
+
+// VerifyEmail activates the account a verification link was sent for.
+func (app *Config) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token, err := app.Models.OneTimeToken.Use(data.PurposeEmailVerification, r.URL.Query().Get("token"))
+	if err != nil {
+		app.errorJSON(w, errors.New("invalid or expired verification link"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := app.Models.User.GetOne(token.UserID)
+	if err != nil {
+		app.errorJSON(w, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	err = app.Models.User.Activate(user)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Email %s verified, you can now sign in", user.Email),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ResendVerificationEmail sends a new verification link to an account that is not verified
+// yet, at most once a minute and a few times a day. Requests over the limit get the same
+// answer as the others without an email being sent, so that the answer does not tell which
+// addresses belong to accounts waiting for verification.
+func (app *Config) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("If the email belongs to an account waiting for verification, a new link has been sent to it"),
+	}
+
+	user, err := app.Models.User.GetByEmail(requestPayload.Email)
+	if err != nil || user.Active {
+		app.writeJSON(w, http.StatusAccepted, payload)
+		return
+	}
+
+	now := time.Now()
+	issued, err := app.Models.OneTimeToken.CountIssuedSince(user.ID, data.PurposeEmailVerification, now.Add(-24*time.Hour))
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	var retryAfter time.Duration
+	switch {
+	case issued.Count >= maxVerificationEmailsPerDay:
+		// a new email may go once the oldest one of the day leaves the window
+		retryAfter = issued.Oldest.Add(24 * time.Hour).Sub(now)
+	case issued.Latest != nil && now.Sub(*issued.Latest) < verificationResendInterval:
+		retryAfter = issued.Latest.Add(verificationResendInterval).Sub(now)
+	}
+	if retryAfter > 0 {
+		log.Printf("Not resending the verification email of user %d for another %s", user.ID, retryAfter.Round(time.Second))
+		app.writeJSON(w, http.StatusAccepted, payload)
+		return
+	}
+
+	err = app.sendVerificationEmail(user)
+	if err != nil {
+		app.errorJSON(w, errors.New("the email could not be sent, try again later"), http.StatusInternalServerError)
+		return
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// sendVerificationEmail emails the user a link activating their account. Links sent before
+// stop working.
+func (app *Config) sendVerificationEmail(user *data.User) error {
+	token, _, err := app.Models.OneTimeToken.Insert(user.ID, data.PurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify_email?token=%s", app.PublicURL, url.QueryEscape(token))
+	return app.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to verify your email address and activate your account. "+
+			"It expires in %s.\n\n%s\n",
+			user.FirstName, emailVerificationTTL, link),
+	})
+}
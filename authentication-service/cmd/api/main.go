@@ -1,7 +1,14 @@
 package main
 
 import (
+	"authentification/api"
 	"authentification/data"
+	"authentification/mailer"
+	"authentification/migrations"
+	"authentification/passwords"
+	"common/carclient"
+	"common/migrate"
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/jackc/pgconn"
@@ -13,35 +20,74 @@ import (
 	"time"
 )
 
-const webPort = "80"
-
 var counts int64
 
-type Config struct {
-	DB     *sql.DB
-	Models data.Models
-}
-
 func main() {
 	log.Println("Starting authentication service")
 
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = api.LoadSigningKeys(settings.signingKeys())
+	if err != nil {
+		log.Panic(err)
+	}
+
+	passwordPolicy, err := passwords.NewPolicy(settings.PasswordMinLength, settings.PasswordMinClasses, settings.PasswordCommonList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	//connect to DB
-	conn := connectToDB()
+	conn := connectToDB(settings.DSN)
 	if conn == nil {
 		log.Panic("Can't connect to Postgres!")
 	}
+
+	migrator, err := migrate.New(conn, "authentication-service", migrations.FS)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = migrate.OnStart(context.Background(), migrator, settings.MigrateOnStart)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	//set up config
-	app := Config{
-		DB:     conn,
-		Models: data.New(conn),
+	app := api.Config{
+		DB:             conn,
+		Models:         data.New(conn),
+		Mailer:         mailer.New(settings.mailer()),
+		FrontendURL:    settings.FrontendURL,
+		PublicURL:      settings.PublicURL,
+		Cars:           carclient.New(settings.CarServiceURL, settings.UpstreamTimeout),
+		PasswordPolicy: passwordPolicy,
+		OIDCProviders:  settings.oidcProviders(),
+		TrustedProxies: settings.trustedProxies,
 	}
 
+	go app.PurgeExpiredTokens()
+
 	srv := http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
-		Handler: app.routes(),
+		Addr:         fmt.Sprintf(":%d", settings.Port),
+		Handler:      app.Routes(),
+		ReadTimeout:  settings.ReadTimeout,
+		WriteTimeout: settings.WriteTimeout,
 	}
 
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -61,9 +107,7 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-func connectToDB() *sql.DB {
-	dsn := os.Getenv("DSN")
-
+func connectToDB(dsn string) *sql.DB {
 	//infinite loop till we get the connection
 	for {
 		connetion, err := openDB(dsn)
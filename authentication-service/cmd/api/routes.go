@@ -1,30 +0,0 @@
-package main
-
-import (
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
-	"net/http"
-)
-
-func (app *Config) routes() http.Handler {
-	mux := chi.NewRouter()
-
-	//specify who is allowed to connect
-	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
-
-	mux.Use(middleware.Heartbeat("/ping"))
-	mux.Post("/authenticate", app.Authenticate)
-	mux.Post("/register", app.Register)
-	mux.Post("/check_token", app.CheckToken)
-	mux.Put("/users/{id:[0-9]+}", app.Update)
-	mux.Get("/users/{id:[0-9]+}", app.GetUser)
-	return mux
-}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"authentification/api"
+	"authentification/mailer"
+	"authentification/oidc"
+	"authentification/passwords"
+	"common/config"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// settings configure the authentication service. They are read from the YAML file named by
+// CONFIG_FILE, if any, and from the environment variables named by the env tags.
+type settings struct {
+	Port int    `yaml:"port" env:"PORT"`
+	DSN  string `yaml:"dsn" env:"DSN"`
+
+	// FrontendURL is where links sent by email point to, and PublicURL where this service
+	// is reachable from outside.
+	FrontendURL string `yaml:"frontend_url" env:"FRONTEND_URL"`
+	PublicURL   string `yaml:"public_url" env:"PUBLIC_URL"`
+
+	// CarServiceURL is where the ride data of users is exported and erased.
+	CarServiceURL string `yaml:"car_service_url" env:"CAR_SERVICE_URL"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+
+	// UpstreamTimeout bounds every attempt at a call to the car service.
+	UpstreamTimeout time.Duration `yaml:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+
+	// MigrateOnStart applies pending migrations at startup. Deployments applying them with
+	// the migrate subcommand turn it off, see migrate.OnStart.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+
+	// TrustedProxies is a comma separated list of the addresses and networks whose
+	// X-Forwarded-For header is believed, such as the broker's.
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	// The JWT settings say which keys sign and verify tokens, see api.SigningKeySettings.
+	JWTKeysDir      string `yaml:"jwt_keys_dir" env:"JWT_KEYS_DIR"`
+	JWTSigningKeyID string `yaml:"jwt_signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	JWTSecret       string `yaml:"jwt_secret" env:"JWT_SECRET"`
+	JWTDevMode      bool   `yaml:"jwt_dev_mode" env:"JWT_DEV_MODE"`
+
+	// The password settings make up the password policy, see passwords.NewPolicy.
+	PasswordMinLength  int    `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH"`
+	PasswordMinClasses int    `yaml:"password_min_classes" env:"PASSWORD_MIN_CLASSES"`
+	PasswordCommonList string `yaml:"password_common_list" env:"PASSWORD_COMMON_LIST"`
+
+	// The mail and SMTP settings say how emails are sent, see mailer.Config.
+	MailFrom     string `yaml:"mail_from" env:"MAIL_FROM"`
+	MailDir      string `yaml:"mail_dir" env:"MAIL_DIR"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+
+	// OIDCProviders is the comma separated list of the OpenID Connect providers users can
+	// sign in with. Each provider is configured under its name in the oidc section of the
+	// file, and by the OIDC_<NAME>_ variables of oidcSettings.
+	OIDCProviders string                  `yaml:"oidc_providers" env:"OIDC_PROVIDERS"`
+	OIDC          map[string]oidcSettings `yaml:"oidc"`
+
+	// trustedProxies are the parsed TrustedProxies.
+	trustedProxies []netip.Prefix
+}
+
+// oidcSettings configure an OpenID Connect provider.
+type oidcSettings struct {
+	Issuer       string `yaml:"issuer" env:"ISSUER"`
+	ClientID     string `yaml:"client_id" env:"CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" env:"CLIENT_SECRET"`
+
+	// Scopes are space separated, "openid email profile" by default.
+	Scopes string `yaml:"scopes" env:"SCOPES"`
+
+	// DiscoveryURL only needs to be set when the provider is reached at another address
+	// than the one browsers use, see oidc.Config.
+	DiscoveryURL string `yaml:"discovery_url" env:"DISCOVERY_URL"`
+}
+
+// loadSettings returns the settings, with the docker-compose ones as defaults.
+func loadSettings() (*settings, error) {
+	s := &settings{
+		Port:               80,
+		FrontendURL:        "http://localhost",
+		PublicURL:          "http://localhost:8081",
+		CarServiceURL:      "http://car-service",
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		UpstreamTimeout:    10 * time.Second,
+		MigrateOnStart:     true,
+		PasswordMinLength:  8,
+		PasswordMinClasses: 2,
+		MailFrom:           "no-reply@uber.local",
+		SMTPPort:           587,
+	}
+
+	err := config.Load(s)
+	if err != nil {
+		return nil, err
+	}
+	err = s.loadOIDC()
+	if err != nil {
+		return nil, err
+	}
+
+	var proxiesErr error
+	s.trustedProxies, proxiesErr = api.ParseTrustedProxies(s.TrustedProxies)
+	if proxiesErr != nil {
+		proxiesErr = fmt.Errorf("TRUSTED_PROXIES: %w", proxiesErr)
+	}
+
+	var keysErr error
+	if s.JWTKeysDir == "" && s.JWTSecret == "" && !s.JWTDevMode {
+		keysErr = errors.New("JWT_KEYS_DIR or JWT_SECRET is required, unless JWT_DEV_MODE is true")
+	}
+
+	err = errors.Join(
+		config.Port("PORT", s.Port),
+		config.Required("DSN", s.DSN),
+		config.URL("FRONTEND_URL", s.FrontendURL),
+		config.URL("PUBLIC_URL", s.PublicURL),
+		config.URL("CAR_SERVICE_URL", s.CarServiceURL),
+		config.Positive("READ_TIMEOUT", s.ReadTimeout),
+		config.Positive("WRITE_TIMEOUT", s.WriteTimeout),
+		config.Positive("UPSTREAM_TIMEOUT", s.UpstreamTimeout),
+		proxiesErr,
+		keysErr,
+		config.Between("PASSWORD_MIN_LENGTH", s.PasswordMinLength, 1, passwords.MaxLength),
+		config.Between("PASSWORD_MIN_CLASSES", s.PasswordMinClasses, 1, 4),
+		config.Required("MAIL_FROM", s.MailFrom),
+		config.Port("SMTP_PORT", s.SMTPPort),
+		s.validateOIDC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings:\n%w", err)
+	}
+
+	s.FrontendURL = strings.TrimSuffix(s.FrontendURL, "/")
+	s.PublicURL = strings.TrimSuffix(s.PublicURL, "/")
+	s.CarServiceURL = strings.TrimSuffix(s.CarServiceURL, "/")
+
+	return s, nil
+}
+
+// oidcProviderNames returns the lowercase names of the providers in OIDCProviders.
+func (s *settings) oidcProviderNames() []string {
+	var names []string
+	for _, name := range strings.Split(s.OIDCProviders, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// oidcPrefix is the prefix of the environment variables of a provider.
+func oidcPrefix(name string) string {
+	return "OIDC_" + strings.ToUpper(name) + "_"
+}
+
+// loadOIDC overrides the settings of the providers from the file with their environment
+// variables.
+func (s *settings) loadOIDC() error {
+	if s.OIDC == nil {
+		s.OIDC = make(map[string]oidcSettings)
+	}
+
+	for _, name := range s.oidcProviderNames() {
+		provider := s.OIDC[name]
+		err := config.LoadEnv(&provider, oidcPrefix(name))
+		if err != nil {
+			return err
+		}
+		s.OIDC[name] = provider
+	}
+
+	return nil
+}
+
+// validateOIDC checks that every provider has an issuer and a client id.
+func (s *settings) validateOIDC() error {
+	var errs []error
+	for _, name := range s.oidcProviderNames() {
+		provider, prefix := s.OIDC[name], oidcPrefix(name)
+
+		errs = append(errs,
+			config.URL(prefix+"ISSUER", provider.Issuer),
+			config.Required(prefix+"CLIENT_ID", provider.ClientID),
+		)
+		if provider.DiscoveryURL != "" {
+			errs = append(errs, config.URL(prefix+"DISCOVERY_URL", provider.DiscoveryURL))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// signingKeys returns the JWT settings.
+func (s *settings) signingKeys() api.SigningKeySettings {
+	return api.SigningKeySettings{
+		Dir:          s.JWTKeysDir,
+		SigningKeyID: s.JWTSigningKeyID,
+		Secret:       s.JWTSecret,
+		DevMode:      s.JWTDevMode,
+	}
+}
+
+// mailer returns the mail and SMTP settings.
+func (s *settings) mailer() mailer.Config {
+	return mailer.Config{
+		From:         s.MailFrom,
+		SMTPHost:     s.SMTPHost,
+		SMTPPort:     s.SMTPPort,
+		SMTPUsername: s.SMTPUsername,
+		SMTPPassword: s.SMTPPassword,
+		Dir:          s.MailDir,
+	}
+}
+
+// oidcProviders returns the providers users can sign in with, by name. Their callbacks are
+// served under PublicURL/oidc/<name>/callback.
+func (s *settings) oidcProviders() map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider)
+
+	for _, name := range s.oidcProviderNames() {
+		provider := s.OIDC[name]
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			Scopes:       strings.Fields(provider.Scopes),
+			RedirectURL:  fmt.Sprintf("%s/oidc/%s/callback", s.PublicURL, name),
+			DiscoveryURL: provider.DiscoveryURL,
+		})
+	}
+
+	return providers
+}
@@ -0,0 +1,55 @@
+// Command mockoidc serves the mock OpenID Connect provider of package mockoidc, for trying
+// out sign in with external providers locally. It signs in anybody as whatever email
+// address they type, so it must never be used in production.
+//
+// It is configured with:
+//
+//   - MOCK_OIDC_ISSUER, the address browsers reach it at (default http://localhost:8084).
+//   - MOCK_OIDC_INTERNAL_URL, the address services reach it at, used for the token and
+//     keys endpoints (default the issuer).
+//   - MOCK_OIDC_CLIENT_ID and MOCK_OIDC_CLIENT_SECRET, the only client it accepts
+//     (default uber-app and mock-secret).
+package main
+
+import (
+	"authentification/oidc/mockoidc"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+const webPort = "80"
+
+func main() {
+	issuer := getenv("MOCK_OIDC_ISSUER", "http://localhost:8084")
+
+	provider, err := mockoidc.New(
+		issuer,
+		getenv("MOCK_OIDC_INTERNAL_URL", issuer),
+		getenv("MOCK_OIDC_CLIENT_ID", "uber-app"),
+		getenv("MOCK_OIDC_CLIENT_SECRET", "mock-secret"),
+	)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	log.Printf("Starting mock OIDC provider %s\n", provider.Issuer)
+
+	srv := http.Server{
+		Addr:    fmt.Sprintf(":%s", webPort),
+		Handler: provider,
+	}
+
+	err = srv.ListenAndServe()
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,212 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Identity links a user to their account at an external OpenID Connect provider.
+type Identity struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"subject"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCState is a sign in with an external provider in progress. It keeps the PKCE code
+// verifier and the nonce between the redirect to the provider and the callback, under the
+// hash of the state parameter.
+type OIDCState struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+type postgresIdentities struct {
+	db *sql.DB
+}
+
+type postgresOIDCStates struct {
+	db *sql.DB
+}
+
+// GetBySubject returns the identity of the provider account.
+func (r *postgresIdentities) GetBySubject(provider, subject string) (*Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, provider, subject, email, created_at, last_login_at
+		from user_identities where provider = $1 and subject = $2`
+
+	var identity Identity
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// GetAllForUser returns the provider accounts linked to the user.
+func (r *postgresIdentities) GetAllForUser(userID int) ([]*Identity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, provider, subject, email, created_at, last_login_at
+		from user_identities where user_id = $1 order by created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*Identity
+
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+			&identity.LastLoginAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	return identities, nil
+}
+
+// Insert links the provider account to the user and returns the id of the identity.
+func (r *postgresIdentities) Insert(identity Identity) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `insert into user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		values ($1, $2, $3, $4, $5, $5) returning id`
+
+	var id int
+	err := r.db.QueryRowContext(ctx, stmt,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		now,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Touch records a sign in with the identity, and the email the provider now reports.
+func (r *postgresIdentities) Touch(identity *Identity, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update user_identities set email = $1, last_login_at = $2 where id = $3`
+
+	_, err := r.db.ExecContext(ctx, stmt, email, now, identity.ID)
+	if err != nil {
+		return err
+	}
+
+	identity.Email = email
+	identity.LastLoginAt = now
+	return nil
+}
+
+// DeleteForUser unlinks every provider account of the user.
+func (r *postgresIdentities) DeleteForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from user_identities where user_id = $1`, userID)
+	return err
+}
+
+// Insert stores a sign in in progress and returns the plain text state parameter, which is
+// never stored.
+func (r *postgresOIDCStates) Insert(state OIDCState, ttl time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	stmt := `insert into oidc_states (state_hash, provider, code_verifier, nonce, expires_at, created_at)
+		values ($1, $2, $3, $4, $5, $6)`
+
+	_, err = r.db.ExecContext(ctx, stmt,
+		HashToken(plainText),
+		state.Provider,
+		state.CodeVerifier,
+		state.Nonce,
+		now.Add(ttl),
+		now,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return plainText, nil
+}
+
+// Use consumes the sign in in progress of the state parameter. It fails with
+// sql.ErrNoRows when the state is unknown, expired, already used or belongs to another
+// provider.
+func (r *postgresOIDCStates) Use(provider, plainText string) (*OIDCState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from oidc_states where state_hash = $1 and provider = $2 and expires_at > $3
+		returning provider, code_verifier, nonce, expires_at`
+
+	var state OIDCState
+	err := r.db.QueryRowContext(ctx, stmt, HashToken(plainText), provider, time.Now()).Scan(
+		&state.Provider,
+		&state.CodeVerifier,
+		&state.Nonce,
+		&state.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// DeleteExpired removes sign ins that were never completed.
+func (r *postgresOIDCStates) DeleteExpired(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from oidc_states where expires_at < $1`, now)
+	return err
+}
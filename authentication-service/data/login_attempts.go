@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginAttempt is one sign in attempt, kept to detect password guessing.
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	Succeeded bool      `json:"succeeded"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Failures summarises the failed sign in attempts of an account or an IP address.
+type Failures struct {
+	Count  int
+	Latest *time.Time
+}
+
+// Lockout is the audit record of an account or an IP address being blocked from signing in
+// after too many failed attempts. Exactly one of Email and IP is set.
+type Lockout struct {
+	ID             int        `json:"id"`
+	Email          *string    `json:"email,omitempty"`
+	IP             *string    `json:"ip,omitempty"`
+	FailedAttempts int        `json:"failed_attempts"`
+	LockedUntil    time.Time  `json:"locked_until"`
+	UnlockedAt     *time.Time `json:"unlocked_at,omitempty"`
+	UnlockedBy     *int       `json:"unlocked_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type postgresLoginAttempts struct {
+	db *sql.DB
+}
+
+type postgresLockouts struct {
+	db *sql.DB
+}
+
+// Record stores a sign in attempt.
+func (r *postgresLoginAttempts) Record(email, ip string, succeeded bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into login_attempts (email, ip, succeeded, created_at) values ($1, $2, $3, $4)`
+
+	_, err := r.db.ExecContext(ctx, stmt, email, ip, succeeded, time.Now())
+	return err
+}
+
+// AccountFailures returns the failed attempts on the account since the given time. Failures
+// before the last successful sign in or the last unlock by an admin do not count.
+func (r *postgresLoginAttempts) AccountFailures(email string, since time.Time) (Failures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select count(*), max(created_at) from login_attempts
+		where email = $1 and not succeeded and created_at >= $2
+		and created_at > coalesce((select max(created_at) from login_attempts where email = $1 and succeeded), '-infinity')
+		and created_at > coalesce((select max(unlocked_at) from account_lockouts where email = $1), '-infinity')`
+
+	var failures Failures
+	err := r.db.QueryRowContext(ctx, query, email, since).Scan(&failures.Count, &failures.Latest)
+	return failures, err
+}
+
+// IPFailures returns the failed attempts from the IP address since the given time, on any
+// account. Successful sign ins do not reset them, as an attacker could sign in to an
+// account of their own in between guesses.
+func (r *postgresLoginAttempts) IPFailures(ip string, since time.Time) (Failures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select count(*), max(created_at) from login_attempts
+		where ip = $1 and not succeeded and created_at >= $2
+		and created_at > coalesce((select max(unlocked_at) from account_lockouts where ip = $1), '-infinity')`
+
+	var failures Failures
+	err := r.db.QueryRowContext(ctx, query, ip, since).Scan(&failures.Count, &failures.Latest)
+	return failures, err
+}
+
+// DeleteBefore removes attempts older than the given time.
+func (r *postgresLoginAttempts) DeleteBefore(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from login_attempts where created_at < $1`, before)
+	return err
+}
+
+// GetByEmail returns the attempts on the account, newest first.
+func (r *postgresLoginAttempts) GetByEmail(email string) ([]*LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, ip, succeeded, created_at from login_attempts
+		where email = $1 order by created_at desc`
+
+	rows, err := r.db.QueryContext(ctx, query, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*LoginAttempt
+
+	for rows.Next() {
+		var attempt LoginAttempt
+		err := rows.Scan(&attempt.ID, &attempt.Email, &attempt.IP, &attempt.Succeeded, &attempt.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, nil
+}
+
+// DeleteByEmail removes every attempt on the account.
+func (r *postgresLoginAttempts) DeleteByEmail(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from login_attempts where email = $1`, email)
+	return err
+}
+
+// Insert stores a lockout and returns its id.
+func (r *postgresLockouts) Insert(lockout Lockout) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into account_lockouts (email, ip, failed_attempts, locked_until, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	var id int
+	err := r.db.QueryRowContext(ctx, stmt,
+		lockout.Email,
+		lockout.IP,
+		lockout.FailedAttempts,
+		lockout.LockedUntil,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetActive returns the lockout currently blocking the account or the IP address, the one
+// lasting longest when there are several.
+func (r *postgresLockouts) GetActive(email, ip string) (*Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, ip, failed_attempts, locked_until, unlocked_at, unlocked_by, created_at
+		from account_lockouts
+		where (email = $1 or ip = $2) and locked_until > $3 and unlocked_at is null
+		order by locked_until desc limit 1`
+
+	var lockout Lockout
+	err := r.db.QueryRowContext(ctx, query, email, ip, time.Now()).Scan(
+		&lockout.ID,
+		&lockout.Email,
+		&lockout.IP,
+		&lockout.FailedAttempts,
+		&lockout.LockedUntil,
+		&lockout.UnlockedAt,
+		&lockout.UnlockedBy,
+		&lockout.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lockout, nil
+}
+
+// GetAll returns the most recent lockouts, newest first.
+func (r *postgresLockouts) GetAll(limit int) ([]*Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, email, ip, failed_attempts, locked_until, unlocked_at, unlocked_by, created_at
+		from account_lockouts order by created_at desc limit $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []*Lockout
+
+	for rows.Next() {
+		var lockout Lockout
+		err := rows.Scan(
+			&lockout.ID,
+			&lockout.Email,
+			&lockout.IP,
+			&lockout.FailedAttempts,
+			&lockout.LockedUntil,
+			&lockout.UnlockedAt,
+			&lockout.UnlockedBy,
+			&lockout.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lockouts = append(lockouts, &lockout)
+	}
+
+	return lockouts, nil
+}
+
+// UnlockAccount lifts the lockouts of the account on behalf of an admin, and resets its
+// failed attempts. It reports whether there was a lockout to lift.
+func (r *postgresLockouts) UnlockAccount(email string, adminID int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	// the unlock time is recorded even when the account is not locked, so that the failed
+	// attempts counted towards the next lockout start over
+	stmt := `update account_lockouts set unlocked_at = $1, unlocked_by = $2
+		where email = $3 and unlocked_at is null`
+
+	result, err := r.db.ExecContext(ctx, stmt, now, adminID, email)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected > 0 {
+		return true, nil
+	}
+
+	stmt = `insert into account_lockouts (email, failed_attempts, locked_until, unlocked_at, unlocked_by, created_at)
+		values ($1, 0, $2, $2, $3, $2)`
+
+	_, err = r.db.ExecContext(ctx, stmt, email, now, adminID)
+	return false, err
+}
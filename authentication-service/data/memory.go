@@ -0,0 +1,207 @@
+package data
+
+import (
+	"database/sql"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewMemory returns repositories keeping their data in memory, for tests exercising the
+// service without a database. They behave like the Postgres ones, down to failing with
+// sql.ErrNoRows, except that passwords are hashed with the lowest bcrypt cost.
+func NewMemory() Models {
+	s := &memoryStore{
+		users:         make(map[int]*User),
+		refreshTokens: make(map[int]*RefreshToken),
+		revokedTokens: make(map[string]*RevokedToken),
+		tokenCutoffs:  make(map[int]*TokenCutoff),
+		oneTimeTokens: make(map[int]*OneTimeToken),
+		lockouts:      make(map[int]*Lockout),
+		mfa:           make(map[int]*MFA),
+		recoveryCodes: make(map[int]*RecoveryCode),
+		identities:    make(map[int]*Identity),
+		oidcStates:    make(map[string]*OIDCState),
+	}
+
+	return Models{
+		User:         &memoryUsers{s},
+		RefreshToken: &memoryRefreshTokens{s},
+		RevokedToken: &memoryRevokedTokens{s},
+		OneTimeToken: &memoryOneTimeTokens{s},
+		LoginAttempt: &memoryLoginAttempts{s},
+		Lockout:      &memoryLockouts{s},
+		MFA:          &memoryMFA{s},
+		RecoveryCode: &memoryRecoveryCodes{s},
+		Identity:     &memoryIdentities{s},
+		OIDCState:    &memoryOIDCStates{s},
+	}
+}
+
+// memoryStore holds the rows of every in-memory repository, which need each other's rows
+// the way the Postgres queries join tables. Rows are copied in and out, so that callers
+// only change them through the repositories.
+type memoryStore struct {
+	mu sync.Mutex
+
+	users         map[int]*User
+	refreshTokens map[int]*RefreshToken
+	revokedTokens map[string]*RevokedToken
+	tokenCutoffs  map[int]*TokenCutoff
+	oneTimeTokens map[int]*OneTimeToken
+	loginAttempts []*LoginAttempt
+	lockouts      map[int]*Lockout
+	mfa           map[int]*MFA
+	recoveryCodes map[int]*RecoveryCode
+	identities    map[int]*Identity
+	oidcStates    map[string]*OIDCState
+
+	lastID int
+}
+
+// nextID returns a new id, unique across the tables, which is enough for tests.
+func (s *memoryStore) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+type memoryUsers struct {
+	s *memoryStore
+}
+
+func (r *memoryUsers) GetAll() ([]*User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var users []*User
+	for _, user := range r.s.users {
+		u := *user
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+func (r *memoryUsers) GetByEmail(email string) (*User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Email == email {
+			u := *user
+			return &u, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryUsers) GetOne(id int) (*User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	u := *user
+	return &u, nil
+}
+
+func (r *memoryUsers) GetNames(ids []int) ([]*UserName, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var names []*UserName
+	for _, id := range ids {
+		if user, ok := r.s.users[id]; ok {
+			names = append(names, &UserName{ID: id, Name: user.FirstName + " " + user.LastName})
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return names[i].ID < names[j].ID })
+	return names, nil
+}
+
+func (r *memoryUsers) Insert(user User) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	user.ID = r.s.nextID()
+	user.Password = string(hashedPassword)
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.s.users[user.ID] = &user
+
+	return user.ID, nil
+}
+
+func (r *memoryUsers) Update(user *User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.users[user.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.Email = user.Email
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.City = user.City
+	stored.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (r *memoryUsers) Activate(user *User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if stored, ok := r.s.users[user.ID]; ok {
+		stored.Active = true
+		stored.UpdatedAt = time.Now()
+	}
+
+	user.Active = true
+	return nil
+}
+
+func (r *memoryUsers) ResetPassword(user *User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if stored, ok := r.s.users[user.ID]; ok {
+		stored.Password = string(hashedPassword)
+	}
+
+	return nil
+}
+
+func (r *memoryUsers) DeleteByID(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.users, id)
+	return nil
+}
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+type memoryIdentities struct {
+	s *memoryStore
+}
+
+type memoryOIDCStates struct {
+	s *memoryStore
+}
+
+func (r *memoryIdentities) GetBySubject(provider, subject string) (*Identity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, identity := range r.s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			i := *identity
+			return &i, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryIdentities) GetAllForUser(userID int) ([]*Identity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var identities []*Identity
+	for _, identity := range r.s.identities {
+		if identity.UserID == userID {
+			i := *identity
+			identities = append(identities, &i)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+func (r *memoryIdentities) Insert(identity Identity) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// user_identities has a unique index on the provider account
+	for _, existing := range r.s.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return 0, errors.New(`duplicate key value violates unique constraint "user_identities_provider_subject_idx"`)
+		}
+	}
+
+	now := time.Now()
+	identity.ID = r.s.nextID()
+	identity.CreatedAt = now
+	identity.LastLoginAt = now
+	r.s.identities[identity.ID] = &identity
+
+	return identity.ID, nil
+}
+
+func (r *memoryIdentities) Touch(identity *Identity, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	if stored, ok := r.s.identities[identity.ID]; ok {
+		stored.Email = email
+		stored.LastLoginAt = now
+	}
+
+	identity.Email = email
+	identity.LastLoginAt = now
+	return nil
+}
+
+func (r *memoryIdentities) DeleteForUser(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, identity := range r.s.identities {
+		if identity.UserID == userID {
+			delete(r.s.identities, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryOIDCStates) Insert(state OIDCState, ttl time.Duration) (string, error) {
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	state.ExpiresAt = time.Now().Add(ttl)
+	r.s.oidcStates[HashToken(plainText)] = &state
+
+	return plainText, nil
+}
+
+func (r *memoryOIDCStates) Use(provider, plainText string) (*OIDCState, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	hash := HashToken(plainText)
+	state, ok := r.s.oidcStates[hash]
+	if !ok || state.Provider != provider || !state.ExpiresAt.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	delete(r.s.oidcStates, hash)
+	return state, nil
+}
+
+func (r *memoryOIDCStates) DeleteExpired(now time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for hash, state := range r.s.oidcStates {
+		if state.ExpiresAt.Before(now) {
+			delete(r.s.oidcStates, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+type memoryLoginAttempts struct {
+	s *memoryStore
+}
+
+type memoryLockouts struct {
+	s *memoryStore
+}
+
+func (r *memoryLoginAttempts) Record(email, ip string, succeeded bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.loginAttempts = append(r.s.loginAttempts, &LoginAttempt{
+		ID:        r.s.nextID(),
+		Email:     email,
+		IP:        ip,
+		Succeeded: succeeded,
+		CreatedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (r *memoryLoginAttempts) AccountFailures(email string, since time.Time) (Failures, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	after := r.s.lastUnlock(func(lockout *Lockout) bool { return lockout.Email != nil && *lockout.Email == email })
+	for _, attempt := range r.s.loginAttempts {
+		if attempt.Email == email && attempt.Succeeded && attempt.CreatedAt.After(after) {
+			after = attempt.CreatedAt
+		}
+	}
+
+	return r.s.failures(func(attempt *LoginAttempt) bool {
+		return attempt.Email == email && !attempt.CreatedAt.Before(since) && attempt.CreatedAt.After(after)
+	}), nil
+}
+
+func (r *memoryLoginAttempts) IPFailures(ip string, since time.Time) (Failures, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	after := r.s.lastUnlock(func(lockout *Lockout) bool { return lockout.IP != nil && *lockout.IP == ip })
+
+	return r.s.failures(func(attempt *LoginAttempt) bool {
+		return attempt.IP == ip && !attempt.CreatedAt.Before(since) && attempt.CreatedAt.After(after)
+	}), nil
+}
+
+// lastUnlock returns when a lockout matching keep was last lifted, or the zero time.
+func (s *memoryStore) lastUnlock(keep func(lockout *Lockout) bool) time.Time {
+	var last time.Time
+	for _, lockout := range s.lockouts {
+		if lockout.UnlockedAt != nil && keep(lockout) && lockout.UnlockedAt.After(last) {
+			last = *lockout.UnlockedAt
+		}
+	}
+
+	return last
+}
+
+// failures counts the failed attempts matching keep.
+func (s *memoryStore) failures(keep func(attempt *LoginAttempt) bool) Failures {
+	var failures Failures
+	for _, attempt := range s.loginAttempts {
+		if attempt.Succeeded || !keep(attempt) {
+			continue
+		}
+
+		failures.Count++
+		if failures.Latest == nil || attempt.CreatedAt.After(*failures.Latest) {
+			latest := attempt.CreatedAt
+			failures.Latest = &latest
+		}
+	}
+
+	return failures
+}
+
+func (r *memoryLoginAttempts) GetByEmail(email string) ([]*LoginAttempt, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var attempts []*LoginAttempt
+	for i := len(r.s.loginAttempts) - 1; i >= 0; i-- {
+		if r.s.loginAttempts[i].Email == email {
+			attempt := *r.s.loginAttempts[i]
+			attempts = append(attempts, &attempt)
+		}
+	}
+
+	return attempts, nil
+}
+
+func (r *memoryLoginAttempts) DeleteBefore(before time.Time) error {
+	return r.deleteWhere(func(attempt *LoginAttempt) bool { return attempt.CreatedAt.Before(before) })
+}
+
+func (r *memoryLoginAttempts) DeleteByEmail(email string) error {
+	return r.deleteWhere(func(attempt *LoginAttempt) bool { return attempt.Email == email })
+}
+
+// deleteWhere removes the attempts matching drop.
+func (r *memoryLoginAttempts) deleteWhere(drop func(attempt *LoginAttempt) bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	kept := r.s.loginAttempts[:0]
+	for _, attempt := range r.s.loginAttempts {
+		if !drop(attempt) {
+			kept = append(kept, attempt)
+		}
+	}
+	r.s.loginAttempts = kept
+
+	return nil
+}
+
+func (r *memoryLockouts) Insert(lockout Lockout) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	lockout.ID = r.s.nextID()
+	lockout.UnlockedAt = nil
+	lockout.UnlockedBy = nil
+	lockout.CreatedAt = time.Now()
+	r.s.lockouts[lockout.ID] = &lockout
+
+	return lockout.ID, nil
+}
+
+func (r *memoryLockouts) GetActive(email, ip string) (*Lockout, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	var active *Lockout
+	for _, lockout := range r.s.lockouts {
+		matches := (lockout.Email != nil && *lockout.Email == email) || (lockout.IP != nil && *lockout.IP == ip)
+		if !matches || lockout.UnlockedAt != nil || !lockout.LockedUntil.After(now) {
+			continue
+		}
+		if active == nil || lockout.LockedUntil.After(active.LockedUntil) {
+			active = lockout
+		}
+	}
+
+	if active == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	l := *active
+	return &l, nil
+}
+
+func (r *memoryLockouts) GetAll(limit int) ([]*Lockout, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var lockouts []*Lockout
+	for _, lockout := range r.s.lockouts {
+		l := *lockout
+		lockouts = append(lockouts, &l)
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].ID > lockouts[j].ID })
+	if len(lockouts) > limit {
+		lockouts = lockouts[:limit]
+	}
+
+	return lockouts, nil
+}
+
+func (r *memoryLockouts) UnlockAccount(email string, adminID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	unlocked := false
+	for _, lockout := range r.s.lockouts {
+		if lockout.Email != nil && *lockout.Email == email && lockout.UnlockedAt == nil {
+			unlockedAt, unlockedBy := now, adminID
+			lockout.UnlockedAt = &unlockedAt
+			lockout.UnlockedBy = &unlockedBy
+			unlocked = true
+		}
+	}
+	if unlocked {
+		return true, nil
+	}
+
+	// the unlock time is recorded even when the account is not locked, so that the failed
+	// attempts counted towards the next lockout start over
+	lockedEmail, unlockedBy := email, adminID
+	id := r.s.nextID()
+	r.s.lockouts[id] = &Lockout{
+		ID:          id,
+		Email:       &lockedEmail,
+		LockedUntil: now,
+		UnlockedAt:  &now,
+		UnlockedBy:  &unlockedBy,
+		CreatedAt:   now,
+	}
+
+	return false, nil
+}
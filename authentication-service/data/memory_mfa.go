@@ -0,0 +1,168 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+type memoryMFA struct {
+	s *memoryStore
+}
+
+type memoryRecoveryCodes struct {
+	s *memoryStore
+}
+
+func (r *memoryMFA) GetByUser(userID int) (*MFA, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	mfa, ok := r.s.mfa[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	m := *mfa
+	return &m, nil
+}
+
+func (r *memoryMFA) IsEnabled(userID int) (bool, error) {
+	mfa, err := r.GetByUser(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return mfa.ConfirmedAt != nil, nil
+}
+
+func (r *memoryMFA) Enroll(userID int, secret string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	mfa, ok := r.s.mfa[userID]
+	if !ok {
+		r.s.mfa[userID] = &MFA{UserID: userID, Secret: secret, CreatedAt: now, UpdatedAt: now}
+		return nil
+	}
+	if mfa.ConfirmedAt != nil {
+		return errMFAEnabled
+	}
+
+	mfa.Secret = secret
+	mfa.LastUsedStep = 0
+	mfa.UpdatedAt = now
+
+	return nil
+}
+
+func (r *memoryMFA) Confirm(mfa *MFA) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	if stored, ok := r.s.mfa[mfa.UserID]; ok {
+		confirmedAt := now
+		stored.ConfirmedAt = &confirmedAt
+		stored.UpdatedAt = now
+	}
+
+	mfa.ConfirmedAt = &now
+	return nil
+}
+
+func (r *memoryMFA) UseStep(mfa *MFA, step int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.mfa[mfa.UserID]
+	if !ok || stored.LastUsedStep >= step {
+		return false, nil
+	}
+
+	stored.LastUsedStep = step
+	stored.UpdatedAt = time.Now()
+	mfa.LastUsedStep = step
+
+	return true, nil
+}
+
+func (r *memoryMFA) Disable(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, code := range r.s.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.s.recoveryCodes, id)
+		}
+	}
+	delete(r.s.mfa, userID)
+
+	return nil
+}
+
+func (r *memoryRecoveryCodes) Replace(userID int, codes []string) error {
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), recoveryCodeCost)
+		if err != nil {
+			return err
+		}
+		hashes[i] = hash
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, code := range r.s.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.s.recoveryCodes, id)
+		}
+	}
+
+	now := time.Now()
+	for _, hash := range hashes {
+		id := r.s.nextID()
+		r.s.recoveryCodes[id] = &RecoveryCode{ID: id, UserID: userID, CodeHash: string(hash), CreatedAt: now}
+	}
+
+	return nil
+}
+
+func (r *memoryRecoveryCodes) Use(userID int, code string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, stored := range r.s.recoveryCodes {
+		if stored.UserID != userID || stored.UsedAt != nil {
+			continue
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(stored.CodeHash), []byte(code)) == nil {
+			now := time.Now()
+			stored.UsedAt = &now
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *memoryRecoveryCodes) CountUnused(userID int) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for _, code := range r.s.recoveryCodes {
+		if code.UserID == userID && code.UsedAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
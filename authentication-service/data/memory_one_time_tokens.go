@@ -0,0 +1,134 @@
+package data
+
+import (
+	"database/sql"
+	"time"
+)
+
+type memoryOneTimeTokens struct {
+	s *memoryStore
+}
+
+func (r *memoryOneTimeTokens) Insert(userID int, purpose string, ttl time.Duration) (string, *OneTimeToken, error) {
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.s.oneTimeTokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			usedAt := now
+			token.UsedAt = &usedAt
+		}
+	}
+
+	token := OneTimeToken{
+		ID:        r.s.nextID(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(plainText),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	stored := token
+	r.s.oneTimeTokens[token.ID] = &stored
+
+	return plainText, &token, nil
+}
+
+func (r *memoryOneTimeTokens) Get(purpose, plainText string) (*OneTimeToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token := r.usable(purpose, plainText)
+	if token == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	t := *token
+	return &t, nil
+}
+
+func (r *memoryOneTimeTokens) Use(purpose, plainText string) (*OneTimeToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token := r.usable(purpose, plainText)
+	if token == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	now := time.Now()
+	token.UsedAt = &now
+
+	t := *token
+	return &t, nil
+}
+
+// usable returns the stored token matching the plain text token when it was issued for
+// purpose, is unused and has not expired.
+func (r *memoryOneTimeTokens) usable(purpose, plainText string) *OneTimeToken {
+	hash := HashToken(plainText)
+	now := time.Now()
+
+	for _, token := range r.s.oneTimeTokens {
+		if token.TokenHash == hash && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return token
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryOneTimeTokens) CountIssuedSince(userID int, purpose string, since time.Time) (IssuedTokens, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var issued IssuedTokens
+	for _, token := range r.s.oneTimeTokens {
+		if token.UserID != userID || token.Purpose != purpose || token.CreatedAt.Before(since) {
+			continue
+		}
+
+		issued.Count++
+		createdAt := token.CreatedAt
+		if issued.Oldest == nil || createdAt.Before(*issued.Oldest) {
+			issued.Oldest = &createdAt
+		}
+		if issued.Latest == nil || createdAt.After(*issued.Latest) {
+			issued.Latest = &createdAt
+		}
+	}
+
+	return issued, nil
+}
+
+func (r *memoryOneTimeTokens) DeleteExpired(before time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.oneTimeTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.s.oneTimeTokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryOneTimeTokens) DeleteForUser(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.oneTimeTokens {
+		if token.UserID == userID {
+			delete(r.s.oneTimeTokens, id)
+		}
+	}
+
+	return nil
+}
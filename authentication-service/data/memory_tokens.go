@@ -0,0 +1,253 @@
+package data
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+type memoryRefreshTokens struct {
+	s *memoryStore
+}
+
+type memoryRevokedTokens struct {
+	s *memoryStore
+}
+
+func (r *memoryRefreshTokens) Insert(userID int, familyID string, ttl time.Duration) (string, *RefreshToken, error) {
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = NewOpaqueToken()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token := RefreshToken{
+		ID:        r.s.nextID(),
+		UserID:    userID,
+		TokenHash: HashToken(plainText),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+	stored := token
+	r.s.refreshTokens[token.ID] = &stored
+
+	return plainText, &token, nil
+}
+
+func (r *memoryRefreshTokens) GetByToken(plainText string) (*RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	hash := HashToken(plainText)
+	for _, token := range r.s.refreshTokens {
+		if token.TokenHash == hash {
+			t := *token
+			return &t, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (r *memoryRefreshTokens) MarkReplaced(token *RefreshToken, replacedBy int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.refreshTokens[token.ID]
+	if !ok || stored.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	stored.RevokedAt = &now
+	stored.ReplacedBy = &replacedBy
+
+	return true, nil
+}
+
+func (r *memoryRefreshTokens) RevokeFamily(familyID string) error {
+	return r.revokeWhere(func(token *RefreshToken) bool { return token.FamilyID == familyID })
+}
+
+func (r *memoryRefreshTokens) RevokeAllForUser(userID int) error {
+	return r.revokeWhere(func(token *RefreshToken) bool { return token.UserID == userID })
+}
+
+// revokeWhere revokes the tokens matching keep that are not revoked yet.
+func (r *memoryRefreshTokens) revokeWhere(keep func(token *RefreshToken) bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.s.refreshTokens {
+		if token.RevokedAt == nil && keep(token) {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRefreshTokens) GetAllForUser(userID int) ([]*RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	var tokens []*RefreshToken
+	for _, token := range r.s.refreshTokens {
+		if token.UserID == userID && token.ExpiresAt.After(now) {
+			t := *token
+			tokens = append(tokens, &t)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID > tokens[j].ID
+	})
+
+	return tokens, nil
+}
+
+func (r *memoryRefreshTokens) DeleteForUser(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.refreshTokens {
+		if token.UserID == userID {
+			delete(r.s.refreshTokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRefreshTokens) DeleteExpired(before time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.refreshTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.s.refreshTokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRevokedTokens) Revoke(tokenID string, userID int, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.revokedTokens[tokenID]; !ok {
+		r.s.revokedTokens[tokenID] = &RevokedToken{
+			TokenID:   tokenID,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+			RevokedAt: time.Now(),
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryRevokedTokens) IsRevoked(tokenID string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, ok := r.s.revokedTokens[tokenID]
+	return ok, nil
+}
+
+func (r *memoryRevokedTokens) GetActive() ([]*RevokedToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	var tokens []*RevokedToken
+	for _, token := range r.s.revokedTokens {
+		if token.ExpiresAt.After(now) {
+			t := *token
+			tokens = append(tokens, &t)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (r *memoryRevokedTokens) RevokeIssuedBefore(userID int, issuedBefore, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cutoff, ok := r.s.tokenCutoffs[userID]
+	if !ok {
+		cutoff = &TokenCutoff{UserID: userID}
+		r.s.tokenCutoffs[userID] = cutoff
+	}
+	if issuedBefore.After(cutoff.IssuedBefore) {
+		cutoff.IssuedBefore = issuedBefore
+	}
+	if expiresAt.After(cutoff.ExpiresAt) {
+		cutoff.ExpiresAt = expiresAt
+	}
+
+	return nil
+}
+
+func (r *memoryRevokedTokens) IssuedBefore(userID int) (time.Time, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cutoff, ok := r.s.tokenCutoffs[userID]
+	if !ok {
+		return time.Time{}, nil
+	}
+	return cutoff.IssuedBefore, nil
+}
+
+func (r *memoryRevokedTokens) GetActiveCutoffs() ([]*TokenCutoff, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	var cutoffs []*TokenCutoff
+	for _, cutoff := range r.s.tokenCutoffs {
+		if cutoff.ExpiresAt.After(now) {
+			c := *cutoff
+			cutoffs = append(cutoffs, &c)
+		}
+	}
+
+	return cutoffs, nil
+}
+
+func (r *memoryRevokedTokens) DeleteExpired(before time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.revokedTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(r.s.revokedTokens, id)
+		}
+	}
+	for userID, cutoff := range r.s.tokenCutoffs {
+		if cutoff.ExpiresAt.Before(before) {
+			delete(r.s.tokenCutoffs, userID)
+		}
+	}
+
+	return nil
+}
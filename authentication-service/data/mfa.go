@@ -0,0 +1,275 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+// recoveryCodeCost is the bcrypt cost of recovery codes. They are random, so a lower cost
+// than passwords is enough and keeps checking a whole set of codes fast.
+const recoveryCodeCost = bcrypt.MinCost
+
+// errMFAEnabled is returned when enrolling a user whose second factor is already confirmed.
+var errMFAEnabled = errors.New("two factor authentication is already enabled")
+
+// MFA is the TOTP second factor of a user. It protects sign ins once confirmed, that is
+// once the user proved their authenticator app generates valid codes.
+type MFA struct {
+	UserID       int        `json:"user_id"`
+	Secret       string     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode is a single use code signing a user in when their authenticator app is
+// unavailable. Only a bcrypt hash of the code is stored.
+type RecoveryCode struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type postgresMFA struct {
+	db *sql.DB
+}
+
+type postgresRecoveryCodes struct {
+	db *sql.DB
+}
+
+// GetByUser returns the second factor of the user.
+func (r *postgresMFA) GetByUser(userID int) (*MFA, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select user_id, secret, confirmed_at, last_used_step, created_at, updated_at
+		from user_mfa where user_id = $1`
+
+	var mfa MFA
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.Secret,
+		&mfa.ConfirmedAt,
+		&mfa.LastUsedStep,
+		&mfa.CreatedAt,
+		&mfa.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// IsEnabled reports whether the user has a confirmed second factor.
+func (r *postgresMFA) IsEnabled(userID int) (bool, error) {
+	mfa, err := r.GetByUser(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return mfa.ConfirmedAt != nil, nil
+}
+
+// Enroll stores a new, unconfirmed secret for the user, replacing a previous enrollment
+// that was never confirmed.
+func (r *postgresMFA) Enroll(userID int, secret string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into user_mfa (user_id, secret, last_used_step, created_at, updated_at)
+		values ($1, $2, 0, $3, $3)
+		on conflict (user_id) do update set secret = $2, last_used_step = 0, updated_at = $3
+		where user_mfa.confirmed_at is null`
+
+	result, err := r.db.ExecContext(ctx, stmt, userID, secret, time.Now())
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errMFAEnabled
+	}
+
+	return nil
+}
+
+// Confirm enables the second factor.
+func (r *postgresMFA) Confirm(mfa *MFA) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update user_mfa set confirmed_at = $1, updated_at = $1 where user_id = $2`
+
+	_, err := r.db.ExecContext(ctx, stmt, now, mfa.UserID)
+	if err != nil {
+		return err
+	}
+
+	mfa.ConfirmedAt = &now
+	return nil
+}
+
+// UseStep records that the code of a time step was used. It reports false when a code of
+// that step or a later one was already used, so that an intercepted code can not be
+// replayed.
+func (r *postgresMFA) UseStep(mfa *MFA, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update user_mfa set last_used_step = $1, updated_at = $2 where user_id = $3 and last_used_step < $1`
+
+	result, err := r.db.ExecContext(ctx, stmt, step, time.Now(), mfa.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if affected == 1 {
+		mfa.LastUsedStep = step
+	}
+
+	return affected == 1, nil
+}
+
+// Disable removes the second factor of the user and their recovery codes.
+func (r *postgresMFA) Disable(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from user_mfa where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Replace stores new recovery codes for the user, invalidating the previous ones.
+func (r *postgresRecoveryCodes) Replace(userID int, codes []string) error {
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), recoveryCodeCost)
+		if err != nil {
+			return err
+		}
+		hashes[i] = hash
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `delete from mfa_recovery_codes where user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range hashes {
+		stmt := `insert into mfa_recovery_codes (user_id, code_hash, created_at) values ($1, $2, $3)`
+
+		_, err = tx.ExecContext(ctx, stmt, userID, hash, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Use consumes the recovery code of the user. It reports false when the code does not
+// match any unused code.
+func (r *postgresRecoveryCodes) Use(userID int, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, code_hash from mfa_recovery_codes where user_id = $1 and used_at is null`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+
+	matched := 0
+	for rows.Next() {
+		var id int
+		var hash string
+		err := rows.Scan(&id, &hash)
+		if err != nil {
+			rows.Close()
+			return false, err
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			matched = id
+			break
+		}
+	}
+	rows.Close()
+
+	if matched == 0 {
+		return false, nil
+	}
+
+	stmt := `update mfa_recovery_codes set used_at = $1 where id = $2 and used_at is null`
+
+	result, err := r.db.ExecContext(ctx, stmt, time.Now(), matched)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// CountUnused returns how many recovery codes the user has left.
+func (r *postgresRecoveryCodes) CountUnused(userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var count int
+	query := `select count(*) from mfa_recovery_codes where user_id = $1 and used_at is null`
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
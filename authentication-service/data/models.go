@@ -11,23 +11,42 @@ import (
 
 const dbTimeout = time.Second * 3
 
-var db *sql.DB
-
 // New is the function used to create an instance of the data package. It returns the type
-// Model, which embeds all the types we want to be available to our application.
+// Model, which embeds all the repositories we want to be available to our application,
+// backed by the Postgres database dbPool.
 func New(dbPool *sql.DB) Models {
-	db = dbPool
-
 	return Models{
-		User: User{},
+		User:         &postgresUsers{db: dbPool},
+		RefreshToken: &postgresRefreshTokens{db: dbPool},
+		RevokedToken: &postgresRevokedTokens{db: dbPool},
+		OneTimeToken: &postgresOneTimeTokens{db: dbPool},
+		LoginAttempt: &postgresLoginAttempts{db: dbPool},
+		Lockout:      &postgresLockouts{db: dbPool},
+		MFA:          &postgresMFA{db: dbPool},
+		RecoveryCode: &postgresRecoveryCodes{db: dbPool},
+		Identity:     &postgresIdentities{db: dbPool},
+		OIDCState:    &postgresOIDCStates{db: dbPool},
 	}
 }
 
-// Models is the type for this package. Note that any model that is included as a member
-// in this type is available to us throughout the application, anywhere that the
-// app variable is used, provided that the model is also added in the New function.
+// Models is the type for this package. Note that any repository that is included as a
+// member in this type is available to us throughout the application, anywhere that the
+// app variable is used, provided that it is also added in the New and NewMemory functions.
 type Models struct {
-	User User
+	User         UserRepository
+	RefreshToken RefreshTokenRepository
+	RevokedToken RevokedTokenRepository
+	OneTimeToken OneTimeTokenRepository
+	LoginAttempt LoginAttemptRepository
+	Lockout      LockoutRepository
+	MFA          MFARepository
+	RecoveryCode RecoveryCodeRepository
+	Identity     IdentityRepository
+	OIDCState    OIDCStateRepository
+}
+
+type postgresUsers struct {
+	db *sql.DB
 }
 
 // User is the structure which holds one user from the database.
@@ -39,19 +58,20 @@ type User struct {
 	Password  string    `json:"-"`
 	City      string    `json:"city"`
 	Type      string    `json:"type"`
+	Active    bool      `json:"active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // GetAll returns a slice of all users, sorted by last name
-func (u *User) GetAll() ([]*User, error) {
+func (r *postgresUsers) GetAll() ([]*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, city, type, created_at, updated_at
+	query := `select id, email, first_name, last_name, password, city, type, user_active = 1, created_at, updated_at
 	from users order by last_name`
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -69,6 +89,7 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.Password,
 			&user.City,
 			&user.Type,
+			&user.Active,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -84,14 +105,14 @@ func (u *User) GetAll() ([]*User, error) {
 }
 
 // GetByEmail returns one user by email
-func (u *User) GetByEmail(email string) (*User, error) {
+func (r *postgresUsers) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, city, type, created_at, updated_at from users where email = $1`
+	query := `select id, email, first_name, last_name, password, city, type, user_active = 1, created_at, updated_at from users where email = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, email)
+	row := r.db.QueryRowContext(ctx, query, email)
 
 	err := row.Scan(
 		&user.ID,
@@ -101,6 +122,7 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.Password,
 		&user.City,
 		&user.Type,
+		&user.Active,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -113,14 +135,14 @@ func (u *User) GetByEmail(email string) (*User, error) {
 }
 
 // GetOne returns one user by id
-func (u *User) GetOne(id int) (*User, error) {
+func (r *postgresUsers) GetOne(id int) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, city, type, created_at, updated_at from users where id = $1`
+	query := `select id, email, first_name, last_name, password, city, type, user_active = 1, created_at, updated_at from users where id = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, id)
+	row := r.db.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&user.ID,
@@ -130,6 +152,7 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.Password,
 		&user.City,
 		&user.Type,
+		&user.Active,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -141,9 +164,44 @@ func (u *User) GetOne(id int) (*User, error) {
 	return &user, nil
 }
 
+// UserName is the display name of a user, as shown by other services.
+type UserName struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetNames returns the display names of the users with the given ids. Unknown ids are left
+// out.
+func (r *postgresUsers) GetNames(ids []int) ([]*UserName, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, first_name || ' ' || last_name from users where id = any($1) order by id`
+
+	rows, err := r.db.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []*UserName
+
+	for rows.Next() {
+		var name UserName
+		err := rows.Scan(&name.ID, &name.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, &name)
+	}
+
+	return names, rows.Err()
+}
+
 // Update updates one user in the database, using the information
-// stored in the receiver u
-func (u *User) Update() error {
+// stored in user
+func (r *postgresUsers) Update(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -156,13 +214,13 @@ func (u *User) Update() error {
 		where id = $6
 	`
 
-	_, err := db.ExecContext(ctx, stmt,
-		u.Email,
-		u.FirstName,
-		u.LastName,
-		u.City,
+	_, err := r.db.ExecContext(ctx, stmt,
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		user.City,
 		time.Now(),
-		u.ID,
+		user.ID,
 	)
 
 	if err != nil {
@@ -172,29 +230,14 @@ func (u *User) Update() error {
 	return nil
 }
 
-// Delete deletes one user from the database, by User.ID
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, u.ID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // DeleteByID deletes one user from the database, by ID
-func (u *User) DeleteByID(id int) error {
+func (r *postgresUsers) DeleteByID(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `delete from users where id = $1`
 
-	_, err := db.ExecContext(ctx, stmt, id)
+	_, err := r.db.ExecContext(ctx, stmt, id)
 	if err != nil {
 		return err
 	}
@@ -203,7 +246,7 @@ func (u *User) DeleteByID(id int) error {
 }
 
 // Insert inserts a new user into the database, and returns the ID of the newly inserted row
-func (u *User) Insert(user User) (int, error) {
+func (r *postgresUsers) Insert(user User) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -213,16 +256,17 @@ func (u *User) Insert(user User) (int, error) {
 	}
 
 	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, city, type, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+	stmt := `insert into users (email, first_name, last_name, password, city, type, user_active, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
 
-	err = db.QueryRowContext(ctx, stmt,
+	err = r.db.QueryRowContext(ctx, stmt,
 		user.Email,
 		user.FirstName,
 		user.LastName,
 		hashedPassword,
 		user.City,
 		user.Type,
+		boolToInt(user.Active),
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -234,8 +278,32 @@ func (u *User) Insert(user User) (int, error) {
 	return newID, nil
 }
 
+// Activate marks the user as having verified their email address.
+func (r *postgresUsers) Activate(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update users set user_active = 1, updated_at = $1 where id = $2`
+
+	_, err := r.db.ExecContext(ctx, stmt, time.Now(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	user.Active = true
+	return nil
+}
+
+// boolToInt converts flags to the integers the users table stores them as.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // ResetPassword is the method we will use to change a user's password.
-func (u *User) ResetPassword(password string) error {
+func (r *postgresUsers) ResetPassword(user *User, password string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -245,7 +313,7 @@ func (u *User) ResetPassword(password string) error {
 	}
 
 	stmt := `update users set password = $1 where id = $2`
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
+	_, err = r.db.ExecContext(ctx, stmt, hashedPassword, user.ID)
 	if err != nil {
 		return err
 	}
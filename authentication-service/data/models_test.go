@@ -0,0 +1,133 @@
+package data
+
+import (
+	"authentification/migrations"
+	"common/migrate"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// migratedDB creates an empty database on the server of TEST_DSN, which must allow
+// creating databases and have a postgres role, applies the embedded migrations to it and
+// drops it when the test ends. Tests needing it are skipped when TEST_DSN is not set.
+func migratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN is not set")
+	}
+
+	server, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	name := fmt.Sprintf("auth_test_%d", time.Now().UnixNano())
+	if _, err := server.Exec("create database " + name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := server.Exec("drop database " + name); err != nil {
+			t.Error(err)
+		}
+	})
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Database = name
+
+	db := stdlib.OpenDB(*config)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, "authentication-service", migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestUserQueriesMatchMigratedSchema(t *testing.T) {
+	users := New(migratedDB(t)).User
+
+	// the row seeded by the first migration predates the city column
+	admin, err := users.GetByEmail("admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.Type != "admin" || admin.City != "" {
+		t.Fatalf("got seeded user %+v, want an admin without a city", admin)
+	}
+
+	id, err := users.Insert(User{Email: "ana@example.com", FirstName: "Ana", LastName: "Diaz", Password: "a long password", City: "Lyon", Type: "customer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.GetOne(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.City != "Lyon" || user.Active {
+		t.Fatalf("got user %+v, want an inactive user in Lyon", user)
+	}
+
+	user.City = "Paris"
+	if err := users.Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Activate(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.ResetPassword(user, "another long password"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err = users.GetByEmail("ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.City != "Paris" || !user.Active {
+		t.Fatalf("got user %+v, want an active user in Paris", user)
+	}
+	if ok, _ := user.PasswordMatches("another long password"); !ok {
+		t.Fatal("the new password does not match")
+	}
+
+	all, err := users.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d users, want 2", len(all))
+	}
+
+	names, err := users.GetNames([]int{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0].Name != "Ana Diaz" {
+		t.Fatalf("got names %+v, want Ana Diaz", names)
+	}
+
+	if err := users.DeleteByID(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetOne(id); err != sql.ErrNoRows {
+		t.Fatalf("got error %v after deleting the user, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Purposes of one time tokens. A token only works for the purpose it was created for.
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAPending        = "mfa_pending"
+)
+
+// OneTimeToken is a short lived token emailed to a user to prove they own the address, for
+// instance to reset their password. Only a hash of the token is stored, and it can be used
+// once.
+type OneTimeToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// IssuedTokens counts the tokens issued to a user for one purpose over a period, and says
+// when the oldest and the latest of them were issued; both are nil when there are none.
+type IssuedTokens struct {
+	Count  int
+	Oldest *time.Time
+	Latest *time.Time
+}
+
+type postgresOneTimeTokens struct {
+	db *sql.DB
+}
+
+// Insert creates a token for the user and purpose and returns the plain text token, which
+// is never stored. Tokens previously issued for the same purpose stop working, so only the
+// latest email is valid.
+func (r *postgresOneTimeTokens) Insert(userID int, purpose string, ttl time.Duration) (string, *OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(plainText),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `update one_time_tokens set used_at = $1 where user_id = $2 and purpose = $3 and used_at is null`
+
+	_, err = tx.ExecContext(ctx, stmt, token.CreatedAt, userID, purpose)
+	if err != nil {
+		return "", nil, err
+	}
+
+	stmt = `insert into one_time_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.CreatedAt,
+	).Scan(&token.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plainText, &token, nil
+}
+
+// Get returns the plain text token issued for purpose, without consuming it. It fails when
+// the token does not exist, expired or was already used.
+func (r *postgresOneTimeTokens) Get(purpose, plainText string) (*OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, purpose, token_hash, expires_at, used_at, created_at
+		from one_time_tokens
+		where token_hash = $1 and purpose = $2 and used_at is null and expires_at > $3`
+
+	var token OneTimeToken
+	err := r.db.QueryRowContext(ctx, query, HashToken(plainText), purpose, time.Now()).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Use consumes the plain text token issued for purpose and returns it. It fails when the
+// token does not exist, expired or was already used.
+func (r *postgresOneTimeTokens) Use(purpose, plainText string) (*OneTimeToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `update one_time_tokens set used_at = $1
+		where token_hash = $2 and purpose = $3 and used_at is null and expires_at > $1
+		returning id, user_id, purpose, token_hash, expires_at, used_at, created_at`
+
+	var token OneTimeToken
+	err := r.db.QueryRowContext(ctx, stmt, now, HashToken(plainText), purpose).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// CountIssuedSince returns how many tokens were issued to the user for purpose since the
+// given time, and when the oldest and the latest of them were issued.
+func (r *postgresOneTimeTokens) CountIssuedSince(userID int, purpose string, since time.Time) (IssuedTokens, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select count(*), min(created_at), max(created_at) from one_time_tokens
+		where user_id = $1 and purpose = $2 and created_at >= $3`
+
+	var issued IssuedTokens
+	err := r.db.QueryRowContext(ctx, query, userID, purpose, since).Scan(&issued.Count, &issued.Oldest, &issued.Latest)
+	if err != nil {
+		return IssuedTokens{}, err
+	}
+
+	return issued, nil
+}
+
+// DeleteExpired removes tokens that expired before the given time.
+func (r *postgresOneTimeTokens) DeleteExpired(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `delete from one_time_tokens where expires_at < $1`
+
+	_, err := r.db.ExecContext(ctx, stmt, before)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteForUser removes every token of the user.
+func (r *postgresOneTimeTokens) DeleteForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from one_time_tokens where user_id = $1`, userID)
+	return err
+}
@@ -0,0 +1,114 @@
+package data
+
+import "time"
+
+// UserRepository stores user accounts. Lookups of a user that does not exist fail with
+// sql.ErrNoRows.
+type UserRepository interface {
+	GetAll() ([]*User, error)
+	GetByEmail(email string) (*User, error)
+	GetOne(id int) (*User, error)
+	GetNames(ids []int) ([]*UserName, error)
+
+	// Insert hashes the plain text password of the user before storing it.
+	Insert(user User) (int, error)
+	Update(user *User) error
+	Activate(user *User) error
+	ResetPassword(user *User, password string) error
+	DeleteByID(id int) error
+}
+
+// RefreshTokenRepository stores refresh tokens, of which only hashes are kept. Lookups of
+// a token that does not exist fail with sql.ErrNoRows.
+type RefreshTokenRepository interface {
+	Insert(userID int, familyID string, ttl time.Duration) (string, *RefreshToken, error)
+	GetByToken(plainText string) (*RefreshToken, error)
+	MarkReplaced(token *RefreshToken, replacedBy int) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID int) error
+	GetAllForUser(userID int) ([]*RefreshToken, error)
+	DeleteForUser(userID int) error
+	DeleteExpired(before time.Time) error
+}
+
+// RevokedTokenRepository is the revocation list of access tokens, revoked one by one or
+// every token of a user issued before a cutoff.
+type RevokedTokenRepository interface {
+	Revoke(tokenID string, userID int, expiresAt time.Time) error
+	IsRevoked(tokenID string) (bool, error)
+	GetActive() ([]*RevokedToken, error)
+
+	// RevokeIssuedBefore revokes the tokens of the user issued before issuedBefore, until
+	// expiresAt when the last of them has expired. IssuedBefore returns the cutoff of the
+	// user, the zero time when there is none.
+	RevokeIssuedBefore(userID int, issuedBefore, expiresAt time.Time) error
+	IssuedBefore(userID int) (time.Time, error)
+	GetActiveCutoffs() ([]*TokenCutoff, error)
+
+	DeleteExpired(before time.Time) error
+}
+
+// OneTimeTokenRepository stores the tokens emailed to users. Tokens that do not exist,
+// expired or were used fail with sql.ErrNoRows.
+type OneTimeTokenRepository interface {
+	Insert(userID int, purpose string, ttl time.Duration) (string, *OneTimeToken, error)
+	Get(purpose, plainText string) (*OneTimeToken, error)
+	Use(purpose, plainText string) (*OneTimeToken, error)
+	CountIssuedSince(userID int, purpose string, since time.Time) (IssuedTokens, error)
+	DeleteExpired(before time.Time) error
+	DeleteForUser(userID int) error
+}
+
+// LoginAttemptRepository records sign in attempts and counts the failed ones.
+type LoginAttemptRepository interface {
+	Record(email, ip string, succeeded bool) error
+	AccountFailures(email string, since time.Time) (Failures, error)
+	IPFailures(ip string, since time.Time) (Failures, error)
+	GetByEmail(email string) ([]*LoginAttempt, error)
+	DeleteBefore(before time.Time) error
+	DeleteByEmail(email string) error
+}
+
+// LockoutRepository stores the lockouts of accounts and IP addresses. GetActive fails with
+// sql.ErrNoRows when nothing is locked.
+type LockoutRepository interface {
+	Insert(lockout Lockout) (int, error)
+	GetActive(email, ip string) (*Lockout, error)
+	GetAll(limit int) ([]*Lockout, error)
+	UnlockAccount(email string, adminID int) (bool, error)
+}
+
+// MFARepository stores the second factors of users. GetByUser fails with sql.ErrNoRows
+// when the user never enrolled.
+type MFARepository interface {
+	GetByUser(userID int) (*MFA, error)
+	IsEnabled(userID int) (bool, error)
+	Enroll(userID int, secret string) error
+	Confirm(mfa *MFA) error
+	UseStep(mfa *MFA, step int64) (bool, error)
+	Disable(userID int) error
+}
+
+// RecoveryCodeRepository stores the recovery codes of users, of which only hashes are kept.
+type RecoveryCodeRepository interface {
+	Replace(userID int, codes []string) error
+	Use(userID int, code string) (bool, error)
+	CountUnused(userID int) (int, error)
+}
+
+// IdentityRepository stores the links between users and their accounts at external
+// providers. GetBySubject fails with sql.ErrNoRows for accounts not linked yet.
+type IdentityRepository interface {
+	GetBySubject(provider, subject string) (*Identity, error)
+	GetAllForUser(userID int) ([]*Identity, error)
+	Insert(identity Identity) (int, error)
+	Touch(identity *Identity, email string) error
+	DeleteForUser(userID int) error
+}
+
+// OIDCStateRepository stores the sign ins with external providers in progress.
+type OIDCStateRepository interface {
+	Insert(state OIDCState, ttl time.Duration) (string, error)
+	Use(provider, plainText string) (*OIDCState, error)
+	DeleteExpired(now time.Time) error
+}
@@ -0,0 +1,376 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// RefreshToken is a long lived, single use token exchanged for a new access token. Only a
+// hash of the token is stored. Every rotation keeps the family of the token it replaces, so
+// that a reused token can revoke the whole chain.
+type RefreshToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	TokenHash  string     `json:"-"`
+	FamilyID   string     `json:"family_id"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *int       `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token, identified by its jti claim, that must no longer be
+// accepted even though it has not expired yet.
+type RevokedToken struct {
+	TokenID   string    `json:"jti"`
+	UserID    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// TokenCutoff revokes every access token of a user issued before IssuedBefore, such as when
+// their password changes. It is kept until ExpiresAt, when the last of them has expired.
+type TokenCutoff struct {
+	UserID       int       `json:"user_id"`
+	IssuedBefore time.Time `json:"issued_before"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type postgresRefreshTokens struct {
+	db *sql.DB
+}
+
+type postgresRevokedTokens struct {
+	db *sql.DB
+}
+
+// NewOpaqueToken returns a random URL safe token.
+func NewOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash under which an opaque token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert creates a refresh token for the user in the given family and returns the plain
+// text token, which is never stored. An empty familyID starts a new family.
+func (r *postgresRefreshTokens) Insert(userID int, familyID string, ttl time.Duration) (string, *RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	plainText, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = NewOpaqueToken()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	token := RefreshToken{
+		UserID:    userID,
+		TokenHash: HashToken(plainText),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	stmt := `insert into refresh_tokens (user_id, token_hash, family_id, expires_at, created_at)
+		values ($1, $2, $3, $4, $5) returning id`
+
+	err = r.db.QueryRowContext(ctx, stmt,
+		token.UserID,
+		token.TokenHash,
+		token.FamilyID,
+		token.ExpiresAt,
+		token.CreatedAt,
+	).Scan(&token.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plainText, &token, nil
+}
+
+// GetByToken returns the refresh token matching the plain text token.
+func (r *postgresRefreshTokens) GetByToken(plainText string) (*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, token_hash, family_id, expires_at, revoked_at, replaced_by, created_at
+		from refresh_tokens where token_hash = $1`
+
+	var token RefreshToken
+	err := r.db.QueryRowContext(ctx, query, HashToken(plainText)).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.FamilyID,
+		&token.ExpiresAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkReplaced revokes the refresh token because it was rotated into replacedBy. It reports
+// false when the token had already been revoked, for instance by a concurrent rotation.
+func (r *postgresRefreshTokens) MarkReplaced(token *RefreshToken, replacedBy int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1, replaced_by = $2 where id = $3 and revoked_at is null`
+
+	result, err := r.db.ExecContext(ctx, stmt, time.Now(), replacedBy, token.ID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// RevokeFamily revokes every refresh token of the family.
+func (r *postgresRefreshTokens) RevokeFamily(familyID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where family_id = $2 and revoked_at is null`
+
+	_, err := r.db.ExecContext(ctx, stmt, time.Now(), familyID)
+	return err
+}
+
+// RevokeAllForUser revokes every refresh token of the user, signing them out everywhere.
+func (r *postgresRefreshTokens) RevokeAllForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `update refresh_tokens set revoked_at = $1 where user_id = $2 and revoked_at is null`
+
+	_, err := r.db.ExecContext(ctx, stmt, time.Now(), userID)
+	return err
+}
+
+// GetAllForUser returns the refresh tokens of the user that have not expired, newest first.
+func (r *postgresRefreshTokens) GetAllForUser(userID int) ([]*RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select id, user_id, token_hash, family_id, expires_at, revoked_at, replaced_by, created_at
+		from refresh_tokens where user_id = $1 and expires_at > $2 order by created_at desc`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*RefreshToken
+
+	for rows.Next() {
+		var token RefreshToken
+		err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.TokenHash,
+			&token.FamilyID,
+			&token.ExpiresAt,
+			&token.RevokedAt,
+			&token.ReplacedBy,
+			&token.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// DeleteForUser removes every refresh token of the user.
+func (r *postgresRefreshTokens) DeleteForUser(userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from refresh_tokens where user_id = $1`, userID)
+	return err
+}
+
+// DeleteExpired removes refresh tokens that expired before the given time.
+func (r *postgresRefreshTokens) DeleteExpired(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from refresh_tokens where expires_at < $1`, before)
+	return err
+}
+
+// Revoke adds an access token to the revocation list until it expires.
+func (r *postgresRevokedTokens) Revoke(tokenID string, userID int, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into revoked_tokens (jti, user_id, expires_at, revoked_at) values ($1, $2, $3, $4)
+		on conflict (jti) do nothing`
+
+	_, err := r.db.ExecContext(ctx, stmt, tokenID, userID, expiresAt, time.Now())
+	return err
+}
+
+// IsRevoked reports whether the access token with the given jti has been revoked.
+func (r *postgresRevokedTokens) IsRevoked(tokenID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, `select exists (select 1 from revoked_tokens where jti = $1)`, tokenID).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// GetActive returns the revoked access tokens that have not expired yet.
+func (r *postgresRevokedTokens) GetActive() ([]*RevokedToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select jti, user_id, expires_at, revoked_at from revoked_tokens where expires_at > $1`
+
+	rows, err := r.db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*RevokedToken
+
+	for rows.Next() {
+		var token RevokedToken
+		err := rows.Scan(
+			&token.TokenID,
+			&token.UserID,
+			&token.ExpiresAt,
+			&token.RevokedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// RevokeIssuedBefore revokes every access token of the user issued before issuedBefore. A
+// later cutoff replaces an earlier one.
+func (r *postgresRevokedTokens) RevokeIssuedBefore(userID int, issuedBefore, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `insert into token_cutoffs (user_id, issued_before, expires_at) values ($1, $2, $3)
+		on conflict (user_id) do update set
+			issued_before = greatest(token_cutoffs.issued_before, excluded.issued_before),
+			expires_at = greatest(token_cutoffs.expires_at, excluded.expires_at)`
+
+	_, err := r.db.ExecContext(ctx, stmt, userID, issuedBefore, expiresAt)
+	return err
+}
+
+// IssuedBefore returns the time before which the access tokens of the user are revoked, or
+// the zero time when they are not.
+func (r *postgresRevokedTokens) IssuedBefore(userID int) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	var issuedBefore time.Time
+	err := r.db.QueryRowContext(ctx, `select issued_before from token_cutoffs where user_id = $1`, userID).
+		Scan(&issuedBefore)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return issuedBefore, nil
+}
+
+// GetActiveCutoffs returns the cutoffs that may still revoke a token that has not expired.
+func (r *postgresRevokedTokens) GetActiveCutoffs() ([]*TokenCutoff, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `select user_id, issued_before, expires_at from token_cutoffs where expires_at > $1`
+
+	rows, err := r.db.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cutoffs []*TokenCutoff
+
+	for rows.Next() {
+		var cutoff TokenCutoff
+		err := rows.Scan(
+			&cutoff.UserID,
+			&cutoff.IssuedBefore,
+			&cutoff.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		cutoffs = append(cutoffs, &cutoff)
+	}
+
+	return cutoffs, nil
+}
+
+// DeleteExpired removes revoked access tokens and cutoffs that expired before the given
+// time, as the tokens they revoke are rejected anyway.
+func (r *postgresRevokedTokens) DeleteExpired(before time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `delete from revoked_tokens where expires_at < $1`, before)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `delete from token_cutoffs where expires_at < $1`, before)
+	return err
+}
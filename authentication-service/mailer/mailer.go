@@ -0,0 +1,134 @@
+// Package mailer sends the emails of the authentication service, such as password reset
+// links. Messages go through an SMTP server in production, or are written to disk or to
+// the log for local development.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config says how messages are sent, from the MAIL_* and SMTP_* settings.
+type Config struct {
+	// From is the sender of every message.
+	From string
+
+	// SMTPHost, when set, sends messages through that SMTP server, authenticating as
+	// SMTPUsername when it is set.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// Dir is where messages are written without an SMTP server, or the log when empty.
+	Dir string
+}
+
+// New returns the mailer described by cfg.
+func New(cfg Config) Mailer {
+	if cfg.SMTPHost != "" {
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	}
+
+	return &FileMailer{Dir: cfg.Dir, From: cfg.From}
+}
+
+// SMTPMailer sends messages through an SMTP server, authenticating with PLAIN auth when a
+// username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send sends the message.
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, format(m.From, msg))
+}
+
+// FileMailer writes every message as an .eml file to Dir, or to the log when Dir is empty.
+// Nothing is actually sent, which is what local development and tests want.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message.
+func (m *FileMailer) Send(msg Message) error {
+	contents := format(m.From, msg)
+
+	if m.Dir == "" {
+		log.Printf("Mail to %s:\n%s\n", msg.To, contents)
+		return nil
+	}
+
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), contents, 0o644)
+}
+
+// format renders the message with its headers.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// headerValue drops line breaks, which would let a value inject headers.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// sanitize keeps an email address usable in a file name.
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, address)
+}
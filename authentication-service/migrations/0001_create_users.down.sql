@@ -0,0 +1,3 @@
+DROP TABLE public.users;
+
+DROP SEQUENCE public.user_id_seq;
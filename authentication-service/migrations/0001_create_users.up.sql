@@ -56,4 +56,14 @@ VALUES
     (E'admin@example.com',E'Admin',E'User',E'$2a$12$1zGLuYDDNvATh4RA4avbKuheAMpb1svexSzrQm7up.bnpwQHs0jNe',1,E'2022-03-14 00:00:00',E'2022-03-14 00:00:00');
 
 ALTER TABLE public.users
-    ADD COLUMN type character varying(255);
\ No newline at end of file
+    ADD COLUMN type character varying(255);
+
+-- roles: customer, driver, admin, support
+UPDATE public.users SET type = 'admin' WHERE email = 'admin@example.com';
+
+ALTER TABLE public.users
+    ADD CONSTRAINT users_type_check CHECK (type IN ('customer', 'driver', 'admin', 'support')) NOT VALID;
+
+-- user_active is set once the email address is verified; accounts created before
+-- verification existed are trusted
+UPDATE public.users SET user_active = 1;
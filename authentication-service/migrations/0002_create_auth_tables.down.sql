@@ -0,0 +1,19 @@
+DROP TABLE public.oidc_states;
+DROP TABLE public.user_identities;
+DROP SEQUENCE public.user_identity_id_seq;
+
+DROP TABLE public.mfa_recovery_codes;
+DROP SEQUENCE public.mfa_recovery_code_id_seq;
+DROP TABLE public.user_mfa;
+
+DROP TABLE public.account_lockouts;
+DROP SEQUENCE public.account_lockout_id_seq;
+DROP TABLE public.login_attempts;
+DROP SEQUENCE public.login_attempt_id_seq;
+
+DROP TABLE public.one_time_tokens;
+DROP SEQUENCE public.one_time_token_id_seq;
+
+DROP TABLE public.revoked_tokens;
+DROP TABLE public.refresh_tokens;
+DROP SEQUENCE public.refresh_token_id_seq;
@@ -0,0 +1,212 @@
+CREATE SEQUENCE public.refresh_token_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.refresh_token_id_seq OWNER TO postgres;
+
+SET default_tablespace = '';
+SET default_table_access_method = heap;
+
+-- only the sha256 of a refresh token is stored
+CREATE TABLE public.refresh_tokens (
+                                       id integer DEFAULT nextval('public.refresh_token_id_seq'::regclass) NOT NULL,
+                                       user_id integer NOT NULL,
+                                       token_hash character(64) NOT NULL,
+                                       family_id character varying(64) NOT NULL,
+                                       expires_at timestamp without time zone NOT NULL,
+                                       revoked_at timestamp without time zone,
+                                       replaced_by integer,
+                                       created_at timestamp without time zone
+);
+
+ALTER TABLE public.refresh_tokens OWNER TO postgres;
+
+ALTER TABLE ONLY public.refresh_tokens
+    ADD CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX refresh_tokens_token_hash_idx ON public.refresh_tokens (token_hash);
+CREATE INDEX refresh_tokens_family_id_idx ON public.refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON public.refresh_tokens (user_id);
+
+-- access tokens revoked before they expire, by jti
+CREATE TABLE public.revoked_tokens (
+                                       jti character varying(64) NOT NULL,
+                                       user_id integer NOT NULL,
+                                       expires_at timestamp without time zone NOT NULL,
+                                       revoked_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.revoked_tokens OWNER TO postgres;
+
+ALTER TABLE ONLY public.revoked_tokens
+    ADD CONSTRAINT revoked_tokens_pkey PRIMARY KEY (jti);
+
+CREATE SEQUENCE public.one_time_token_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.one_time_token_id_seq OWNER TO postgres;
+
+-- tokens emailed to users, such as password reset links; only the sha256 is stored
+CREATE TABLE public.one_time_tokens (
+                                        id integer DEFAULT nextval('public.one_time_token_id_seq'::regclass) NOT NULL,
+                                        user_id integer NOT NULL,
+                                        purpose character varying(32) NOT NULL,
+                                        token_hash character(64) NOT NULL,
+                                        expires_at timestamp without time zone NOT NULL,
+                                        used_at timestamp without time zone,
+                                        created_at timestamp without time zone
+);
+
+ALTER TABLE public.one_time_tokens OWNER TO postgres;
+
+ALTER TABLE ONLY public.one_time_tokens
+    ADD CONSTRAINT one_time_tokens_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX one_time_tokens_token_hash_idx ON public.one_time_tokens (token_hash);
+CREATE INDEX one_time_tokens_user_id_idx ON public.one_time_tokens (user_id, purpose);
+
+CREATE SEQUENCE public.login_attempt_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.login_attempt_id_seq OWNER TO postgres;
+
+-- sign in attempts, to throttle password guessing per account and per IP address
+CREATE TABLE public.login_attempts (
+                                       id integer DEFAULT nextval('public.login_attempt_id_seq'::regclass) NOT NULL,
+                                       email character varying(255) NOT NULL,
+                                       ip character varying(45) NOT NULL,
+                                       succeeded boolean NOT NULL,
+                                       created_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.login_attempts OWNER TO postgres;
+
+ALTER TABLE ONLY public.login_attempts
+    ADD CONSTRAINT login_attempts_pkey PRIMARY KEY (id);
+
+CREATE INDEX login_attempts_email_idx ON public.login_attempts (email, created_at);
+CREATE INDEX login_attempts_ip_idx ON public.login_attempts (ip, created_at);
+
+CREATE SEQUENCE public.account_lockout_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.account_lockout_id_seq OWNER TO postgres;
+
+-- lockouts of an account (email) or an IP address, kept as an audit trail
+CREATE TABLE public.account_lockouts (
+                                         id integer DEFAULT nextval('public.account_lockout_id_seq'::regclass) NOT NULL,
+                                         email character varying(255),
+                                         ip character varying(45),
+                                         failed_attempts integer NOT NULL,
+                                         locked_until timestamp without time zone NOT NULL,
+                                         unlocked_at timestamp without time zone,
+                                         unlocked_by integer,
+                                         created_at timestamp without time zone NOT NULL,
+                                         CONSTRAINT account_lockouts_target_check CHECK ((email IS NULL) <> (ip IS NULL))
+);
+
+ALTER TABLE public.account_lockouts OWNER TO postgres;
+
+ALTER TABLE ONLY public.account_lockouts
+    ADD CONSTRAINT account_lockouts_pkey PRIMARY KEY (id);
+
+CREATE INDEX account_lockouts_email_idx ON public.account_lockouts (email);
+CREATE INDEX account_lockouts_ip_idx ON public.account_lockouts (ip);
+
+-- TOTP second factor of a user, enabled once confirmed_at is set
+CREATE TABLE public.user_mfa (
+                                 user_id integer NOT NULL,
+                                 secret character varying(64) NOT NULL,
+                                 confirmed_at timestamp without time zone,
+                                 last_used_step bigint DEFAULT 0 NOT NULL,
+                                 created_at timestamp without time zone NOT NULL,
+                                 updated_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.user_mfa OWNER TO postgres;
+
+ALTER TABLE ONLY public.user_mfa
+    ADD CONSTRAINT user_mfa_pkey PRIMARY KEY (user_id);
+
+CREATE SEQUENCE public.mfa_recovery_code_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.mfa_recovery_code_id_seq OWNER TO postgres;
+
+-- only bcrypt hashes of the recovery codes are stored
+CREATE TABLE public.mfa_recovery_codes (
+                                           id integer DEFAULT nextval('public.mfa_recovery_code_id_seq'::regclass) NOT NULL,
+                                           user_id integer NOT NULL,
+                                           code_hash character varying(60) NOT NULL,
+                                           used_at timestamp without time zone,
+                                           created_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.mfa_recovery_codes OWNER TO postgres;
+
+ALTER TABLE ONLY public.mfa_recovery_codes
+    ADD CONSTRAINT mfa_recovery_codes_pkey PRIMARY KEY (id);
+
+CREATE INDEX mfa_recovery_codes_user_id_idx ON public.mfa_recovery_codes (user_id);
+
+CREATE SEQUENCE public.user_identity_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.user_identity_id_seq OWNER TO postgres;
+
+-- accounts at external OIDC providers users sign in with
+CREATE TABLE public.user_identities (
+                                        id integer DEFAULT nextval('public.user_identity_id_seq'::regclass) NOT NULL,
+                                        user_id integer NOT NULL,
+                                        provider character varying(32) NOT NULL,
+                                        subject character varying(255) NOT NULL,
+                                        email character varying(255) NOT NULL,
+                                        created_at timestamp without time zone NOT NULL,
+                                        last_login_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.user_identities OWNER TO postgres;
+
+ALTER TABLE ONLY public.user_identities
+    ADD CONSTRAINT user_identities_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX user_identities_provider_subject_idx ON public.user_identities (provider, subject);
+CREATE INDEX user_identities_user_id_idx ON public.user_identities (user_id);
+
+-- OIDC sign ins in progress, by sha256 of the state parameter
+CREATE TABLE public.oidc_states (
+                                    state_hash character(64) NOT NULL,
+                                    provider character varying(32) NOT NULL,
+                                    code_verifier character varying(128) NOT NULL,
+                                    nonce character varying(64) NOT NULL,
+                                    expires_at timestamp without time zone NOT NULL,
+                                    created_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.oidc_states OWNER TO postgres;
+
+ALTER TABLE ONLY public.oidc_states
+    ADD CONSTRAINT oidc_states_pkey PRIMARY KEY (state_hash);
@@ -0,0 +1,12 @@
+-- access tokens issued to a user before issued_before are revoked, such as when their
+-- password changes; kept until expires_at, when the last of those tokens has expired
+CREATE TABLE public.token_cutoffs (
+                                      user_id integer NOT NULL,
+                                      issued_before timestamp without time zone NOT NULL,
+                                      expires_at timestamp without time zone NOT NULL
+);
+
+ALTER TABLE public.token_cutoffs OWNER TO postgres;
+
+ALTER TABLE ONLY public.token_cutoffs
+    ADD CONSTRAINT token_cutoffs_pkey PRIMARY KEY (user_id);
@@ -0,0 +1,4 @@
+-- the city of a user, given at registration and on profile updates; users scan it into a
+-- string, so existing rows get an empty one rather than null
+ALTER TABLE public.users
+    ADD COLUMN city character varying(255) DEFAULT '' NOT NULL;
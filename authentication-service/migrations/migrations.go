@@ -0,0 +1,10 @@
+// Package migrations embeds the schema migrations of the service, applied at startup or
+// with the migrate subcommand. Never edit a migration once it was released; add a new one.
+package migrations
+
+import "embed"
+
+// FS holds the <version>_<name>.up.sql and .down.sql files.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,312 @@
+// Package mockoidc is a minimal OpenID Connect provider for trying out and testing sign in
+// with external providers locally. It signs in anybody as whatever email address they
+// type, so it must never be used in production.
+//
+// Passing login_hint to the authorization endpoint skips the sign in form, which lets
+// scripts go through the whole flow without a browser. Passing email, and optionally
+// email_verified and name, does the same with the answers of the form.
+package mockoidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyID   = "mock"
+	codeTTL = time.Minute
+)
+
+// authorization is an issued authorization code waiting to be exchanged.
+type authorization struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Email         string
+	Name          string
+	EmailVerified bool
+	ExpiresAt     time.Time
+}
+
+// Provider is the mock provider. Issuer is the address browsers reach it at, and
+// InternalURL the address services reach its token and keys endpoints at.
+type Provider struct {
+	Issuer       string
+	InternalURL  string
+	ClientID     string
+	ClientSecret string
+	Key          *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// New returns a provider accepting the client, with a fresh signing key.
+func New(issuer, internalURL, clientID, clientSecret string) (*Provider, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		InternalURL:  strings.TrimSuffix(internalURL, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		codes:        make(map[string]authorization),
+	}, nil
+}
+
+// ServeHTTP serves the discovery, keys, authorization and token endpoints.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		p.Discovery(w, r)
+	case "/jwks":
+		p.JWKS(w, r)
+	case "/authorize":
+		p.Authorize(w, r)
+	case "/token":
+		p.Token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Discovery serves the provider metadata.
+func (p *Provider) Discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.InternalURL + "/token",
+		"jwks_uri":                              p.InternalURL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"ES256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// JWKS serves the public key ID tokens are signed with.
+func (p *Provider) JWKS(w http.ResponseWriter, r *http.Request) {
+	ecdhKey, err := p.Key.PublicKey.ECDH()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	point := ecdhKey.Bytes()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": keyID,
+			"alg": "ES256",
+			"use": "sig",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+			"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+		}},
+	})
+}
+
+var signInForm = template.Must(template.New("signin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock OIDC provider</title></head>
+<body>
+<h1>Sign in to the mock OIDC provider</h1>
+<form method="post">
+<p><label>Email <input type="email" name="email" required></label></p>
+<p><label>Name <input type="text" name="name"></label></p>
+<p><label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// Authorize shows the sign in form, and redirects back to the client with a code once the
+// user submitted it.
+func (p *Provider) Authorize(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := r.Form
+	if params.Get("client_id") != p.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(params.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if params.Get("response_type") != "code" || params.Get("code_challenge_method") != "S256" || params.Get("code_challenge") == "" {
+		http.Error(w, "only the code flow with S256 PKCE is supported", http.StatusBadRequest)
+		return
+	}
+
+	email := params.Get("email")
+	verified := params.Get("email_verified") == "true"
+	if email == "" {
+		email = params.Get("login_hint")
+		verified = true
+	}
+
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// the form posts back to this URL, query string included
+		signInForm.Execute(w, nil)
+		return
+	}
+
+	code, err := randomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		ClientID:      p.ClientID,
+		RedirectURI:   redirectURI.String(),
+		CodeChallenge: params.Get("code_challenge"),
+		Nonce:         params.Get("nonce"),
+		Email:         email,
+		Name:          params.Get("name"),
+		EmailVerified: verified,
+		ExpiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", params.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// Token exchanges an authorization code for an ID token.
+func (p *Provider) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(auth.ExpiresAt) || auth.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.CodeChallenge {
+		writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer,
+		"aud":            p.ClientID,
+		"sub":            subjectFor(auth.Email),
+		"email":          auth.Email,
+		"email_verified": auth.EmailVerified,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if auth.Nonce != "" {
+		claims["nonce"] = auth.Nonce
+	}
+	if auth.Name != "" {
+		claims["name"] = auth.Name
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = keyID
+
+	idToken, err := token.SignedString(p.Key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": idToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// subjectFor derives a stable subject from the email address, so that signing in again
+// with the same address is the same provider account.
+func subjectFor(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,159 @@
+// Package passwords checks that the passwords users choose are strong enough, for
+// registration, password changes and password resets alike.
+package passwords
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords is the bundled list of the most used, and so most guessed, passwords.
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// MaxLength is the most bcrypt hashes; longer passwords are refused rather than truncated.
+const MaxLength = 72
+
+// Policy is what a password must satisfy.
+type Policy struct {
+	MinLength int
+
+	// MinClasses is how many of lowercase letters, uppercase letters, digits and symbols
+	// the password must mix.
+	MinClasses int
+
+	// Common holds the lowercase passwords that are refused because they are too often
+	// used. Nil disables the check.
+	Common map[string]bool
+}
+
+// Violation lists every rule a password breaks, so that users can fix them all at once.
+type Violation struct {
+	Problems []string
+}
+
+func (v *Violation) Error() string {
+	return "password " + strings.Join(v.Problems, ", ")
+}
+
+// DefaultPolicy returns the policy used when nothing is configured.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:  8,
+		MinClasses: 2,
+		Common:     parseList(strings.NewReader(commonPasswords)),
+	}
+}
+
+// NewPolicy returns a policy of passwords at least minLength characters long, mixing at
+// least minClasses character classes. commonList is a file of refused passwords, one per
+// line, replacing the bundled list when set; "none" accepts common passwords.
+func NewPolicy(minLength, minClasses int, commonList string) (*Policy, error) {
+	policy := DefaultPolicy()
+	policy.MinLength = minLength
+	policy.MinClasses = minClasses
+
+	switch commonList {
+	case "":
+	case "none":
+		policy.Common = nil
+	default:
+		file, err := os.Open(commonList)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		policy.Common = parseList(file)
+		log.Printf("Refusing %d common passwords from %s\n", len(policy.Common), commonList)
+	}
+
+	return policy, nil
+}
+
+// parseList reads one password per line, skipping blank lines and # comments.
+func parseList(r io.Reader) map[string]bool {
+	list := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = true
+	}
+
+	return list
+}
+
+// Validate returns a *Violation when the password of the user with the given email address
+// breaks the policy.
+func (p *Policy) Validate(password, email string) error {
+	var problems []string
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		problems = append(problems, "should be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if len(password) > MaxLength {
+		problems = append(problems, "should be at most "+strconv.Itoa(MaxLength)+" bytes long")
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		problems = append(problems, "should mix at least "+strconv.Itoa(p.MinClasses)+" of lowercase letters, uppercase letters, digits and symbols")
+	}
+
+	lower := strings.ToLower(password)
+	if p.Common[lower] {
+		problems = append(problems, "is too common")
+	}
+
+	if email != "" {
+		email = strings.ToLower(email)
+		local, _, _ := strings.Cut(email, "@")
+		if lower == email || (len(local) >= 3 && lower == local) {
+			problems = append(problems, "should not be your email address")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &Violation{Problems: problems}
+	}
+
+	return nil
+}
+
+// characterClasses counts the character classes the password uses.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors of RFC 6238, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	// Appendix B lists 8 digit codes, of which ours are the last 6
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.code[len(v.code)-Digits:]; code != want {
+			t.Fatalf("got code %s at %d, want %s", code, v.unix, want)
+		}
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		step, ok := Validate(rfcSecret, code, now, 1)
+		if ok != want {
+			t.Fatalf("got valid %v for a code %d steps away, want %v", ok, offset, want)
+		}
+		if ok && step != current+offset {
+			t.Fatalf("got step %d, want the step of the code %d", step, current+offset)
+		}
+	}
+
+	previous, _ := Code(rfcSecret, current-1)
+	if _, ok := Validate(rfcSecret, previous, now, 0); ok {
+		t.Fatal("the code of the previous step was accepted without skew")
+	}
+
+	code, _ := Code(rfcSecret, current)
+	if _, ok := Validate(rfcSecret, " "+code+"\n", now, 0); !ok {
+		t.Fatal("a code surrounded by spaces was refused")
+	}
+	for _, wrong := range []string{"", code[:Digits-1], code + "0"} {
+		if _, ok := Validate(rfcSecret, wrong, now, 1); ok {
+			t.Fatalf("the code %q was accepted", wrong)
+		}
+	}
+}
+
+func TestSecretDecoding(t *testing.T) {
+	step := Step(time.Unix(59, 0))
+
+	// authenticator apps show secrets in lower case, and without padding
+	for _, secret := range []string{rfcSecret, strings.ToLower(rfcSecret)} {
+		code, err := Code(secret, step)
+		if err != nil || code != "287082" {
+			t.Fatalf("got code %q (%v) for %s, want 287082", code, err, secret)
+		}
+	}
+
+	for _, invalid := range []string{"GEZDGNBV1", rfcSecret + "===="} {
+		if _, err := Code(invalid, step); err == nil {
+			t.Fatalf("the secret %q was decoded", invalid)
+		}
+		if _, ok := Validate(invalid, "287082", time.Unix(59, 0), 1); ok {
+			t.Fatalf("a code was accepted for the secret %q", invalid)
+		}
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretSize || strings.Contains(secret, "=") {
+		t.Fatalf("got secret %q decoding to %d bytes (%v), want %d bytes without padding", secret, len(key), err, secretSize)
+	}
+}
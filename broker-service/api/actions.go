@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Action is something the frontend can ask the broker to do, by submitting its name to
+// /handle together with its payload.
+type Action struct {
+	Name        string
+	Description string
+
+	// Field is the key of the submission holding the payload, empty for actions without one.
+	Field string
+
+	// Public actions may be submitted without a token. The others need a valid one, carrying
+	// Permission when it is set.
+	Public     bool
+	Permission string
+
+	Handler Handler
+}
+
+// Field describes a field of the payload of an action.
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// Handler serves an action once its payload was checked against its schema.
+type Handler struct {
+	schema []Field
+	serve  func(app *Config, w http.ResponseWriter, r *http.Request, payload json.RawMessage)
+}
+
+// Handle returns the handler calling handle with the payload decoded into a T. The schema of
+// the payload is read from the json tags of T: fields are required unless they are pointers
+// or tagged omitempty.
+func Handle[T any](handle func(app *Config, w http.ResponseWriter, r *http.Request, payload T)) Handler {
+	return Handler{
+		schema: schemaOf(reflect.TypeOf((*T)(nil)).Elem()),
+		serve: func(app *Config, w http.ResponseWriter, r *http.Request, raw json.RawMessage) {
+			var payload T
+			if len(raw) > 0 {
+				err := json.Unmarshal(raw, &payload)
+				if err != nil {
+					app.errorJSON(w, err)
+					return
+				}
+			}
+			handle(app, w, r, payload)
+		},
+	}
+}
+
+// noPayload is the payload of actions that take none.
+type noPayload struct{}
+
+// Registry holds the actions the broker accepts.
+type Registry struct {
+	actions map[string]Action
+	names   []string
+}
+
+// NewRegistry returns a registry of the given actions.
+func NewRegistry(actions ...Action) *Registry {
+	registry := &Registry{actions: make(map[string]Action)}
+	for _, action := range actions {
+		registry.Register(action)
+	}
+	return registry
+}
+
+// Register adds an action. It panics when the name is already taken, which is a programming
+// error.
+func (reg *Registry) Register(action Action) {
+	if _, ok := reg.actions[action.Name]; ok {
+		panic(fmt.Sprintf("broker: action %q registered twice", action.Name))
+	}
+	reg.actions[action.Name] = action
+	reg.names = append(reg.names, action.Name)
+}
+
+// Lookup returns the action with the given name.
+func (reg *Registry) Lookup(name string) (Action, bool) {
+	action, ok := reg.actions[name]
+	return action, ok
+}
+
+// Actions returns every action, in the order they were registered.
+func (reg *Registry) Actions() []Action {
+	actions := make([]Action, len(reg.names))
+	for i, name := range reg.names {
+		actions[i] = reg.actions[name]
+	}
+	return actions
+}
+
+// validate checks the payload of the action against its schema, and returns what is wrong
+// with it by field.
+func (action Action) validate(raw json.RawMessage) map[string]string {
+	problems := make(map[string]string)
+
+	var fields map[string]json.RawMessage
+	if len(raw) > 0 && string(raw) != "null" {
+		err := json.Unmarshal(raw, &fields)
+		if err != nil {
+			problems[action.Field] = "must be an object"
+			return problems
+		}
+	}
+
+	known := make(map[string]bool, len(action.Handler.schema))
+	for _, field := range action.Handler.schema {
+		known[field.Name] = true
+
+		value, ok := fields[field.Name]
+		if !ok || string(value) == "null" {
+			if field.Required {
+				problems[field.Name] = "is required"
+			}
+			continue
+		}
+
+		if !hasType(value, field.Type) {
+			problems[field.Name] = "must be of type " + field.Type
+		}
+	}
+
+	for name := range fields {
+		if !known[name] {
+			problems[name] = "is not a field of " + action.Name
+		}
+	}
+
+	return problems
+}
+
+// hasType reports whether the JSON value is of the schema type.
+func hasType(value json.RawMessage, typ string) bool {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return false
+	}
+
+	switch typ {
+	case "string":
+		return value[0] == '"'
+	case "boolean":
+		return string(value) == "true" || string(value) == "false"
+	case "object":
+		return value[0] == '{'
+	case "array":
+		return value[0] == '['
+	case "number", "integer":
+		var number json.Number
+		if json.Unmarshal(value, &number) != nil {
+			return false
+		}
+		if typ == "integer" {
+			_, err := number.Int64()
+			return err == nil
+		}
+		return true
+	}
+
+	return true
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes the fields of a payload struct.
+func schemaOf(t reflect.Type) []Field {
+	var schema []Field
+	if t.Kind() != reflect.Struct {
+		return schema
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		typ := field.Type
+		required := !strings.Contains(options, "omitempty")
+		if typ.Kind() == reflect.Pointer {
+			typ = typ.Elem()
+			required = false
+		}
+
+		schema = append(schema, Field{Name: name, Type: typeName(typ), Required: required})
+	}
+
+	return schema
+}
+
+func typeName(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
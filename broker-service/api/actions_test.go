@@ -0,0 +1,51 @@
+package api
+
+import (
+	"common/carclient"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSchemaFollowsJSONTags(t *testing.T) {
+	handler := Handle(func(app *Config, w http.ResponseWriter, r *http.Request, request carclient.NewCarRequest) {})
+
+	got := fmt.Sprint(handler.schema)
+	want := "[{car_type string true} {city string true} {address string true} {pickup_lat number false} " +
+		"{pickup_lng number false} {dropoff_lat number false} {dropoff_lng number false} {surge_multiplier number false}]"
+	if got != want {
+		t.Fatalf("got schema %s, want %s", got, want)
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	action := Action{Name: "update_car", Field: "update_car", Handler: Handle((*Config).updateCar)}
+
+	for _, test := range []struct {
+		payload string
+		want    map[string]string
+	}{
+		{`{"id": 3, "active": true}`, map[string]string{}},
+		{`{"id": 3, "car_name": "Sandero"}`, map[string]string{}},
+		{``, map[string]string{"id": "is required"}},
+		{`{"id": 3.5, "active": "yes"}`, map[string]string{"id": "must be of type integer", "active": "must be of type boolean"}},
+		{`{"id": 3, "active": false, "name": "x"}`, map[string]string{"name": "is not a field of update_car"}},
+		{`[1]`, map[string]string{"update_car": "must be an object"}},
+	} {
+		got := action.validate(json.RawMessage(test.payload))
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got %v, want %v", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestRegistryRejectsDuplicateNames(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering an action twice did not panic")
+		}
+	}()
+
+	NewRegistry(DefaultActions()...).Register(Action{Name: "auth"})
+}
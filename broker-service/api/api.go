@@ -0,0 +1,27 @@
+// Package api holds the HTTP handlers of the broker service, which forwards the requests
+// of the frontend to the authentication and car services.
+package api
+
+import (
+	"common/auth"
+	"common/authclient"
+	"common/carclient"
+)
+
+type Config struct {
+	// Auth and Cars call the authentication and car services requests are forwarded to.
+	Auth *authclient.Client
+	Cars *carclient.Client
+
+	Verifier *auth.Verifier
+
+	// GatewaySecret is shared with the services, which trust the identity the gateway
+	// forwards along with it. The gateway forwards no identity when it is empty.
+	GatewaySecret string
+
+	// Actions are the actions /handle accepts, DefaultActions when nil.
+	Actions *Registry
+
+	// Gateway are the routes forwarded to the services as they are, DefaultRoutes when nil.
+	Gateway []Route
+}
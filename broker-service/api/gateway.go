@@ -0,0 +1,141 @@
+package api
+
+import (
+	"common/auth"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Route forwards the requests under a path prefix to a service, so that clients reach every
+// endpoint through the broker.
+type Route struct {
+	// Prefix is replaced by Path when forwarding: with Prefix "/api/cars" and Path "/cars",
+	// /api/cars/3 reaches /cars/3 of the service at Target.
+	Prefix string
+	Path   string
+	Target string
+
+	// Authenticated routes answer requests without a valid token with 401 Unauthorized.
+	// Other routes forward them without identity, for the service to decide.
+	Authenticated bool
+
+	// Timeout bounds how long the service may take to answer, 0 for no limit.
+	Timeout time.Duration
+}
+
+// DefaultRoutes returns the routes to the authentication and car services, bounded by the
+// timeouts of their clients. Every endpoint of the car service needs a token, and is
+// reached under /api with its own path.
+func (app *Config) DefaultRoutes() []Route {
+	routes := []Route{
+		{
+			Prefix:  "/api/auth",
+			Target:  app.Auth.BaseURL,
+			Timeout: app.Auth.HTTP.Timeout,
+		},
+	}
+
+	for _, path := range carServicePaths {
+		routes = append(routes, Route{
+			Prefix:        "/api" + path,
+			Path:          path,
+			Target:        app.Cars.BaseURL,
+			Authenticated: true,
+			Timeout:       app.Cars.HTTP.Timeout,
+		})
+	}
+
+	return routes
+}
+
+// carServicePaths are the paths of the endpoints the car service serves to clients. Erasing
+// the data of other users and its metrics are left out, for staff to reach them directly.
+var carServicePaths = []string{
+	"/cars",
+	"/car_requests",
+	"/driver_car_requests",
+	"/offers",
+	"/fare_estimate",
+	"/surge",
+	"/users/me/data",
+}
+
+// mountRoute serves the route on mux. The token is verified here once, and the identity
+// it carries is passed on in the headers of package auth with the gateway secret, replacing
+// any the client sent, for the services to trust it without verifying the token again.
+func (app *Config) mountRoute(mux chi.Router, route Route) {
+	target, err := url.Parse(route.Target)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		panic(fmt.Sprintf("broker: route %s has an invalid target %q", route.Prefix, route.Target))
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = route.Path + strings.TrimPrefix(pr.In.URL.Path, route.Prefix)
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(target)
+			pr.SetXForwarded()
+
+			principal, _ := auth.FromContext(pr.In.Context())
+			auth.SetIdentityHeaders(pr.Out.Header, principal, app.GatewaySecret)
+		},
+		ModifyResponse: func(response *http.Response) error {
+			// the broker answers CORS itself, the headers of the service would be repeated
+			for name := range response.Header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					response.Header.Del(name)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.DeadlineExceeded) {
+				app.errorJSON(w, errors.New("the service took too long to answer, try again later"), http.StatusGatewayTimeout)
+				return
+			}
+			log.Printf("Error forwarding %s %s: %v", r.Method, r.URL.Path, err)
+			app.errorJSON(w, errors.New("the service could not be reached, try again later"), http.StatusBadGateway)
+		},
+	}
+
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), route.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+
+	if route.Authenticated {
+		handler = auth.Middleware(app.Verifier)(handler)
+	} else {
+		handler = app.identify(handler)
+	}
+
+	mux.Handle(route.Prefix, handler)
+	mux.Handle(route.Prefix+"/*", handler)
+}
+
+// identify stores the principal of requests carrying a valid token, and lets the others
+// through anonymously.
+func (app *Config) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := auth.BearerToken(r)
+		if token != "" {
+			principal, err := app.Verifier.Verify(r.Context(), token)
+			if err == nil {
+				r = r.WithContext(auth.NewContext(r.Context(), principal))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"common/auth"
+	"common/authclient"
+	"common/carclient"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// unsignedToken returns a token without kid, which the verifier checks with the
+// authentication service.
+func unsignedToken() string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + encode([]byte(`{"id":7}`)) + ".c2ln"
+}
+
+const gatewaySecret = "gateway-secret"
+
+// newGateway returns the broker in front of a fake service, which accepts the token of
+// unsignedToken and answers other requests with the path and the identity it trusted.
+func newGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	service := httptest.NewServer(auth.TrustedProxy(gatewaySecret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		switch r.URL.Path {
+		case "/check_token":
+			if auth.BearerToken(r) != unsignedToken() {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":true,"message":"invalid token"}`)
+				return
+			}
+			fmt.Fprint(w, `{"error":false,"data":{"user_id":7,"email":"dana@example.com","type":"driver"}}`)
+		case "/cars/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			identity := map[string]string{"path": r.URL.RequestURI()}
+			if principal, ok := auth.FromContext(r.Context()); ok {
+				identity["user_id"] = fmt.Sprint(principal.UserID)
+				identity["type"] = principal.Type
+			}
+			json.NewEncoder(w).Encode(identity)
+		}
+	})))
+	t.Cleanup(service.Close)
+
+	app := &Config{
+		Auth:          authclient.New(service.URL, time.Second),
+		Cars:          carclient.New(service.URL, 50*time.Millisecond),
+		Verifier:      auth.NewVerifier(service.URL),
+		GatewaySecret: gatewaySecret,
+	}
+	broker := httptest.NewServer(app.Routes())
+	t.Cleanup(broker.Close)
+
+	return broker
+}
+
+func get(t *testing.T, url, token string, header http.Header) (*http.Response, map[string]string) {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var body map[string]string
+	json.NewDecoder(response.Body).Decode(&body)
+	return response, body
+}
+
+func TestGatewayForwardsWithTrustedIdentity(t *testing.T) {
+	broker := newGateway(t)
+
+	spoofed := http.Header{auth.HeaderUserID: {"1"}, auth.HeaderUserType: {"admin"}, auth.HeaderGatewaySecret: {"guess"}}
+
+	response, body := get(t, broker.URL+"/api/cars/3?full=1", unsignedToken(), spoofed)
+	if response.StatusCode != http.StatusOK || body["path"] != "/cars/3?full=1" {
+		t.Fatalf("got %d %v, want the request forwarded to /cars/3", response.StatusCode, body)
+	}
+	if body["user_id"] != "7" || body["type"] != "driver" {
+		t.Fatalf("got identity %v, want the one of the token", body)
+	}
+
+	// anonymous requests to the authentication service lose the identity they claim
+	response, body = get(t, broker.URL+"/api/auth/verify_email", "", spoofed)
+	if response.StatusCode != http.StatusOK || body["path"] != "/verify_email" || body["user_id"] != "" {
+		t.Fatalf("got %d %v, want the request forwarded without identity", response.StatusCode, body)
+	}
+}
+
+func TestGatewayRoutesEveryCarServiceEndpoint(t *testing.T) {
+	broker := newGateway(t)
+
+	for _, path := range []string{
+		"/cars/nearby?lat=44.43&lng=26.1",
+		"/car_requests/3/accept",
+		"/driver_car_requests",
+		"/offers/4/decline",
+		"/fare_estimate",
+		"/surge?car_type=standard&city=Bucharest",
+		"/users/me/data",
+	} {
+		response, body := get(t, broker.URL+"/api"+path, unsignedToken(), nil)
+		if response.StatusCode != http.StatusOK || body["path"] != path || body["user_id"] != "7" {
+			t.Fatalf("got %d %v, want the request forwarded to %s with the identity of the token", response.StatusCode, body, path)
+		}
+
+		response, _ = get(t, broker.URL+"/api"+path, "", nil)
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got status %d for %s without token, want 401", response.StatusCode, path)
+		}
+	}
+
+	// only the data of the signed in user is reachable
+	response, _ := get(t, broker.URL+"/api/users/3/data", unsignedToken(), nil)
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("got status %d for the data of another user, want 404", response.StatusCode)
+	}
+}
+
+func TestServicesOnlyTrustIdentityFromTheGateway(t *testing.T) {
+	var trusted *auth.Principal
+	service := auth.TrustedProxy(gatewaySecret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trusted, _ = auth.FromContext(r.Context())
+	}))
+
+	header := http.Header{}
+	auth.SetIdentityHeaders(header, &auth.Principal{UserID: 7, Name: "Dana Ionescu", Type: auth.RoleDriver}, gatewaySecret)
+
+	for secret, want := range map[string]bool{gatewaySecret: true, "guess": false, "": false} {
+		request := httptest.NewRequest(http.MethodGet, "/cars", nil)
+		request.Header = header.Clone()
+		request.Header.Set(auth.HeaderGatewaySecret, secret)
+
+		trusted = nil
+		service.ServeHTTP(httptest.NewRecorder(), request)
+		if got := trusted != nil; got != want {
+			t.Fatalf("got trusted %v with secret %q, want %v", got, secret, want)
+		}
+		if want && (trusted.UserID != 7 || trusted.Name != "Dana Ionescu" || trusted.Type != auth.RoleDriver) {
+			t.Fatalf("got %+v, want the principal set by the gateway", trusted)
+		}
+	}
+}
+
+func TestGatewayRejectsRequestsWithoutToken(t *testing.T) {
+	broker := newGateway(t)
+
+	for _, token := range []string{"", "not-a-token"} {
+		response, _ := get(t, broker.URL+"/api/car_requests", token, nil)
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("got status %d for token %q, want 401", response.StatusCode, token)
+		}
+	}
+}
+
+func TestGatewayAppliesRouteTimeouts(t *testing.T) {
+	broker := newGateway(t)
+
+	response, _ := get(t, broker.URL+"/api/cars/slow", unsignedToken(), nil)
+	if response.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want 504", response.StatusCode)
+	}
+}
+
+func TestGatewayAnswersCORSOnce(t *testing.T) {
+	broker := newGateway(t)
+
+	response, _ := get(t, broker.URL+"/api/auth/verify_email", "", http.Header{"Origin": {"http://localhost:8081"}})
+	if origins := response.Header.Values("Access-Control-Allow-Origin"); len(origins) != 1 {
+		t.Fatalf("got allowed origins %q, want a single one", origins)
+	}
+}
@@ -0,0 +1,638 @@
+package api
+
+import (
+	"common/auth"
+	"common/authclient"
+	"common/carclient"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// DefaultActions returns the actions of the broker: signing in and managing the account in
+// the authentication service, and requesting and driving rides in the car service.
+func DefaultActions() []Action {
+	return []Action{
+		{
+			Name:        "auth",
+			Description: "Signs a user in.",
+			Field:       "auth",
+			Public:      true,
+			Handler:     Handle((*Config).authenticate),
+		},
+		{
+			Name:        "register",
+			Description: "Creates an account, which stays inactive until its email is verified.",
+			Field:       "register",
+			Public:      true,
+			Handler:     Handle((*Config).register),
+		},
+		{
+			Name:        "edit_user",
+			Description: "Changes the profile of the signed in user.",
+			Field:       "update_user",
+			Handler:     Handle((*Config).updateUser),
+		},
+		{
+			Name:        "request_car",
+			Description: "Requests a ride.",
+			Field:       "create_car_request",
+			Permission:  auth.PermRequestRides,
+			Handler:     Handle((*Config).requestCar),
+		},
+		{
+			Name:        "get_car_request",
+			Description: "Returns a car request of the user, or any car request for drivers and support.",
+			Field:       "get_car_request",
+			Handler:     Handle((*Config).getCarRequest),
+		},
+		{
+			Name:        "update_car_request",
+			Description: "Rates a completed ride of the rider.",
+			Field:       "update_car_request",
+			Permission:  auth.PermRequestRides,
+			Handler:     Handle((*Config).updateCarRequest),
+		},
+		{
+			Name:        "cancel_car_request",
+			Description: "Cancels a car request of the rider, a ride of the driver, or any car request for support.",
+			Field:       "cancel_car_request",
+			Handler:     rideStep((*carclient.Client).CancelCarRequest, "Car request cancelled"),
+		},
+		{
+			Name:        "fare_estimate",
+			Description: "Prices a ride between two points, with the current surge multiplier.",
+			Field:       "fare_estimate",
+			Handler:     Handle((*Config).estimateFare),
+		},
+		{
+			Name:        "surge",
+			Description: "Returns the current surge multiplier of rides of a car type in a city.",
+			Field:       "surge",
+			Handler:     Handle((*Config).surge),
+		},
+		{
+			Name:        "nearby_cars",
+			Description: "Lists the available cars around a location, at approximate positions.",
+			Field:       "nearby_cars",
+			Handler:     Handle((*Config).nearbyCars),
+		},
+		{
+			Name:        "accept_car_request",
+			Description: "Assigns a car of the driver to a car request waiting for a driver.",
+			Field:       "accept_car_request",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).acceptCarRequest),
+		},
+		{
+			Name:        "driver_arriving",
+			Description: "Tells the rider that the driver is on the way.",
+			Field:       "driver_arriving",
+			Permission:  auth.PermDriveRides,
+			Handler:     rideStep((*carclient.Client).MarkDriverArriving, "Driver arriving"),
+		},
+		{
+			Name:        "start_ride",
+			Description: "Starts a ride of the driver once the rider is on board.",
+			Field:       "start_ride",
+			Permission:  auth.PermDriveRides,
+			Handler:     rideStep((*carclient.Client).StartRide, "Ride started"),
+		},
+		{
+			Name:        "complete_ride",
+			Description: "Ends a ride of the driver and prices it.",
+			Field:       "complete_ride",
+			Permission:  auth.PermDriveRides,
+			Handler:     rideStep((*carclient.Client).CompleteRide, "Ride completed"),
+		},
+		{
+			Name:        "list_offers",
+			Description: "Lists the rides offered to the driver and waiting for an answer.",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).listOffers),
+		},
+		{
+			Name:        "accept_offer",
+			Description: "Takes the ride of an offer made to the driver.",
+			Field:       "accept_offer",
+			Permission:  auth.PermDriveRides,
+			Handler:     offerAnswer((*carclient.Client).AcceptOffer, "Offer accepted"),
+		},
+		{
+			Name:        "decline_offer",
+			Description: "Turns down an offer made to the driver, which goes to the next driver.",
+			Field:       "decline_offer",
+			Permission:  auth.PermDriveRides,
+			Handler:     offerAnswer((*carclient.Client).DeclineOffer, "Offer declined"),
+		},
+		{
+			Name:        "driver_car_requests",
+			Description: "Lists the car requests the driver accepted, newest first.",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).driverCarRequests),
+		},
+		{
+			Name:        "create_car",
+			Description: "Adds a car to the driver.",
+			Field:       "create_car",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).createCar),
+		},
+		{
+			Name:        "list_cars",
+			Description: "Lists the cars of the driver.",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).listCars),
+		},
+		{
+			Name:        "update_car",
+			Description: "Changes a car of the driver, such as making it active or inactive. Fields left out keep their value.",
+			Field:       "update_car",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).updateCar),
+		},
+		{
+			Name:        "update_car_location",
+			Description: "Stores where a car of the driver is.",
+			Field:       "update_car_location",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).updateCarLocation),
+		},
+		{
+			Name:        "delete_car",
+			Description: "Removes a car of the driver.",
+			Field:       "delete_car",
+			Permission:  auth.PermDriveRides,
+			Handler:     Handle((*Config).deleteCar),
+		},
+	}
+}
+
+// carRequestRef names a car request.
+type carRequestRef struct {
+	ID int `json:"id"`
+}
+
+// carRequestRating rates a car request.
+type carRequestRating struct {
+	ID     int `json:"id"`
+	Rating int `json:"rating"`
+}
+
+// carRequestAcceptance assigns a car to a car request.
+type carRequestAcceptance struct {
+	ID    int `json:"id"`
+	CarID int `json:"car_id"`
+}
+
+// offerRef names an offer.
+type offerRef struct {
+	ID int `json:"id"`
+}
+
+// surgeQuery names the rides to return the surge multiplier of.
+type surgeQuery struct {
+	City    string `json:"city"`
+	CarType string `json:"car_type"`
+}
+
+// nearbyQuery is where to look for available cars.
+type nearbyQuery struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	RadiusKm  *float64 `json:"radius_km"`
+	CarType   string   `json:"car_type,omitempty"`
+}
+
+// carRef names a car.
+type carRef struct {
+	ID int `json:"id"`
+}
+
+// carUpdate changes a car. Fields left out keep their value.
+type carUpdate struct {
+	ID      int     `json:"id"`
+	CarName *string `json:"car_name"`
+	City    *string `json:"city"`
+	CarType *string `json:"car_type"`
+	Active  *bool   `json:"active"`
+}
+
+// carLocation is where a car is.
+type carLocation struct {
+	ID        int     `json:"id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+func (app *Config) Broker(w http.ResponseWriter, r *http.Request) {
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Hit the broker",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// HandleSubmission runs the action named in the submission, once the token of the request
+// and the payload of the action were checked.
+func (app *Config) HandleSubmission(w http.ResponseWriter, r *http.Request) {
+	var submission map[string]json.RawMessage
+	err := app.readJSON(w, r, &submission)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	var name string
+	json.Unmarshal(submission["action"], &name)
+	action, ok := app.Actions.Lookup(name)
+	if !ok {
+		app.errorJSON(w, fmt.Errorf("unknown action %q", name))
+		return
+	}
+
+	// set by the optional authentication middleware when a valid token was sent
+	principal, _ := auth.FromContext(r.Context())
+	if !action.Public && principal == nil {
+		app.errorJSON(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+		return
+	}
+	if action.Permission != "" && !principal.Can(action.Permission) {
+		app.errorJSON(w, fmt.Errorf("%s requires the %s permission", action.Name, action.Permission), http.StatusForbidden)
+		return
+	}
+
+	var raw json.RawMessage
+	if action.Field != "" {
+		raw = submission[action.Field]
+	}
+
+	if problems := action.validate(raw); len(problems) > 0 {
+		payload := jsonResponse{
+			Error:   true,
+			Message: fmt.Sprintf("invalid payload for %s", action.Name),
+			Data:    map[string]any{"errors": problems},
+		}
+		app.writeJSON(w, http.StatusBadRequest, payload)
+		return
+	}
+
+	action.Handler.serve(app, w, r, raw)
+}
+
+// ListActions describes the actions /handle accepts, with the schema of their payload.
+func (app *Config) ListActions(w http.ResponseWriter, r *http.Request) {
+	type actionInfo struct {
+		Name          string  `json:"name"`
+		Description   string  `json:"description"`
+		Field         string  `json:"field,omitempty"`
+		RequiresToken bool    `json:"requires_token"`
+		Permission    string  `json:"permission,omitempty"`
+		Payload       []Field `json:"payload"`
+	}
+
+	actions := []actionInfo{}
+	for _, action := range app.Actions.Actions() {
+		info := actionInfo{
+			Name:          action.Name,
+			Description:   action.Description,
+			Field:         action.Field,
+			RequiresToken: !action.Public,
+			Permission:    action.Permission,
+			Payload:       action.Handler.schema,
+		}
+		if info.Payload == nil {
+			info.Payload = []Field{}
+		}
+		actions = append(actions, info)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Actions retrieved",
+		Data: struct {
+			Actions []actionInfo `json:"actions"`
+		}{actions},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// authenticate signs the user in. The client address is forwarded so that the
+// authentication service throttles failed attempts per client rather than per broker.
+func (app *Config) authenticate(w http.ResponseWriter, r *http.Request, credentials authclient.Credentials) {
+	var clientIP string
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		clientIP = host
+	}
+
+	session, err := app.Auth.Authenticate(r.Context(), credentials, clientIP)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Authenticated"
+	payload.Data = session
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) register(w http.ResponseWriter, r *http.Request, registration authclient.Registration) {
+	user, err := app.Auth.Register(r.Context(), registration)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Registered"
+	payload.Data = user
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) updateUser(w http.ResponseWriter, r *http.Request, update authclient.UserUpdate) {
+	principal := auth.Current(r)
+
+	user, err := app.Auth.UpdateUser(r.Context(), auth.BearerToken(r), principal.UserID, update)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "User updated successfully"
+	payload.Data = user
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) requestCar(w http.ResponseWriter, r *http.Request, request carclient.NewCarRequest) {
+	carRequest, err := app.Cars.CreateCarRequest(r.Context(), auth.BearerToken(r), request)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car request created successfully"
+	payload.Data = carRequest
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) createCar(w http.ResponseWriter, r *http.Request, car carclient.NewCar) {
+	created, err := app.Cars.CreateCar(r.Context(), auth.BearerToken(r), car)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car created successfully"
+	payload.Data = created
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) getCarRequest(w http.ResponseWriter, r *http.Request, ref carRequestRef) {
+	carRequest, err := app.Cars.GetCarRequest(r.Context(), auth.BearerToken(r), ref.ID)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car request retrieved"
+	payload.Data = carRequest
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) updateCarRequest(w http.ResponseWriter, r *http.Request, rating carRequestRating) {
+	update := carclient.CarRequestUpdate{Rating: rating.Rating}
+	carRequest, err := app.Cars.UpdateCarRequest(r.Context(), auth.BearerToken(r), rating.ID, update)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car request updated successfully"
+	payload.Data = carRequest
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) driverCarRequests(w http.ResponseWriter, r *http.Request, _ noPayload) {
+	carRequests, err := app.Cars.ListDriverCarRequests(r.Context(), auth.BearerToken(r))
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car requests retrieved"
+	payload.Data = struct {
+		CarRequests []carclient.CarRequest `json:"car_requests"`
+	}{carRequests}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) listCars(w http.ResponseWriter, r *http.Request, _ noPayload) {
+	cars, err := app.Cars.ListCars(r.Context(), auth.BearerToken(r))
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Cars retrieved"
+	payload.Data = struct {
+		Cars []carclient.Car `json:"cars"`
+	}{cars}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) updateCar(w http.ResponseWriter, r *http.Request, update carUpdate) {
+	change := carclient.CarUpdate{CarName: update.CarName, City: update.City, CarType: update.CarType, Active: update.Active}
+	car, err := app.Cars.UpdateCar(r.Context(), auth.BearerToken(r), update.ID, change)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car updated successfully"
+	payload.Data = car
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) updateCarLocation(w http.ResponseWriter, r *http.Request, location carLocation) {
+	at := carclient.Location{Latitude: location.Latitude, Longitude: location.Longitude}
+	car, err := app.Cars.UpdateCarLocation(r.Context(), auth.BearerToken(r), location.ID, at)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car location updated successfully"
+	payload.Data = car
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) deleteCar(w http.ResponseWriter, r *http.Request, ref carRef) {
+	err := app.Cars.DeleteCar(r.Context(), auth.BearerToken(r), ref.ID)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car deleted successfully"
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) acceptCarRequest(w http.ResponseWriter, r *http.Request, acceptance carRequestAcceptance) {
+	carRequest, err := app.Cars.AcceptCarRequest(r.Context(), auth.BearerToken(r), acceptance.ID, acceptance.CarID)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car request accepted"
+	payload.Data = carRequest
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// rideStep returns the handler of an action moving a car request on with step, which the
+// car service allows or not depending on who asks and the status of the car request.
+func rideStep(step func(c *carclient.Client, ctx context.Context, token string, id int) (*carclient.CarRequest, error), message string) Handler {
+	return Handle(func(app *Config, w http.ResponseWriter, r *http.Request, ref carRequestRef) {
+		carRequest, err := step(app.Cars, r.Context(), auth.BearerToken(r), ref.ID)
+		if err != nil {
+			app.serviceErrorJSON(w, err)
+			return
+		}
+
+		var payload jsonResponse
+		payload.Error = false
+		payload.Message = message
+		payload.Data = carRequest
+
+		app.writeJSON(w, http.StatusAccepted, payload)
+	})
+}
+
+func (app *Config) listOffers(w http.ResponseWriter, r *http.Request, _ noPayload) {
+	offers, err := app.Cars.ListOffers(r.Context(), auth.BearerToken(r))
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Offers retrieved"
+	payload.Data = struct {
+		Offers []carclient.Offer `json:"offers"`
+	}{offers}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// offerAnswer returns the handler of an action answering an offer made to the driver.
+func offerAnswer(answer func(c *carclient.Client, ctx context.Context, token string, id int) error, message string) Handler {
+	return Handle(func(app *Config, w http.ResponseWriter, r *http.Request, ref offerRef) {
+		err := answer(app.Cars, r.Context(), auth.BearerToken(r), ref.ID)
+		if err != nil {
+			app.serviceErrorJSON(w, err)
+			return
+		}
+
+		var payload jsonResponse
+		payload.Error = false
+		payload.Message = message
+
+		app.writeJSON(w, http.StatusAccepted, payload)
+	})
+}
+
+func (app *Config) estimateFare(w http.ResponseWriter, r *http.Request, request carclient.FareRequest) {
+	fare, err := app.Cars.EstimateFare(r.Context(), auth.BearerToken(r), request)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Fare estimated"
+	payload.Data = fare
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) surge(w http.ResponseWriter, r *http.Request, query surgeQuery) {
+	surge, err := app.Cars.GetSurge(r.Context(), auth.BearerToken(r), query.City, query.CarType)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Surge multiplier retrieved"
+	payload.Data = surge
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) nearbyCars(w http.ResponseWriter, r *http.Request, query nearbyQuery) {
+	filter := carclient.NearbyFilter{Latitude: query.Latitude, Longitude: query.Longitude, CarType: query.CarType}
+	if query.RadiusKm != nil {
+		filter.RadiusKm = *query.RadiusKm
+	}
+
+	cars, err := app.Cars.NearbyCars(r.Context(), auth.BearerToken(r), filter)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Nearby cars retrieved"
+	payload.Data = struct {
+		Cars []carclient.NearbyCar `json:"cars"`
+	}{cars}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"common/auth"
+	"common/carclient"
+	"net/http"
+	"strconv"
+)
+
+func (app *Config) GetCarRequests(w http.ResponseWriter, r *http.Request) {
+	activeStr := r.URL.Query().Get("active")
+	active, err := strconv.ParseBool(activeStr)
+	if err != nil {
+		active = true
+	}
+
+	filter := carclient.CarRequestFilter{
+		CarType: r.URL.Query().Get("car_type"),
+		City:    r.URL.Query().Get("city"),
+		Active:  active,
+	}
+
+	carRequests, err := app.Cars.ListCarRequests(r.Context(), auth.BearerToken(r), filter)
+	if err != nil {
+		app.serviceErrorJSON(w, err)
+		return
+	}
+
+	var payload jsonResponse
+	payload.Error = false
+	payload.Message = "Car requests retrieved"
+	payload.Data = struct {
+		CarRequests []carclient.CarRequest `json:"car_requests"`
+	}{carRequests}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
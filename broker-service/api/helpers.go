@@ -0,0 +1,105 @@
+package api
+
+import (
+	"common/apiclient"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type jsonResponse struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (app *Config) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
+	maxBytes := 1048576 //one megabyte
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		return errors.New("body must have only a single JSON value")
+	}
+
+	return nil
+}
+
+func (app *Config) writeJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			w.Header()[key] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (app *Config) errorJSON(w http.ResponseWriter, err error, status ...int) error {
+	statusCode := http.StatusBadRequest
+
+	if len(status) > 0 {
+		statusCode = status[0]
+	}
+
+	var payload jsonResponse
+	payload.Error = true
+	payload.Message = err.Error()
+
+	return app.writeJSON(w, statusCode, payload)
+}
+
+// serviceErrorJSON passes an error answered by the authentication or car service on to the
+// client, and answers failures to reach them with 502 Bad Gateway, or 503 Service
+// Unavailable while their circuit breaker is open.
+func (app *Config) serviceErrorJSON(w http.ResponseWriter, err error) error {
+	if errors.Is(err, apiclient.ErrCircuitOpen) {
+		retryAfter := strconv.Itoa(int(apiclient.DefaultPolicy.Cooldown.Seconds()))
+		payload := jsonResponse{Error: true, Message: "the service is unavailable, try again later"}
+		return app.writeJSON(w, http.StatusServiceUnavailable, payload, http.Header{"Retry-After": {retryAfter}})
+	}
+
+	var serviceErr *apiclient.Error
+	if !errors.As(err, &serviceErr) {
+		log.Println("Error calling service:", err)
+		return app.errorJSON(w, errors.New("the service could not be reached, try again later"), http.StatusBadGateway)
+	}
+
+	payload := jsonResponse{
+		Error:   true,
+		Message: serviceErr.Message,
+	}
+	if len(serviceErr.Data) > 0 {
+		payload.Data = serviceErr.Data
+	}
+
+	// clients throttled by the authentication service learn when to try again
+	var headers []http.Header
+	if retryAfter := serviceErr.Header.Get("Retry-After"); retryAfter != "" {
+		headers = append(headers, http.Header{"Retry-After": {retryAfter}})
+	}
+
+	return app.writeJSON(w, serviceErr.Status, payload, headers...)
+}
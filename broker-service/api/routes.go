@@ -0,0 +1,46 @@
+package api
+
+import (
+	"common/auth"
+	"expvar"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"net/http"
+)
+
+// Routes returns the handler serving every endpoint of the service.
+func (app *Config) Routes() http.Handler {
+	if app.Actions == nil {
+		app.Actions = NewRegistry(DefaultActions()...)
+	}
+	if app.Gateway == nil {
+		app.Gateway = app.DefaultRoutes()
+	}
+
+	mux := chi.NewRouter()
+
+	//specify who is allowed to connect
+	mux.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	mux.Use(middleware.Heartbeat("/ping"))
+
+	mux.Post("/", app.Broker)
+	mux.With(auth.Optional(app.Verifier)).Post("/handle", app.HandleSubmission)
+	mux.Get("/actions", app.ListActions)
+	mux.With(auth.Middleware(app.Verifier)).Get("/car_requests", app.GetCarRequests)
+	mux.With(auth.Middleware(app.Verifier), auth.RequirePermission(auth.PermReadMetrics)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+	for _, route := range app.Gateway {
+		app.mountRoute(mux, route)
+	}
+
+	return mux
+}
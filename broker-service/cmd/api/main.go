@@ -1,28 +1,47 @@
 package main
 
 import (
+	"UberProject/api"
+	"common/auth"
+	"common/authclient"
+	"common/carclient"
 	"fmt"
 	"log"
 	"net/http"
 )
 
-const webPort = "80"
+func main() {
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-type Config struct{}
+	// the verifier shares the client of the authentication service, and with it its
+	// timeout and circuit breaker
+	authClient := authclient.New(settings.AuthServiceURL, settings.AuthServiceTimeout)
+	verifier := auth.NewVerifier(settings.AuthServiceURL)
+	verifier.Auth = authClient
 
-func main() {
-	app := Config{}
+	app := api.Config{
+		Auth:     authClient,
+		Cars:     carclient.New(settings.CarServiceURL, settings.CarServiceTimeout),
+		Verifier: verifier,
+
+		GatewaySecret: settings.GatewaySecret,
+	}
 
-	log.Printf("Starting broker service on port %s\n", webPort)
+	log.Printf("Starting broker service on port %d\n", settings.Port)
 
 	//define http server
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
-		Handler: app.routes(),
+		Addr:         fmt.Sprintf(":%d", settings.Port),
+		Handler:      app.Routes(),
+		ReadTimeout:  settings.ReadTimeout,
+		WriteTimeout: settings.WriteTimeout,
 	}
 
 	//start the server
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if err != nil {
 		log.Panic(err)
 	}
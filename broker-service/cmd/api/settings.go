@@ -0,0 +1,75 @@
+package main
+
+import (
+	"common/config"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// settings configure the broker service. They are read from the YAML file named by
+// CONFIG_FILE, if any, and from the environment variables named by the env tags.
+type settings struct {
+	Port int `yaml:"port" env:"PORT"`
+
+	// AuthServiceURL and CarServiceURL are the base URLs requests are forwarded to.
+	AuthServiceURL string `yaml:"auth_service_url" env:"AUTH_SERVICE_URL"`
+	CarServiceURL  string `yaml:"car_service_url" env:"CAR_SERVICE_URL"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+
+	// UpstreamTimeout bounds every attempt at a request forwarded to another service.
+	// AuthServiceTimeout and CarServiceTimeout, when set, replace it for one service.
+	UpstreamTimeout    time.Duration `yaml:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+	AuthServiceTimeout time.Duration `yaml:"auth_service_timeout" env:"AUTH_SERVICE_TIMEOUT"`
+	CarServiceTimeout  time.Duration `yaml:"car_service_timeout" env:"CAR_SERVICE_TIMEOUT"`
+
+	// GatewaySecret proves to the services that the identity of the requests forwarded by
+	// the gateway was verified here. Without it they verify the token again.
+	GatewaySecret string `yaml:"gateway_secret" env:"GATEWAY_SECRET"`
+}
+
+// loadSettings returns the settings, with the docker-compose ones as defaults.
+func loadSettings() (*settings, error) {
+	s := &settings{
+		Port:            80,
+		AuthServiceURL:  "http://authentication-service",
+		CarServiceURL:   "http://car-service",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		UpstreamTimeout: 10 * time.Second,
+	}
+
+	err := config.Load(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.AuthServiceTimeout == 0 {
+		s.AuthServiceTimeout = s.UpstreamTimeout
+	}
+	if s.CarServiceTimeout == 0 {
+		s.CarServiceTimeout = s.UpstreamTimeout
+	}
+
+	err = errors.Join(
+		config.Port("PORT", s.Port),
+		config.URL("AUTH_SERVICE_URL", s.AuthServiceURL),
+		config.URL("CAR_SERVICE_URL", s.CarServiceURL),
+		config.Positive("READ_TIMEOUT", s.ReadTimeout),
+		config.Positive("WRITE_TIMEOUT", s.WriteTimeout),
+		config.Positive("UPSTREAM_TIMEOUT", s.UpstreamTimeout),
+		config.Positive("AUTH_SERVICE_TIMEOUT", s.AuthServiceTimeout),
+		config.Positive("CAR_SERVICE_TIMEOUT", s.CarServiceTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings:\n%w", err)
+	}
+
+	s.AuthServiceURL = strings.TrimSuffix(s.AuthServiceURL, "/")
+	s.CarServiceURL = strings.TrimSuffix(s.CarServiceURL, "/")
+
+	return s, nil
+}
@@ -1,8 +1,16 @@
 module UberProject
 
-go 1.18
+go 1.21.1
 
 require (
-	github.com/go-chi/chi/v5 v5.0.10 // indirect
-	github.com/go-chi/cors v1.2.1 // indirect
+	common v0.0.0
+	github.com/go-chi/chi/v5 v5.0.10
+	github.com/go-chi/cors v1.2.1
 )
+
+require (
+	github.com/golang-jwt/jwt/v5 v5.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace common => ../common
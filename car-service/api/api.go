@@ -0,0 +1,26 @@
+// Package api holds the HTTP handlers of the car service. The service binary in cmd/api
+// wires them to Postgres, and tests to the in-memory store.
+package api
+
+import (
+	"car-service/data"
+	"car-service/dispatch"
+	"car-service/pricing"
+	"car-service/users"
+	"common/auth"
+	"database/sql"
+)
+
+type Config struct {
+	DB         *sql.DB
+	Models     data.Models
+	Dispatcher *dispatch.Dispatcher
+	Surge      *pricing.SurgeCalculator
+	Verifier   *auth.Verifier
+	Users      *users.Directory
+
+	// GatewaySecret is shared with the broker, whose requests carrying it are authenticated
+	// from the identity headers it set. Every request is authenticated with its token when
+	// it is empty.
+	GatewaySecret string
+}
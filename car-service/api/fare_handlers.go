@@ -0,0 +1,136 @@
+package api
+
+import (
+	"car-service/data"
+	"car-service/pricing"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// SurgeWindow is how far back open car requests count as demand.
+	SurgeWindow = 10 * time.Minute
+
+	// SurgeCacheTTL is how long a computed surge multiplier is reused.
+	SurgeCacheTTL = 30 * time.Second
+)
+
+// FareEstimate prices a ride between two points before the rider requests it.
+func (app *Config) FareEstimate(w http.ResponseWriter, r *http.Request) {
+	var requestPayload struct {
+		City       string   `json:"city"`
+		CarType    string   `json:"car_type"`
+		PickupLat  *float64 `json:"pickup_lat"`
+		PickupLng  *float64 `json:"pickup_lng"`
+		DropoffLat *float64 `json:"dropoff_lat"`
+		DropoffLng *float64 `json:"dropoff_lng"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.PickupLat == nil || !validLocation(requestPayload.PickupLat, requestPayload.PickupLng) ||
+		requestPayload.DropoffLat == nil || !validLocation(requestPayload.DropoffLat, requestPayload.DropoffLng) {
+		app.errorJSON(w, errors.New("valid pickup and dropoff locations are required"), http.StatusBadRequest)
+		return
+	}
+
+	rateCard, err := app.rateCard(requestPayload.City, requestPayload.CarType)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	surge, err := app.Surge.Current(requestPayload.City, requestPayload.CarType)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	fare := pricing.Estimate(rateCard, *requestPayload.PickupLat, *requestPayload.PickupLng,
+		*requestPayload.DropoffLat, *requestPayload.DropoffLng, surge.Multiplier)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The fare has been estimated"),
+		Data:    fare,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// GetSurge returns the surge multiplier currently applied to rides of a city and car type.
+func (app *Config) GetSurge(w http.ResponseWriter, r *http.Request) {
+	city := r.URL.Query().Get("city")
+	carType := r.URL.Query().Get("car_type")
+	if len(city) == 0 || len(carType) == 0 {
+		app.errorJSON(w, errors.New("city and car_type query parameters are required"), http.StatusBadRequest)
+		return
+	}
+
+	surge, err := app.Surge.Current(city, carType)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The surge multiplier has been retrieved"),
+		Data:    surge,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// rateCard returns the rate card for the city and car type, with an error meant for the
+// client when rides are not priced there.
+func (app *Config) rateCard(city, carType string) (*data.RateCard, error) {
+	rateCard, err := app.Models.RateCard.GetRateCard(city, carType)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("there is no rate card for %s rides in %s", carType, city)
+	}
+
+	return rateCard, err
+}
+
+// estimateFare stores the estimated fare, including the surge multiplier already set on the
+// car request, on a car request that has pickup and dropoff locations.
+func (app *Config) estimateFare(carRequest *data.CarRequest) error {
+	if carRequest.PickupLat == nil || carRequest.DropoffLat == nil {
+		return nil
+	}
+
+	rateCard, err := app.rateCard(carRequest.City, carRequest.CarType)
+	if err != nil {
+		return err
+	}
+
+	fare := pricing.Estimate(rateCard, *carRequest.PickupLat, *carRequest.PickupLng,
+		*carRequest.DropoffLat, *carRequest.DropoffLng, carRequest.SurgeMultiplier)
+	carRequest.EstimatedFare = &fare.Total
+	carRequest.Currency = fare.Currency
+
+	return nil
+}
+
+// lockFinalFare computes the final fare of a ride that is about to complete. A missing rate
+// card must not keep the driver from completing the ride, so it is only logged.
+func (app *Config) lockFinalFare(carRequest *data.CarRequest) {
+	rateCard, err := app.rateCard(carRequest.City, carRequest.CarType)
+	if err != nil {
+		log.Printf("No final fare for car request %d: %v\n", carRequest.ID, err)
+		return
+	}
+
+	fare := pricing.Final(rateCard, carRequest, time.Now())
+	carRequest.FinalFare = &fare.Total
+	carRequest.Currency = fare.Currency
+}
@@ -0,0 +1,482 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+func (app *Config) CreateCar(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	var requestPayload struct {
+		UserId  int    `json:"user_id"`
+		CarName string `json:"car_name"`
+		City    string `json:"city"`
+		CarType string `json:"car_type"`
+	}
+
+	//logRequestBody(r)
+
+	err := app.readJSON(w, r, &requestPayload)
+	requestPayload.UserId = userId
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	car := data.Car{
+		UserId:  requestPayload.UserId,
+		CarName: requestPayload.CarName,
+		City:    requestPayload.City,
+		CarType: requestPayload.CarType,
+	}
+
+	_, err = app.Models.Car.InsertCar(car)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Car has been crated"),
+		Data:    car,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) CreateCarRequest(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	var requestPayload struct {
+		UserId     int      `json:"user_id"`
+		CarType    string   `json:"car_type"`
+		City       string   `json:"city"`
+		Address    string   `json:"address"`
+		PickupLat  *float64 `json:"pickup_lat"`
+		PickupLng  *float64 `json:"pickup_lng"`
+		DropoffLat *float64 `json:"dropoff_lat"`
+		DropoffLng *float64 `json:"dropoff_lng"`
+
+		// the surge multiplier the rider was shown and accepted
+		SurgeMultiplier *float64 `json:"surge_multiplier"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !validLocation(requestPayload.PickupLat, requestPayload.PickupLng) {
+		app.errorJSON(w, errors.New("pickup_lat and pickup_lng should be a valid location"), http.StatusBadRequest)
+		return
+	}
+	if !validLocation(requestPayload.DropoffLat, requestPayload.DropoffLng) {
+		app.errorJSON(w, errors.New("dropoff_lat and dropoff_lng should be a valid location"), http.StatusBadRequest)
+		return
+	}
+	requestPayload.UserId = userId
+
+	carRequest := data.CarRequest{
+		UserId:     requestPayload.UserId,
+		UserName:   principal.Name,
+		City:       requestPayload.City,
+		CarType:    requestPayload.CarType,
+		Address:    requestPayload.Address,
+		PickupLat:  requestPayload.PickupLat,
+		PickupLng:  requestPayload.PickupLng,
+		DropoffLat: requestPayload.DropoffLat,
+		DropoffLng: requestPayload.DropoffLng,
+	}
+
+	surge, err := app.Surge.Current(carRequest.City, carRequest.CarType)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if surge.Multiplier > 1 && (requestPayload.SurgeMultiplier == nil || *requestPayload.SurgeMultiplier < surge.Multiplier) {
+		payload := jsonResponse{
+			Error:   true,
+			Message: fmt.Sprintf("Surge pricing is in effect, accept a surge multiplier of %.1f to request the ride", surge.Multiplier),
+			Data:    surge,
+		}
+		app.writeJSON(w, http.StatusConflict, payload)
+		return
+	}
+	carRequest.SurgeMultiplier = surge.Multiplier
+
+	err = app.estimateFare(&carRequest)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	id, err := app.Models.CarRequest.InsertCarRequest(carRequest)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	carRequest.ID = id
+	carRequest.Status = data.StatusRequested
+	carRequest.Active = true
+
+	app.Dispatcher.Dispatch(id)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Car request has been crated"),
+		Data:    carRequest,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) GetAllCarRequests(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	tkUserId := principal.UserID
+
+	carType := r.URL.Query().Get("car_type")
+	city := r.URL.Query().Get("city")
+	activeStr := r.URL.Query().Get("active")
+	active, err := strconv.ParseBool(activeStr)
+	if err != nil {
+		active = true
+	}
+	userId := r.URL.Query().Get("user_id")
+	userIDInt, err := strconv.Atoi(userId)
+	if err != nil {
+		userIDInt = -1
+	}
+
+	fmt.Println("type " + principal.Type + "id_params " + strconv.Itoa(userIDInt) + "id_token " + strconv.Itoa(tkUserId))
+	if !principal.Can(auth.PermReadAllRides) && tkUserId != userIDInt {
+		app.errorJSON(w, errors.New("you do not have the permissions to get those car request"), http.StatusForbidden)
+		return
+	}
+
+	carRequests, err := app.Models.CarRequest.GetAllCarRequestByCity(city, carType, active, userIDInt)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	sort.Slice(carRequests, func(i, j int) bool {
+		return carRequests[i].CreatedAt.After(carRequests[j].CreatedAt)
+	})
+	app.fillUserNames(r, carRequests...)
+
+	type CarRequestsResponse struct {
+		CarRequests []data.CarRequest `json:"car_requests"`
+	}
+
+	// Create a new slice of CarRequest with the same length as carRequests
+	convertedCarRequests := make([]data.CarRequest, len(carRequests))
+
+	// Copy values from carRequests (of type []*CarRequest) to convertedCarRequests
+	for i, cr := range carRequests {
+		convertedCarRequests[i] = *cr
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Car requests have been crated"),
+		Data:    CarRequestsResponse{CarRequests: convertedCarRequests},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) GetAllCars(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+	cars, err := app.Models.Car.GetAllCars(userId)
+
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	type CarsResponse struct {
+		Cars []data.Car `json:"cars"`
+	}
+
+	// Create a new slice of CarRequest with the same length as carRequests
+	convertedCars := make([]data.Car, len(cars))
+
+	// Copy values from carRequests (of type []*CarRequest) to convertedCarRequests
+	for i, cr := range cars {
+		convertedCars[i] = *cr
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Cars have been retrieved"),
+		Data:    CarsResponse{Cars: convertedCars},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// UpdateCar changes a car of the logged in driver. Fields left out of the payload keep their
+// value.
+func (app *Config) UpdateCar(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	var requestPayload struct {
+		CarName *string `json:"car_name"`
+		City    *string `json:"city"`
+		CarType *string `json:"car_type"`
+		Active  *bool   `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	carId := chi.URLParam(r, "id")
+	intCarId, _ := strconv.Atoi(carId)
+	car, err := app.Models.Car.GetCarByID(intCarId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car not found"), http.StatusBadRequest)
+		return
+	}
+
+	if userId != car.UserId {
+		app.errorJSON(w, errors.New("The car does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.CarName != nil {
+		car.CarName = *requestPayload.CarName
+	}
+	if requestPayload.City != nil {
+		car.City = *requestPayload.City
+	}
+	if requestPayload.CarType != nil {
+		car.CarType = *requestPayload.CarType
+	}
+	if requestPayload.Active != nil {
+		car.Active = *requestPayload.Active
+	}
+
+	err = app.Models.Car.Update(car)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car has been updated"),
+		Data:    car,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) UpdateCarRequest(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	var requestPayload struct {
+		Rating int `json:"rating"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	carRequestId := chi.URLParam(r, "id")
+	intCarRequestId, _ := strconv.Atoi(carRequestId)
+	carRequest, err := app.Models.CarRequest.GetCarRequestByID(intCarRequestId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car request not found"), http.StatusBadRequest)
+		return
+	}
+
+	if userId != carRequest.UserId {
+		app.errorJSON(w, errors.New("the car request does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	if carRequest.Status != data.StatusCompleted {
+		app.errorJSON(w, errors.New("only completed rides can be rated"), http.StatusConflict)
+		return
+	}
+
+	if requestPayload.Rating < 1 || requestPayload.Rating > 5 {
+		app.errorJSON(w, errors.New("rating should be between 1 and 5"), http.StatusBadRequest)
+		return
+	}
+
+	carRequest.Rating = requestPayload.Rating
+
+	err = app.Models.CarRequest.Update(carRequest)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	app.fillUserNames(r, carRequest)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car request has been updated"),
+		Data:    carRequest,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) DeleteCar(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	carId := chi.URLParam(r, "id")
+	intCarId, _ := strconv.Atoi(carId)
+	car, err := app.Models.Car.GetCarByID(intCarId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car not found"), http.StatusBadRequest)
+		return
+	}
+
+	if userId != car.UserId {
+		app.errorJSON(w, errors.New("The car does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	ongoing, err := app.Models.Car.HasOngoingRide(car.ID)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	if ongoing {
+		app.errorJSON(w, errors.New("finish the ongoing ride before deleting the car"), http.StatusConflict)
+		return
+	}
+
+	err = app.Models.Car.DeleteCar(car)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car has been deleted"),
+		Data:    nil,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) GetCarRequest(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	carRequestId := chi.URLParam(r, "id")
+	intCarRequestId, _ := strconv.Atoi(carRequestId)
+	carRequest, err := app.Models.CarRequest.GetCarRequestByID(intCarRequestId)
+
+	if err != nil {
+		app.errorJSON(w, errors.New("Car request not found"), http.StatusBadRequest)
+		return
+	}
+
+	if !principal.Can(auth.PermReadAllRides) && userId != carRequest.UserId {
+		app.errorJSON(w, errors.New("The car request does not belong to you"), http.StatusForbidden)
+		return
+	}
+	app.fillUserNames(r, carRequest)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car has been deleted"),
+		Data:    carRequest,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// GetCar returns a car. Where it is and who drives it are only shown to its driver, to the
+// rider of its ongoing ride and to staff reading all rides; others see the car alone.
+func (app *Config) GetCar(w http.ResponseWriter, r *http.Request) {
+	carId := chi.URLParam(r, "id")
+	intCarId, _ := strconv.Atoi(carId)
+	car, err := app.Models.Car.GetCarByID(intCarId)
+
+	if err != nil {
+		app.errorJSON(w, errors.New("Car not found"), http.StatusBadRequest)
+		return
+	}
+
+	canTrack, err := app.canTrackCar(auth.Current(r), car)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	if !canTrack {
+		car.UserId = 0
+		car.Latitude, car.Longitude, car.LocationUpdatedAt = nil, nil, nil
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car has been retrieved"),
+		Data:    car,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+func (app *Config) GetAllDriverCarRequests(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	tkUserId := principal.UserID
+
+	carRequests, err := app.Models.CarRequest.GetAllCarRequestByDriver(tkUserId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	sort.Slice(carRequests, func(i, j int) bool {
+		return carRequests[i].CreatedAt.After(carRequests[j].CreatedAt)
+	})
+	app.fillUserNames(r, carRequests...)
+
+	type CarRequestsResponse struct {
+		CarRequests []data.CarRequest `json:"car_requests"`
+	}
+
+	// Create a new slice of CarRequest with the same length as carRequests
+	convertedCarRequests := make([]data.CarRequest, len(carRequests))
+
+	// Copy values from carRequests (of type []*CarRequest) to convertedCarRequests
+	for i, cr := range carRequests {
+		convertedCarRequests[i] = *cr
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Car requests have been retrieved"),
+		Data:    CarRequestsResponse{CarRequests: convertedCarRequests},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
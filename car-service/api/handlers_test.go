@@ -0,0 +1,202 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRequiresToken(t *testing.T) {
+	app := newTestApp(t)
+
+	app.do(t, "GET", "/car_requests", "", nil).expect(t, http.StatusUnauthorized)
+	app.do(t, "GET", "/car_requests", "not a token", nil).expect(t, http.StatusUnauthorized)
+}
+
+func TestCarsBelongToTheirDriver(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	other := app.auth.token(t, 2, "Otto Other", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	app.do(t, "POST", "/cars", rider, map[string]any{"car_name": "Logan"}).expect(t, http.StatusForbidden)
+	app.do(t, "PUT", fmt.Sprintf("/cars/%d", car.ID), other, map[string]any{"active": false}).expect(t, http.StatusBadRequest)
+	app.do(t, "DELETE", fmt.Sprintf("/cars/%d", car.ID), other, nil).expect(t, http.StatusBadRequest)
+
+	var got data.Car
+	app.do(t, "GET", fmt.Sprintf("/cars/%d", car.ID), driver, nil).expect(t, http.StatusAccepted).decode(t, &got)
+	if !got.Active || got.Latitude == nil || *got.Latitude != 44.43 {
+		t.Fatalf("got car %+v, want it active at 44.43", got)
+	}
+
+	// fields left out of an update keep their value
+	app.do(t, "PUT", fmt.Sprintf("/cars/%d", car.ID), driver, map[string]any{"car_name": "Sandero", "car_type": "comfort"}).
+		expect(t, http.StatusAccepted).decode(t, &got)
+	if got.CarName != "Sandero" || got.CarType != "comfort" || got.City != "Bucharest" || !got.Active {
+		t.Fatalf("got car %+v, want an active comfort Sandero in Bucharest", got)
+	}
+
+	app.do(t, "DELETE", fmt.Sprintf("/cars/%d", car.ID), driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "GET", fmt.Sprintf("/cars/%d", car.ID), rider, nil).expect(t, http.StatusBadRequest)
+}
+
+func TestCarLocationIsPrivate(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+	other := app.auth.token(t, 4, "Olga Other", auth.RoleCustomer)
+	support := app.auth.token(t, 5, "Sam Support", auth.RoleSupport)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43127, 26.10164)
+	path := fmt.Sprintf("/cars/%d", car.ID)
+
+	tracked := func(token string) bool {
+		t.Helper()
+
+		var got data.Car
+		app.do(t, "GET", path, token, nil).expect(t, http.StatusAccepted).decode(t, &got)
+		if got.ID != car.ID {
+			t.Fatalf("got car %+v, want car %d", got, car.ID)
+		}
+		if (got.Latitude == nil) != (got.UserId == 0) || (got.Longitude == nil) != (got.LocationUpdatedAt == nil) {
+			t.Fatalf("got car %+v, want its location and driver both shown or both hidden", got)
+		}
+		return got.Latitude != nil
+	}
+
+	if !tracked(driver) || !tracked(support) {
+		t.Fatal("the driver or support do not see where the car is")
+	}
+	if tracked(rider) || tracked(other) {
+		t.Fatal("riders see where a car is before it takes their ride")
+	}
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", carRequest.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted)
+
+	if !tracked(rider) || tracked(other) {
+		t.Fatal("only the rider of the ongoing ride sees where the car is")
+	}
+
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/cancel", carRequest.ID), rider, nil).expect(t, http.StatusAccepted)
+	if tracked(rider) {
+		t.Fatal("the rider still sees where the car is after the ride ended")
+	}
+
+	var nearby struct {
+		Cars []map[string]any `json:"cars"`
+	}
+	app.do(t, "GET", "/cars/nearby?lat=44.431&lng=26.101&car_type=standard", other, nil).
+		expect(t, http.StatusAccepted).decode(t, &nearby)
+	if len(nearby.Cars) != 1 || nearby.Cars[0]["id"] != float64(car.ID) {
+		t.Fatalf("got nearby cars %+v, want car %d", nearby.Cars, car.ID)
+	}
+	got := nearby.Cars[0]
+	if _, ok := got["user_id"]; ok {
+		t.Fatalf("got nearby car %+v, want it without its driver", got)
+	}
+	if got["latitude"] != 44.431 || got["longitude"] != 26.102 || got["distance_km"] != 0.1 {
+		t.Fatalf("got nearby car %+v, want it at 44.431, 26.102, 0.1 km away", got)
+	}
+}
+
+func TestCreateCarRequest(t *testing.T) {
+	app := newTestApp(t)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+	other := app.auth.token(t, 4, "Olga Other", auth.RoleCustomer)
+
+	invalid := rideIn("Bucharest")
+	invalid["pickup_lat"] = 120.0
+	app.do(t, "POST", "/car_requests", rider, invalid).expect(t, http.StatusBadRequest)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+
+	if carRequest.Status != data.StatusRequested || carRequest.UserName != "Rita Rider" {
+		t.Fatalf("got car request %+v, want it requested by Rita Rider", carRequest)
+	}
+	if carRequest.EstimatedFare == nil || *carRequest.EstimatedFare <= 0 || carRequest.Currency != "RON" {
+		t.Fatalf("got fare %v %s, want a positive estimate in RON", carRequest.EstimatedFare, carRequest.Currency)
+	}
+
+	path := fmt.Sprintf("/car_requests/%d", carRequest.ID)
+	app.do(t, "GET", path, other, nil).expect(t, http.StatusForbidden)
+	app.do(t, "GET", "/car_requests?user_id=3", other, nil).expect(t, http.StatusForbidden)
+
+	var list struct {
+		CarRequests []data.CarRequest `json:"car_requests"`
+	}
+	app.do(t, "GET", "/car_requests?user_id=3", rider, nil).expect(t, http.StatusAccepted).decode(t, &list)
+	if len(list.CarRequests) != 1 || list.CarRequests[0].ID != carRequest.ID {
+		t.Fatalf("got car requests %+v, want only %d", list.CarRequests, carRequest.ID)
+	}
+
+	// unfinished rides can not be rated
+	app.do(t, "PUT", path, rider, map[string]any{"rating": 5}).expect(t, http.StatusConflict)
+}
+
+func TestSupportSeesRiderNames(t *testing.T) {
+	app := newTestApp(t)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+	support := app.auth.token(t, 5, "Sam Support", auth.RoleSupport)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+
+	var got data.CarRequest
+	app.do(t, "GET", fmt.Sprintf("/car_requests/%d", carRequest.ID), support, nil).
+		expect(t, http.StatusAccepted).decode(t, &got)
+	if got.UserName != "Rita Rider" {
+		t.Fatalf("got user name %q, want the one of the auth service", got.UserName)
+	}
+}
+
+func TestFareEstimateAndSurge(t *testing.T) {
+	app := newTestApp(t)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	var fare struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	}
+	app.do(t, "POST", "/fare_estimate", rider, rideIn("Cluj")).expect(t, http.StatusAccepted).decode(t, &fare)
+	if fare.Total <= 0 || fare.Currency != "RON" {
+		t.Fatalf("got fare %+v, want a positive total in RON", fare)
+	}
+
+	// a ride requested while no car is available pushes the multiplier to its maximum
+	app.do(t, "POST", "/car_requests", rider, rideIn("Cluj")).expect(t, http.StatusAccepted)
+
+	var surge struct {
+		Multiplier float64 `json:"surge_multiplier"`
+	}
+	app.do(t, "GET", "/surge?city=Cluj&car_type=standard", rider, nil).expect(t, http.StatusAccepted).decode(t, &surge)
+	if surge.Multiplier <= 1 {
+		t.Fatalf("got surge %v, want more than 1 without any car", surge.Multiplier)
+	}
+
+	app.do(t, "POST", "/car_requests", rider, rideIn("Cluj")).expect(t, http.StatusConflict)
+
+	accepted := rideIn("Cluj")
+	accepted["surge_multiplier"] = surge.Multiplier
+	app.do(t, "POST", "/car_requests", rider, accepted).expect(t, http.StatusAccepted)
+}
+
+// rideIn is the payload of a standard ride across the city.
+func rideIn(city string) map[string]any {
+	return map[string]any{
+		"city":        city,
+		"car_type":    "standard",
+		"address":     "Piata Unirii",
+		"pickup_lat":  44.4268,
+		"pickup_lng":  26.1025,
+		"dropoff_lat": 44.4361,
+		"dropoff_lng": 26.0925,
+	}
+}
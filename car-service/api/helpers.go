@@ -1,12 +1,16 @@
-package main
+package api
 
 import (
 	"bytes"
+	"car-service/data"
+	"car-service/users"
+	"common/auth"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 )
 
@@ -85,3 +89,37 @@ func logRequestBody(r *http.Request) {
 	// Restore the original request body to be able to use it again
 	r.Body = ioutil.NopCloser(ioutil.NopCloser(bytes.NewReader(body)))
 }
+
+// fillUserNames sets the name of the rider on the car requests. Names of other users are
+// looked up in the authentication service with the token of the request; when it can not be
+// reached the names are left empty rather than failing the request.
+func (app *Config) fillUserNames(r *http.Request, carRequests ...*data.CarRequest) {
+	principal := auth.Current(r)
+
+	var ids []int
+	for _, carRequest := range carRequests {
+		switch {
+		case carRequest.UserId == 0:
+			carRequest.UserName = users.DeletedName
+		case carRequest.UserId == principal.UserID:
+			carRequest.UserName = principal.Name
+		default:
+			ids = append(ids, carRequest.UserId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	names, err := app.Users.Names(r.Context(), auth.BearerToken(r), ids)
+	if err != nil {
+		log.Println("Error looking up user names:", err)
+	}
+
+	for _, carRequest := range carRequests {
+		if name, ok := names[carRequest.UserId]; ok && carRequest.UserId != principal.UserID {
+			carRequest.UserName = name
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultNearbyRadiusKm = 5.0
+	maxNearbyRadiusKm     = 50.0
+	maxNearbyCars         = 20
+
+	// nearby cars are shown at positions and distances rounded to about a hundred meters:
+	// a thousandth of a degree of latitude is 111 m
+	nearbyCoordinateScale = 1000
+	nearbyDistanceScale   = 10
+)
+
+// UpdateCarLocation stores the current position reported by the driver of a car.
+func (app *Config) UpdateCarLocation(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+	var requestPayload struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if requestPayload.Latitude == nil || requestPayload.Longitude == nil ||
+		!data.ValidCoordinates(*requestPayload.Latitude, *requestPayload.Longitude) {
+		app.errorJSON(w, errors.New("a valid latitude and longitude are required"), http.StatusBadRequest)
+		return
+	}
+
+	carId := chi.URLParam(r, "id")
+	intCarId, _ := strconv.Atoi(carId)
+	car, err := app.Models.Car.GetCarByID(intCarId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car not found"), http.StatusBadRequest)
+		return
+	}
+
+	if userId != car.UserId {
+		app.errorJSON(w, errors.New("the car does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	err = app.Models.Car.UpdateLocation(car, *requestPayload.Latitude, *requestPayload.Longitude)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car location has been updated"),
+		Data:    car,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// nearbyCar is a car shown to riders looking for one around them. It leaves out who drives
+// the car, and its position and distance are rounded, so that drivers can not be followed.
+type nearbyCar struct {
+	ID         int      `json:"id"`
+	CarName    string   `json:"car_name"`
+	City       string   `json:"city"`
+	CarType    string   `json:"car_type"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+	DistanceKm float64  `json:"distance_km"`
+	ETASeconds int      `json:"eta_seconds"`
+}
+
+// GetNearbyCars returns the available cars closest to the lat/lng query parameters, with
+// their approximate position, distance and estimated time of arrival.
+func (app *Config) GetNearbyCars(w http.ResponseWriter, r *http.Request) {
+	lat, errLat := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(r.URL.Query().Get("lng"), 64)
+	if errLat != nil || errLng != nil || !data.ValidCoordinates(lat, lng) {
+		app.errorJSON(w, errors.New("valid lat and lng query parameters are required"), http.StatusBadRequest)
+		return
+	}
+
+	radius, err := strconv.ParseFloat(r.URL.Query().Get("radius_km"), 64)
+	if err != nil || radius <= 0 {
+		radius = defaultNearbyRadiusKm
+	}
+	if radius > maxNearbyRadiusKm {
+		radius = maxNearbyRadiusKm
+	}
+
+	carType := r.URL.Query().Get("car_type")
+
+	cars, err := app.Models.Car.GetNearestAvailableCars(lat, lng, radius, carType, maxNearbyCars)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	type NearbyCarsResponse struct {
+		Cars []nearbyCar `json:"cars"`
+	}
+
+	nearby := make([]nearbyCar, len(cars))
+	for i, car := range cars {
+		nearby[i] = nearbyCar{
+			ID:         car.ID,
+			CarName:    car.CarName,
+			City:       car.City,
+			CarType:    car.CarType,
+			Latitude:   coarsen(car.Latitude),
+			Longitude:  coarsen(car.Longitude),
+			DistanceKm: math.Round(car.DistanceKm*nearbyDistanceScale) / nearbyDistanceScale,
+			ETASeconds: car.ETASeconds,
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Nearby cars have been retrieved"),
+		Data:    NearbyCarsResponse{Cars: nearby},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// coarsen rounds a coordinate to the precision nearby cars are shown at.
+func coarsen(coordinate *float64) *float64 {
+	if coordinate == nil {
+		return nil
+	}
+
+	rounded := math.Round(*coordinate*nearbyCoordinateScale) / nearbyCoordinateScale
+	return &rounded
+}
+
+// canTrackCar reports whether the principal may see where the car is and who drives it:
+// its driver, the rider of its ongoing ride and staff reading all rides may.
+func (app *Config) canTrackCar(principal *auth.Principal, car *data.Car) (bool, error) {
+	if principal.UserID == car.UserId || principal.Can(auth.PermReadAllRides) {
+		return true, nil
+	}
+
+	// a car request has a car from when it is accepted, and is active until the ride ends
+	carRequests, err := app.Models.CarRequest.GetCarRequestByUser(principal.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, carRequest := range carRequests {
+		if carRequest.CarId.Valid && int(carRequest.CarId.Int64) == car.ID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// validLocation reports whether an optional pair of coordinates is either fully absent or a
+// valid location.
+func validLocation(lat, lng *float64) bool {
+	if lat == nil && lng == nil {
+		return true
+	}
+
+	return lat != nil && lng != nil && data.ValidCoordinates(*lat, *lng)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"car-service/dispatch"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// OfferTimeout is how long a driver has to answer a ride offer before it goes to the next one.
+const OfferTimeout = 20 * time.Second
+
+// GetOffers returns the ride offers waiting for an answer from the logged in driver.
+func (app *Config) GetOffers(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+	type OffersResponse struct {
+		Offers []dispatch.Offer `json:"offers"`
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Offers have been retrieved"),
+		Data:    OffersResponse{Offers: app.Dispatcher.OffersForDriver(userId)},
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// AnswerOffer returns a handler that accepts or declines a ride offer made to the logged in
+// driver.
+func (app *Config) AnswerOffer(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.Current(r)
+		userId := principal.UserID
+		offerId := chi.URLParam(r, "id")
+		intOfferId, _ := strconv.Atoi(offerId)
+
+		err := app.Dispatcher.Respond(intOfferId, userId, accept)
+		if errors.Is(err, dispatch.ErrOfferNotFound) {
+			app.errorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			app.errorJSON(w, err, http.StatusConflict)
+			return
+		}
+
+		message := "The offer has been declined"
+		if accept {
+			message = "The offer has been accepted"
+		}
+
+		payload := jsonResponse{
+			Error:   false,
+			Message: message,
+		}
+
+		app.writeJSON(w, http.StatusAccepted, payload)
+	}
+}
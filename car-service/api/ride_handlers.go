@@ -0,0 +1,188 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// carRequestTTL is how long a car request may wait for a driver before it expires.
+const carRequestTTL = 15 * time.Minute
+
+// AcceptCarRequest assigns one of the logged in driver's cars to a car request that is
+// still waiting for a driver.
+func (app *Config) AcceptCarRequest(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+	var requestPayload struct {
+		CarId int `json:"car_id"`
+	}
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	carRequestId := chi.URLParam(r, "id")
+	intCarRequestId, _ := strconv.Atoi(carRequestId)
+	carRequest, err := app.Models.CarRequest.GetCarRequestByID(intCarRequestId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car request not found"), http.StatusBadRequest)
+		return
+	}
+
+	car, err := app.Models.Car.GetCarByID(requestPayload.CarId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car not found"), http.StatusBadRequest)
+		return
+	}
+
+	if userId != car.UserId {
+		app.errorJSON(w, errors.New("the car does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	if !car.Active {
+		app.errorJSON(w, errors.New("the car is not active"), http.StatusBadRequest)
+		return
+	}
+
+	if car.CarType != carRequest.CarType {
+		app.errorJSON(w, errors.New("the car type does not match the car request"), http.StatusBadRequest)
+		return
+	}
+
+	carRequest.CarId = sql.NullInt64{Int64: int64(car.ID), Valid: true}
+	app.transitionCarRequest(w, r, carRequest, data.StatusAccepted)
+}
+
+// AdvanceCarRequest returns a handler that lets the driver assigned to a car request move
+// the ride forward to the given status (driver arriving, in progress, completed).
+func (app *Config) AdvanceCarRequest(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := auth.Current(r)
+		userId := principal.UserID
+		carRequestId := chi.URLParam(r, "id")
+		intCarRequestId, _ := strconv.Atoi(carRequestId)
+		carRequest, err := app.Models.CarRequest.GetCarRequestByID(intCarRequestId)
+		if err != nil {
+			app.errorJSON(w, errors.New("car request not found"), http.StatusBadRequest)
+			return
+		}
+
+		if !app.isAssignedDriver(carRequest, userId) {
+			app.errorJSON(w, errors.New("the car request is not assigned to one of your cars"), http.StatusBadRequest)
+			return
+		}
+
+		if status == data.StatusCompleted && data.CanTransition(carRequest.Status, status) {
+			app.lockFinalFare(carRequest)
+		}
+
+		app.transitionCarRequest(w, r, carRequest, status)
+	}
+}
+
+// CancelCarRequest cancels a ride on behalf of the rider who requested it or of the driver
+// it is assigned to.
+func (app *Config) CancelCarRequest(w http.ResponseWriter, r *http.Request) {
+	principal := auth.Current(r)
+	userId := principal.UserID
+
+	carRequestId := chi.URLParam(r, "id")
+	intCarRequestId, _ := strconv.Atoi(carRequestId)
+	carRequest, err := app.Models.CarRequest.GetCarRequestByID(intCarRequestId)
+	if err != nil {
+		app.errorJSON(w, errors.New("car request not found"), http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	switch {
+	case userId == carRequest.UserId:
+		status = data.StatusCancelledByRider
+	case principal.Can(auth.PermDriveRides) && app.isAssignedDriver(carRequest, userId):
+		status = data.StatusCancelledByDriver
+	case principal.Can(auth.PermCancelAnyRide):
+		// support staff cancel on behalf of the rider
+		status = data.StatusCancelledByRider
+	default:
+		app.errorJSON(w, errors.New("the car request does not belong to you"), http.StatusBadRequest)
+		return
+	}
+
+	app.transitionCarRequest(w, r, carRequest, status)
+}
+
+// isAssignedDriver reports whether the car assigned to the car request belongs to the user.
+func (app *Config) isAssignedDriver(carRequest *data.CarRequest, userId int) bool {
+	if !carRequest.CarId.Valid {
+		return false
+	}
+
+	car, err := app.Models.Car.GetCarByID(int(carRequest.CarId.Int64))
+	if err != nil {
+		return false
+	}
+
+	return car.UserId == userId
+}
+
+// transitionCarRequest moves the car request to status and writes the updated request,
+// or a conflict error when the transition is not allowed from its current status or its
+// car is on another ride.
+func (app *Config) transitionCarRequest(w http.ResponseWriter, r *http.Request, carRequest *data.CarRequest, status string) {
+	from := carRequest.Status
+
+	err := app.Models.CarRequest.Transition(carRequest, status)
+	if errors.Is(err, data.ErrInvalidTransition) {
+		app.errorJSON(w, fmt.Errorf("the car request can not go from %s to %s", from, status), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, data.ErrCarBusy) {
+		app.errorJSON(w, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		app.errorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// pending offers for the ride are pointless once it left the requested status
+	app.Dispatcher.Withdraw(carRequest.ID)
+	app.fillUserNames(r, carRequest)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("The car request is now %s", status),
+		Data:    carRequest,
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// ExpireCarRequests periodically expires car requests that waited longer than
+// carRequestTTL for a driver. It is meant to run in its own goroutine.
+func (app *Config) ExpireCarRequests() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := app.Models.CarRequest.ExpireCarRequests(time.Now().Add(-carRequestTTL))
+		if err != nil {
+			log.Println("Error expiring car requests:", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("Expired %d car requests\n", expired)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"car-service/data"
+	"car-service/dispatch"
+	"common/auth"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRideLifecycle(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+	path := fmt.Sprintf("/car_requests/%d", carRequest.ID)
+
+	// the ride can not start before a driver accepted it
+	app.do(t, "PUT", path+"/start", driver, nil).expect(t, http.StatusBadRequest)
+
+	var accepted data.CarRequest
+	app.do(t, "PUT", path+"/accept", driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted).decode(t, &accepted)
+	if accepted.Status != data.StatusAccepted || accepted.UserName != "Rita Rider" {
+		t.Fatalf("got car request %+v, want it accepted with the name of the rider", accepted)
+	}
+
+	app.do(t, "PUT", path+"/complete", driver, nil).expect(t, http.StatusConflict)
+	app.do(t, "PUT", path+"/arriving", driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "PUT", path+"/start", driver, nil).expect(t, http.StatusAccepted)
+
+	var completed data.CarRequest
+	app.do(t, "PUT", path+"/complete", driver, nil).expect(t, http.StatusAccepted).decode(t, &completed)
+	if completed.Status != data.StatusCompleted || completed.Active || completed.FinalFare == nil {
+		t.Fatalf("got car request %+v, want it completed with a final fare", completed)
+	}
+
+	app.do(t, "PUT", path+"/cancel", rider, nil).expect(t, http.StatusConflict)
+	app.do(t, "PUT", path, rider, map[string]any{"rating": 6}).expect(t, http.StatusBadRequest)
+
+	var rated data.CarRequest
+	app.do(t, "PUT", path, rider, map[string]any{"rating": 5}).expect(t, http.StatusAccepted).decode(t, &rated)
+	if rated.Rating != 5 {
+		t.Fatalf("got rating %d, want 5", rated.Rating)
+	}
+
+	var driven struct {
+		CarRequests []data.CarRequest `json:"car_requests"`
+	}
+	app.do(t, "GET", "/driver_car_requests", driver, nil).expect(t, http.StatusAccepted).decode(t, &driven)
+	if len(driven.CarRequests) != 1 || driven.CarRequests[0].UserName != "Rita Rider" {
+		t.Fatalf("got driven car requests %+v, want the ride of Rita Rider", driven.CarRequests)
+	}
+}
+
+func TestAcceptChecksTheCar(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	premium := app.activeCar(t, driver, "Bucharest", "premium", 44.43, 26.10)
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var first, second data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &first)
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &second)
+
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", first.ID), driver, map[string]any{"car_id": premium.ID}).
+		expect(t, http.StatusBadRequest)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", first.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", second.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusConflict)
+}
+
+func TestConcurrentAcceptsTakeOneRidePerCar(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var carRequests [8]data.CarRequest
+	for i := range carRequests {
+		// one car per request keeps surge pricing out of the way
+		if i > 0 {
+			app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+		}
+		app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequests[i])
+	}
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, len(carRequests))
+	for _, carRequest := range carRequests {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			statuses <- app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", id), driver, map[string]any{"car_id": car.ID}).Status
+		}(carRequest.ID)
+	}
+	wg.Wait()
+	close(statuses)
+
+	accepted := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusAccepted:
+			accepted++
+		case http.StatusConflict:
+		default:
+			t.Fatalf("got status %d, want 202 or 409", status)
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("the car accepted %d rides at once, want 1", accepted)
+	}
+}
+
+func TestCarOnARideCanNotBeDeleted(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+	path := fmt.Sprintf("/car_requests/%d", carRequest.ID)
+	app.do(t, "PUT", path+"/accept", driver, map[string]any{"car_id": car.ID}).expect(t, http.StatusAccepted)
+
+	app.do(t, "DELETE", fmt.Sprintf("/cars/%d", car.ID), driver, nil).expect(t, http.StatusConflict)
+
+	app.do(t, "PUT", path+"/start", driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "PUT", path+"/complete", driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "DELETE", fmt.Sprintf("/cars/%d", car.ID), driver, nil).expect(t, http.StatusAccepted)
+}
+
+func TestCancelCarRequest(t *testing.T) {
+	app := newTestApp(t)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+	other := app.auth.token(t, 4, "Olga Other", auth.RoleCustomer)
+	support := app.auth.token(t, 5, "Sam Support", auth.RoleSupport)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+
+	// one car per request keeps surge pricing out of the way
+	app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+	app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var first, second data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &first)
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &second)
+
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/cancel", first.ID), other, nil).expect(t, http.StatusBadRequest)
+
+	var cancelled data.CarRequest
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/cancel", first.ID), rider, nil).
+		expect(t, http.StatusAccepted).decode(t, &cancelled)
+	if cancelled.Status != data.StatusCancelledByRider || cancelled.Active {
+		t.Fatalf("got car request %+v, want it cancelled by the rider", cancelled)
+	}
+
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/cancel", second.ID), support, nil).expect(t, http.StatusAccepted)
+}
+
+func TestDispatchOffersRideToNearbyDriver(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.4270, 26.1020)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+
+	var offers struct {
+		Offers []dispatch.Offer `json:"offers"`
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(offers.Offers) == 0 && time.Now().Before(deadline) {
+		app.do(t, "GET", "/offers", driver, nil).expect(t, http.StatusAccepted).decode(t, &offers)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(offers.Offers) != 1 || offers.Offers[0].CarRequestId != carRequest.ID || offers.Offers[0].CarId != car.ID {
+		t.Fatalf("got offers %+v, want one for car request %d", offers.Offers, carRequest.ID)
+	}
+
+	app.do(t, "PUT", fmt.Sprintf("/offers/%d/accept", offers.Offers[0].ID), driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "PUT", fmt.Sprintf("/offers/%d/accept", offers.Offers[0].ID), driver, nil).expect(t, http.StatusNotFound)
+
+	var got data.CarRequest
+	app.do(t, "GET", fmt.Sprintf("/car_requests/%d", carRequest.ID), rider, nil).expect(t, http.StatusAccepted).decode(t, &got)
+	if got.Status != data.StatusAccepted || got.CarId.Int64 != int64(car.ID) {
+		t.Fatalf("got car request %+v, want it accepted with car %d", got, car.ID)
+	}
+}
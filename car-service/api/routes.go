@@ -0,0 +1,72 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"expvar"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"net/http"
+)
+
+// Routes returns the handler serving every endpoint of the service.
+func (app *Config) Routes() http.Handler {
+	mux := chi.NewRouter()
+
+	//specify who is allowed to connect
+	mux.Use(cors.Handler(cors.Options{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE", "PUT", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	mux.Use(middleware.Heartbeat("/ping"))
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(auth.TrustedProxy(app.GatewaySecret), auth.Middleware(app.Verifier))
+
+		// handlers check whether the car request belongs to the user
+		mux.Get("/car_requests", app.GetAllCarRequests)
+		mux.Get("/car_requests/{id:[0-9]+}", app.GetCarRequest)
+		mux.Put("/car_requests/{id:[0-9]+}/cancel", app.CancelCarRequest)
+		mux.Get("/cars/{id:[0-9]+}", app.GetCar)
+		mux.Get("/cars/nearby", app.GetNearbyCars)
+		mux.Post("/fare_estimate", app.FareEstimate)
+		mux.Get("/surge", app.GetSurge)
+		mux.Get("/users/me/data", app.ExportUserData)
+		mux.Delete("/users/me/data", app.DeleteMyData)
+		mux.With(auth.RequirePermission(auth.PermManageUsers)).Delete("/users/{id:[0-9]+}/data", app.DeleteUserData)
+		mux.With(auth.RequirePermission(auth.PermReadMetrics)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(auth.RequirePermission(auth.PermRequestRides))
+
+			mux.Post("/car_requests", app.CreateCarRequest)
+			mux.Put("/car_requests/{id:[0-9]+}", app.UpdateCarRequest)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(auth.RequirePermission(auth.PermDriveRides))
+
+			mux.Post("/cars", app.CreateCar)
+			mux.Get("/cars", app.GetAllCars)
+			mux.Put("/cars/{id:[0-9]+}", app.UpdateCar)
+			mux.Delete("/cars/{id:[0-9]+}", app.DeleteCar)
+			mux.Put("/cars/{id:[0-9]+}/location", app.UpdateCarLocation)
+			mux.Get("/driver_car_requests", app.GetAllDriverCarRequests)
+			mux.Put("/car_requests/{id:[0-9]+}/accept", app.AcceptCarRequest)
+			mux.Put("/car_requests/{id:[0-9]+}/arriving", app.AdvanceCarRequest(data.StatusDriverArriving))
+			mux.Put("/car_requests/{id:[0-9]+}/start", app.AdvanceCarRequest(data.StatusInProgress))
+			mux.Put("/car_requests/{id:[0-9]+}/complete", app.AdvanceCarRequest(data.StatusCompleted))
+			mux.Get("/offers", app.GetOffers)
+			mux.Put("/offers/{id:[0-9]+}/accept", app.AnswerOffer(true))
+			mux.Put("/offers/{id:[0-9]+}/decline", app.AnswerOffer(false))
+		})
+	})
+
+	return mux
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"car-service/data"
+	"car-service/dispatch"
+	"car-service/pricing"
+	"car-service/users"
+	"common/auth"
+	"common/authclient"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeyID is the kid of the key the fake authentication service signs tokens with.
+const testKeyID = "test"
+
+// fakeAuthService stands in for the authentication service: it publishes the key tokens
+// are signed with, an empty revocation list and the names of the users it knows.
+type fakeAuthService struct {
+	*httptest.Server
+	key *ecdsa.PrivateKey
+
+	mu    sync.Mutex
+	names map[int]string
+}
+
+func newFakeAuthService(t *testing.T) *fakeAuthService {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeAuthService{key: key, names: make(map[int]string)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []auth.JSONWebKey{{
+			Kty: "EC",
+			Kid: testKeyID,
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/revoked_tokens", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":false,"data":{"revoked_tokens":[]}}`)
+	})
+	mux.HandleFunc("/users/names", func(w http.ResponseWriter, r *http.Request) {
+		type userName struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		found := []userName{}
+
+		fake.mu.Lock()
+		for _, field := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			id, _ := strconv.Atoi(field)
+			if name, ok := fake.names[id]; ok {
+				found = append(found, userName{ID: id, Name: name})
+			}
+		}
+		fake.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]any{"error": false, "data": map[string]any{"users": found}})
+	})
+
+	fake.Server = httptest.NewServer(mux)
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+// token signs an access token for a user of the given role, and remembers their name.
+func (f *fakeAuthService) token(t *testing.T, userID int, name, role string) string {
+	t.Helper()
+
+	f.mu.Lock()
+	f.names[userID] = name
+	f.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"id":          userID,
+		"username":    name,
+		"email":       fmt.Sprintf("user%d@example.com", userID),
+		"type":        role,
+		"permissions": auth.PermissionsFor(role),
+		"jti":         fmt.Sprintf("token-%d-%d", userID, time.Now().UnixNano()),
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = testKeyID
+
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+// testApp is the service running on in-memory repositories.
+type testApp struct {
+	*Config
+	auth    *fakeAuthService
+	handler http.Handler
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	fakeAuth := newFakeAuthService(t)
+	models := data.NewMemory()
+
+	app := &Config{
+		Models:     models,
+		Dispatcher: dispatch.New(models, time.Second),
+		Surge:      pricing.NewSurgeCalculator(models, SurgeWindow, 0),
+		Verifier:   auth.NewVerifier(fakeAuth.URL),
+		Users:      users.NewDirectory(authclient.New(fakeAuth.URL, time.Second), time.Minute),
+	}
+
+	return &testApp{Config: app, auth: fakeAuth, handler: app.Routes()}
+}
+
+// response is the envelope every handler answers with, with the data left to decode.
+type response struct {
+	Status  int
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do sends a request with the token, when not empty, and a JSON body, when not nil.
+func (a *testApp) do(t *testing.T, method, path, token string, body any) response {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	a.handler.ServeHTTP(recorder, request)
+
+	var resp response
+	err := json.Unmarshal(recorder.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatalf("%s %s answered %d with %q: %v", method, path, recorder.Code, recorder.Body.String(), err)
+	}
+	resp.Status = recorder.Code
+
+	return resp
+}
+
+// decode unmarshals the data of the response into v.
+func (r response) decode(t *testing.T, v any) {
+	t.Helper()
+
+	err := json.Unmarshal(r.Data, v)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", r.Data, err)
+	}
+}
+
+// expect fails the test when the response does not have the given status.
+func (r response) expect(t *testing.T, status int) response {
+	t.Helper()
+
+	if r.Status != status {
+		t.Fatalf("got status %d (%s), want %d", r.Status, r.Message, status)
+	}
+	return r
+}
+
+// activeCar registers an active car of the driver, located at the given point.
+func (a *testApp) activeCar(t *testing.T, token, city, carType string, lat, lng float64) data.Car {
+	t.Helper()
+
+	a.do(t, "POST", "/cars", token, map[string]any{"car_name": "Dacia", "city": city, "car_type": carType}).
+		expect(t, http.StatusAccepted)
+
+	var cars struct {
+		Cars []data.Car `json:"cars"`
+	}
+	a.do(t, "GET", "/cars", token, nil).expect(t, http.StatusAccepted).decode(t, &cars)
+	car := cars.Cars[len(cars.Cars)-1]
+
+	a.do(t, "PUT", fmt.Sprintf("/cars/%d", car.ID), token, map[string]any{"car_name": car.CarName, "city": city, "car_type": carType, "active": true}).
+		expect(t, http.StatusAccepted)
+	a.do(t, "PUT", fmt.Sprintf("/cars/%d/location", car.ID), token, map[string]any{"latitude": lat, "longitude": lng}).
+		expect(t, http.StatusAccepted)
+
+	return car
+}
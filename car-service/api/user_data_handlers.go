@@ -0,0 +1,146 @@
+package api
+
+import (
+	"car-service/data"
+	"common/auth"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// userData is everything the service stores about a user.
+type userData struct {
+	CarRequests       []*data.CarRequest `json:"car_requests"`
+	Cars              []*data.Car        `json:"cars"`
+	DriverCarRequests []*data.CarRequest `json:"driver_car_requests"`
+}
+
+// ExportUserData returns the car requests and cars of the user, past rides included, for the
+// export of their account by the authentication service.
+func (app *Config) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	userId := auth.Current(r).UserID
+
+	carRequests, err := app.Models.CarRequest.GetAllCarRequestsByUser(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	cars, err := app.Models.Car.GetAllCars(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	driverCarRequests, err := app.Models.CarRequest.GetAllCarRequestByDriver(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.fillUserNames(r, carRequests...)
+	app.fillUserNames(r, driverCarRequests...)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprint("User data"),
+		Data: userData{
+			CarRequests:       nonNil(carRequests),
+			Cars:              nonNil(cars),
+			DriverCarRequests: nonNil(driverCarRequests),
+		},
+	}
+
+	app.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteMyData erases the data of the signed in user, whose account is being deleted.
+func (app *Config) DeleteMyData(w http.ResponseWriter, r *http.Request) {
+	app.eraseUserData(w, auth.Current(r).UserID)
+}
+
+// DeleteUserData erases the data of a user deleted by an admin.
+func (app *Config) DeleteUserData(w http.ResponseWriter, r *http.Request) {
+	userId, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	app.eraseUserData(w, userId)
+}
+
+// eraseUserData cancels the rides the user is still waiting for, anonymizes their car
+// requests and deletes their cars. Users in the middle of a ride, as rider or driver, have
+// to finish it first.
+func (app *Config) eraseUserData(w http.ResponseWriter, userId int) {
+	carRequests, err := app.Models.CarRequest.GetCarRequestByUser(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, carRequest := range carRequests {
+		if carRequest.Active && carRequest.Status != data.StatusRequested {
+			app.errorJSON(w, errors.New("finish or cancel the ongoing ride before deleting the account"), http.StatusConflict)
+			return
+		}
+	}
+
+	cars, err := app.Models.Car.GetAllCars(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, car := range cars {
+		ongoing, err := app.Models.Car.HasOngoingRide(car.ID)
+		if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if ongoing {
+			app.errorJSON(w, errors.New("finish the ongoing ride before deleting the account"), http.StatusConflict)
+			return
+		}
+	}
+
+	for _, carRequest := range carRequests {
+		if carRequest.Status != data.StatusRequested {
+			continue
+		}
+
+		err = app.Models.CarRequest.Transition(carRequest, data.StatusCancelledByRider)
+		if err != nil && !errors.Is(err, data.ErrInvalidTransition) {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		app.Dispatcher.Withdraw(carRequest.ID)
+	}
+
+	anonymized, err := app.Models.CarRequest.AnonymizeByUser(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	deleted, err := app.Models.Car.DeleteByUser(userId)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Erased data of user %d: %d car requests anonymized, %d cars deleted\n", userId, anonymized, deleted)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("Anonymized %d car requests and deleted %d cars", anonymized, deleted),
+	}
+
+	app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// nonNil returns an empty slice instead of nil, so that it is exported as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"car-service/data"
+	"car-service/users"
+	"common/auth"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestExportUserData(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", carRequest.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted)
+
+	var exported userData
+	app.do(t, "GET", "/users/me/data", rider, nil).expect(t, http.StatusOK).decode(t, &exported)
+	if len(exported.CarRequests) != 1 || len(exported.Cars) != 0 || len(exported.DriverCarRequests) != 0 {
+		t.Fatalf("got %+v, want only the car request of the rider", exported)
+	}
+
+	app.do(t, "GET", "/users/me/data", driver, nil).expect(t, http.StatusOK).decode(t, &exported)
+	if len(exported.CarRequests) != 0 || len(exported.Cars) != 1 || len(exported.DriverCarRequests) != 1 {
+		t.Fatalf("got %+v, want the car and the driven car request of the driver", exported)
+	}
+}
+
+func TestExportUserDataIncludesCompletedRides(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var carRequest data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &carRequest)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", carRequest.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted)
+	for _, step := range []string{"arriving", "start", "complete"} {
+		app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/%s", carRequest.ID, step), driver, nil).expect(t, http.StatusAccepted)
+	}
+
+	var exported userData
+	app.do(t, "GET", "/users/me/data", rider, nil).expect(t, http.StatusOK).decode(t, &exported)
+	if len(exported.CarRequests) != 1 || exported.CarRequests[0].Status != data.StatusCompleted {
+		t.Fatalf("got %+v, want the completed ride of the rider", exported.CarRequests)
+	}
+
+	app.do(t, "GET", "/users/me/data", driver, nil).expect(t, http.StatusOK).decode(t, &exported)
+	if len(exported.DriverCarRequests) != 1 || exported.DriverCarRequests[0].Status != data.StatusCompleted {
+		t.Fatalf("got %+v, want the completed ride of the driver", exported.DriverCarRequests)
+	}
+}
+
+func TestDeleteMyData(t *testing.T) {
+	app := newTestApp(t)
+	driver := app.auth.token(t, 1, "Dana Driver", auth.RoleDriver)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+
+	car := app.activeCar(t, driver, "Bucharest", "standard", 44.43, 26.10)
+
+	var ongoing, waiting data.CarRequest
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &ongoing)
+	app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/accept", ongoing.ID), driver, map[string]any{"car_id": car.ID}).
+		expect(t, http.StatusAccepted)
+
+	// neither side of an ongoing ride may leave
+	app.do(t, "DELETE", "/users/me/data", rider, nil).expect(t, http.StatusConflict)
+	app.do(t, "DELETE", "/users/me/data", driver, nil).expect(t, http.StatusConflict)
+
+	for _, step := range []string{"arriving", "start", "complete"} {
+		app.do(t, "PUT", fmt.Sprintf("/car_requests/%d/%s", ongoing.ID, step), driver, nil).expect(t, http.StatusAccepted)
+	}
+	app.do(t, "POST", "/car_requests", rider, rideIn("Bucharest")).expect(t, http.StatusAccepted).decode(t, &waiting)
+
+	app.do(t, "DELETE", "/users/me/data", rider, nil).expect(t, http.StatusAccepted)
+
+	var got data.CarRequest
+	app.do(t, "GET", fmt.Sprintf("/car_requests/%d", waiting.ID), driver, nil).expect(t, http.StatusAccepted).decode(t, &got)
+	if got.Status != data.StatusCancelledByRider || got.UserId != 0 || got.UserName != users.DeletedName {
+		t.Fatalf("got car request %+v, want it cancelled and anonymized", got)
+	}
+
+	app.do(t, "DELETE", "/users/me/data", driver, nil).expect(t, http.StatusAccepted)
+	app.do(t, "GET", fmt.Sprintf("/cars/%d", car.ID), driver, nil).expect(t, http.StatusBadRequest)
+}
+
+func TestDeleteUserDataNeedsPermission(t *testing.T) {
+	app := newTestApp(t)
+	rider := app.auth.token(t, 3, "Rita Rider", auth.RoleCustomer)
+	admin := app.auth.token(t, 9, "Ada Admin", auth.RoleAdmin)
+
+	app.do(t, "DELETE", "/users/3/data", rider, nil).expect(t, http.StatusForbidden)
+	app.do(t, "DELETE", "/users/3/data", admin, nil).expect(t, http.StatusAccepted)
+}
@@ -1,7 +1,16 @@
 package main
 
 import (
+	"car-service/api"
 	"car-service/data"
+	"car-service/dispatch"
+	"car-service/migrations"
+	"car-service/pricing"
+	"car-service/users"
+	"common/auth"
+	"common/authclient"
+	"common/migrate"
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/jackc/pgconn"
@@ -13,35 +22,74 @@ import (
 	"time"
 )
 
-const webPort = "80"
+// userNamesTTL is how long the names of users looked up in the authentication service are
+// shown before being looked up again.
+const userNamesTTL = 5 * time.Minute
 
 var counts int64
 
-type Config struct {
-	DB     *sql.DB
-	Models data.Models
-}
-
 func main() {
 	log.Println("Starting car service")
 
+	settings, err := loadSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	//connect to DB
-	conn := connectToDB()
+	conn := connectToDB(settings.DSN)
 	if conn == nil {
 		log.Panic("Can't connect to Postgres!")
 	}
+
+	migrator, err := migrate.New(conn, "car-service", migrations.FS)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrate.Command(context.Background(), migrator, os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = migrate.OnStart(context.Background(), migrator, settings.MigrateOnStart)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	//set up config
-	app := Config{
-		DB:     conn,
-		Models: data.New(conn),
+	authClient := authclient.New(settings.AuthServiceURL, settings.UpstreamTimeout)
+	verifier := auth.NewVerifier(settings.AuthServiceURL)
+	verifier.Auth = authClient
+
+	// The dispatcher keeps pending offers in memory, which is why the car service runs as a
+	// single replica, see docker-compose.yml.
+	models := data.New(conn)
+	app := api.Config{
+		DB:         conn,
+		Models:     models,
+		Dispatcher: dispatch.New(models, api.OfferTimeout),
+		Surge:      pricing.NewSurgeCalculator(models, api.SurgeWindow, api.SurgeCacheTTL),
+		Verifier:   verifier,
+		Users:      users.NewDirectory(authClient, userNamesTTL),
+
+		GatewaySecret: settings.GatewaySecret,
 	}
 
+	go app.ExpireCarRequests()
+
 	srv := http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
-		Handler: app.routes(),
+		Addr:         fmt.Sprintf(":%d", settings.Port),
+		Handler:      app.Routes(),
+		ReadTimeout:  settings.ReadTimeout,
+		WriteTimeout: settings.WriteTimeout,
 	}
 
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if err != nil {
 		log.Panic(err)
 	}
@@ -61,9 +109,7 @@ func openDB(dsn string) (*sql.DB, error) {
 	return db, nil
 }
 
-func connectToDB() *sql.DB {
-	dsn := os.Getenv("DSN")
-
+func connectToDB(dsn string) *sql.DB {
 	//infinite loop till we get the connection
 	for {
 		connetion, err := openDB(dsn)
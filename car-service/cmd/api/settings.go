@@ -0,0 +1,65 @@
+package main
+
+import (
+	"common/config"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// settings configure the car service. They are read from the YAML file named by
+// CONFIG_FILE, if any, and from the environment variables named by the env tags.
+type settings struct {
+	Port int    `yaml:"port" env:"PORT"`
+	DSN  string `yaml:"dsn" env:"DSN"`
+
+	// AuthServiceURL is where tokens are verified and the names of users looked up.
+	AuthServiceURL string `yaml:"auth_service_url" env:"AUTH_SERVICE_URL"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"WRITE_TIMEOUT"`
+
+	// UpstreamTimeout bounds every attempt at a call to the authentication service.
+	UpstreamTimeout time.Duration `yaml:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+
+	// GatewaySecret is the one of the broker, see api.Config.
+	GatewaySecret string `yaml:"gateway_secret" env:"GATEWAY_SECRET"`
+
+	// MigrateOnStart applies pending migrations at startup. Deployments applying them with
+	// the migrate subcommand turn it off, see migrate.OnStart.
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MIGRATE_ON_START"`
+}
+
+// loadSettings returns the settings, with the docker-compose ones as defaults.
+func loadSettings() (*settings, error) {
+	s := &settings{
+		Port:            80,
+		AuthServiceURL:  "http://authentication-service",
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		UpstreamTimeout: 5 * time.Second,
+		MigrateOnStart:  true,
+	}
+
+	err := config.Load(s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = errors.Join(
+		config.Port("PORT", s.Port),
+		config.Required("DSN", s.DSN),
+		config.URL("AUTH_SERVICE_URL", s.AuthServiceURL),
+		config.Positive("READ_TIMEOUT", s.ReadTimeout),
+		config.Positive("WRITE_TIMEOUT", s.WriteTimeout),
+		config.Positive("UPSTREAM_TIMEOUT", s.UpstreamTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings:\n%w", err)
+	}
+
+	s.AuthServiceURL = strings.TrimSuffix(s.AuthServiceURL, "/")
+
+	return s, nil
+}
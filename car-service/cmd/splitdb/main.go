@@ -0,0 +1,289 @@
+// Command splitdb moves the tables of the car service out of the database it used to share
+// with the authentication service, into the database of its own it now uses. It is run once
+// per deployment, while the car service is stopped:
+//
+//	splitdb -source "<shared DSN>" -target "<car service DSN>"
+//
+// The target is migrated to the schema of this binary, then cars, car requests and rate
+// cards are copied over in one transaction. Once the car service runs against the target,
+// run it again with -drop-source to remove the copied tables from the shared database.
+package main
+
+import (
+	"car-service/migrations"
+	"common/migrate"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"log"
+	"strings"
+)
+
+// ownedTables are the tables of the car service, in the order they are copied, with the
+// sequence their ids are taken from.
+var ownedTables = []struct {
+	Name     string
+	Sequence string
+}{
+	{Name: "cars", Sequence: "car_id_seq"},
+	{Name: "car_requests", Sequence: "car_request_id_seq"},
+	{Name: "rate_cards", Sequence: "rate_card_id_seq"},
+}
+
+func main() {
+	source := flag.String("source", "", "DSN of the shared database the tables are moved out of")
+	target := flag.String("target", "", "DSN of the car service database the tables are moved to")
+	dropSource := flag.Bool("drop-source", false, "drop the tables from the shared database, once they were copied")
+	flag.Parse()
+
+	if *source == "" || *target == "" {
+		flag.Usage()
+		log.Fatal("both -source and -target are needed")
+	}
+	if *source == *target {
+		log.Fatal("-source and -target are the same database")
+	}
+
+	ctx := context.Background()
+
+	sourceDB, err := openDB(*source)
+	if err != nil {
+		log.Fatal("source: ", err)
+	}
+	defer sourceDB.Close()
+
+	targetDB, err := openDB(*target)
+	if err != nil {
+		log.Fatal("target: ", err)
+	}
+	defer targetDB.Close()
+
+	if *dropSource {
+		err = drop(ctx, sourceDB, targetDB)
+	} else {
+		err = copyTables(ctx, sourceDB, targetDB)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// copyTables migrates the target and copies the rows of every owned table into it. Columns
+// dropped by migrations the shared database did not get yet, such as car_requests.user_name,
+// are left behind.
+func copyTables(ctx context.Context, sourceDB, targetDB *sql.DB) error {
+	migrator, err := migrate.New(targetDB, "car-service", migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("migrating target: %w", err)
+	}
+
+	// rate cards are left out, the migrations seed them
+	for _, table := range ownedTables[:2] {
+		var count int
+		err = targetDB.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from public.%s`, table.Name)).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("the target already has %d rows in %s, it was split already", count, table.Name)
+		}
+	}
+
+	tx, err := targetDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the rate cards seeded by the migrations are replaced by the ones of the source, which
+	// may have been edited since
+	_, err = tx.ExecContext(ctx, `delete from public.rate_cards`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range ownedTables {
+		copied, err := copyTable(ctx, sourceDB, tx, table.Name)
+		if err != nil {
+			return fmt.Errorf("copying %s: %w", table.Name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`select setval('public.%s', coalesce((select max(id) from public.%s), 0) + 1, false)`,
+			table.Sequence, table.Name))
+		if err != nil {
+			return fmt.Errorf("resetting %s: %w", table.Sequence, err)
+		}
+
+		log.Printf("Copied %d rows of %s\n", copied, table.Name)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Println("Done. Point the car service at the target, then run again with -drop-source")
+	return nil
+}
+
+// copyTable copies every row of the table, for the columns both databases have.
+func copyTable(ctx context.Context, sourceDB *sql.DB, tx *sql.Tx, table string) (int, error) {
+	sourceColumns, err := columns(ctx, sourceDB, table)
+	if err != nil {
+		return 0, err
+	}
+	if len(sourceColumns) == 0 {
+		return 0, fmt.Errorf("the source has no table %s", table)
+	}
+
+	targetColumns, err := columns(ctx, tx, table)
+	if err != nil {
+		return 0, err
+	}
+
+	inSource := make(map[string]bool, len(sourceColumns))
+	for _, column := range sourceColumns {
+		inSource[column] = true
+	}
+
+	var shared []string
+	for _, column := range targetColumns {
+		if inSource[column] {
+			shared = append(shared, column)
+		}
+	}
+
+	list := strings.Join(shared, ", ")
+	placeholders := make([]string, len(shared))
+	for i := range shared {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	rows, err := sourceDB.QueryContext(ctx, fmt.Sprintf(`select %s from public.%s order by id`, list, table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	insert := fmt.Sprintf(`insert into public.%s (%s) values (%s)`, table, list, strings.Join(placeholders, ", "))
+
+	copied := 0
+	for rows.Next() {
+		values := make([]any, len(shared))
+		pointers := make([]any, len(shared))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return copied, err
+		}
+
+		_, err = tx.ExecContext(ctx, insert, values...)
+		if err != nil {
+			return copied, err
+		}
+		copied++
+	}
+
+	return copied, rows.Err()
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// columns returns the columns of the table in the public schema, in table order.
+func columns(ctx context.Context, db querier, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `select column_name from information_schema.columns
+		where table_schema = 'public' and table_name = $1 order by ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// drop removes the owned tables from the shared database, after checking that the target
+// has at least as many rows in each, and forgets the migrations of the car service there.
+func drop(ctx context.Context, sourceDB, targetDB *sql.DB) error {
+	for _, table := range ownedTables {
+		var sourceCount, targetCount int
+		err := sourceDB.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from public.%s`, table.Name)).Scan(&sourceCount)
+		if err != nil {
+			return fmt.Errorf("counting %s in the source: %w", table.Name, err)
+		}
+		err = targetDB.QueryRowContext(ctx, fmt.Sprintf(`select count(*) from public.%s`, table.Name)).Scan(&targetCount)
+		if err != nil {
+			return fmt.Errorf("counting %s in the target: %w", table.Name, err)
+		}
+		if targetCount < sourceCount {
+			return fmt.Errorf("the target has %d rows in %s, the source %d: copy the tables first", targetCount, table.Name, sourceCount)
+		}
+	}
+
+	tx, err := sourceDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range ownedTables {
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`drop table public.%s`, table.Name))
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`drop sequence if exists public.%s`, table.Sequence))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from schema_migrations where service = 'car-service'`)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	log.Println("Dropped the car service tables from the source")
+	return nil
+}
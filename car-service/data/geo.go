@@ -0,0 +1,44 @@
+package data
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	earthRadiusKm = 6371.0
+
+	// averageCitySpeedKmh is the speed used to turn distances into ETAs.
+	averageCitySpeedKmh = 30.0
+
+	// LocationMaxAge is how old the last position of a car may be for it to still be
+	// considered when looking for nearby cars.
+	LocationMaxAge = 5 * time.Minute
+)
+
+// DistanceKm returns the great-circle distance in kilometres between two points given in
+// decimal degrees, using the haversine formula.
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLng := radians(lng2 - lng1)
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Pow(math.Sin(dLng/2), 2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// EstimateETA returns how long a car needs to drive distanceKm through the city.
+func EstimateETA(distanceKm float64) time.Duration {
+	hours := distanceKm / averageCitySpeedKmh
+	return time.Duration(hours * float64(time.Hour)).Round(time.Second)
+}
+
+// ValidCoordinates reports whether lat and lng are a valid latitude and longitude.
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,539 @@
+package data
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewMemory returns repositories keeping their data in memory, for tests exercising the
+// service without a database. They behave like the Postgres ones, down to failing with
+// sql.ErrNoRows, and start with the default rate card seeded by the migrations.
+func NewMemory() Models {
+	store := &memoryStore{
+		carRequests: make(map[int]*CarRequest),
+		cars:        make(map[int]*Car),
+		rateCards: []*RateCard{{
+			ID:          1,
+			City:        "*",
+			CarType:     "*",
+			Currency:    "RON",
+			BaseFare:    500,
+			PerKm:       250,
+			PerMinute:   50,
+			MinimumFare: 1000,
+			BookingFee:  200,
+			CreatedAt:   time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+			UpdatedAt:   time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+		}},
+	}
+
+	return Models{
+		CarRequest: &memoryCarRequests{store},
+		Car:        &memoryCars{store},
+		RateCard:   &memoryRateCards{store},
+	}
+}
+
+// memoryStore holds the rows of every in-memory repository, which need each other's rows
+// the way the Postgres queries join tables. Rows are copied in and out, so that callers
+// only change them through the repositories.
+type memoryStore struct {
+	mu sync.Mutex
+
+	carRequests    map[int]*CarRequest
+	lastCarRequest int
+	cars           map[int]*Car
+	lastCar        int
+	rateCards      []*RateCard
+}
+
+type memoryCarRequests struct {
+	s *memoryStore
+}
+
+type memoryCars struct {
+	s *memoryStore
+}
+
+type memoryRateCards struct {
+	s *memoryStore
+}
+
+// ongoingStatuses are the statuses of a ride keeping its car busy.
+var ongoingStatuses = map[string]bool{
+	StatusAccepted:       true,
+	StatusDriverArriving: true,
+	StatusInProgress:     true,
+}
+
+// sortedCarRequests returns copies of the car requests matching keep, by id.
+func (s *memoryStore) sortedCarRequests(keep func(cr *CarRequest) bool) []*CarRequest {
+	var carRequests []*CarRequest
+	for _, cr := range s.carRequests {
+		if keep(cr) {
+			copied := *cr
+			carRequests = append(carRequests, &copied)
+		}
+	}
+
+	sort.Slice(carRequests, func(i, j int) bool {
+		return carRequests[i].ID < carRequests[j].ID
+	})
+
+	return carRequests
+}
+
+// sortedCars returns copies of the cars matching keep, by id.
+func (s *memoryStore) sortedCars(keep func(c *Car) bool) []*Car {
+	var cars []*Car
+	for _, c := range s.cars {
+		if keep(c) {
+			copied := *c
+			cars = append(cars, &copied)
+		}
+	}
+
+	sort.Slice(cars, func(i, j int) bool {
+		return cars[i].ID < cars[j].ID
+	})
+
+	return cars
+}
+
+// driverBusy reports whether a car of the driver is on a ride.
+func (s *memoryStore) driverBusy(userId int) bool {
+	for _, cr := range s.carRequests {
+		if !cr.CarId.Valid || !ongoingStatuses[cr.Status] {
+			continue
+		}
+		if car, ok := s.cars[int(cr.CarId.Int64)]; ok && car.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// lastRideAt returns when the driver last accepted, completed or cancelled a ride.
+func (s *memoryStore) lastRideAt(userId int) *time.Time {
+	var last *time.Time
+	for _, cr := range s.carRequests {
+		if !cr.CarId.Valid {
+			continue
+		}
+		if car, ok := s.cars[int(cr.CarId.Int64)]; !ok || car.UserId != userId {
+			continue
+		}
+
+		at := cr.CompletedAt
+		if at == nil {
+			at = cr.CancelledAt
+		}
+		if at == nil {
+			at = cr.AcceptedAt
+		}
+		if at != nil && (last == nil || at.After(*last)) {
+			last = at
+		}
+	}
+	return last
+}
+
+func (r *memoryCarRequests) InsertCarRequest(carRequest CarRequest) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.lastCarRequest++
+	now := time.Now()
+
+	carRequest.ID = r.s.lastCarRequest
+	carRequest.UserName = ""
+	carRequest.CarId = sql.NullInt64{}
+	carRequest.Active = true
+	carRequest.Rating = 0
+	carRequest.Status = StatusRequested
+	carRequest.CreatedAt = now
+	carRequest.UpdatedAt = now
+	r.s.carRequests[carRequest.ID] = &carRequest
+
+	return carRequest.ID, nil
+}
+
+func (r *memoryCarRequests) GetCarRequestByID(id int) (*CarRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cr, ok := r.s.carRequests[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *cr
+	return &copied, nil
+}
+
+func (r *memoryCarRequests) GetAllCarRequestByCity(city, carType string, active bool, userId int) ([]*CarRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedCarRequests(func(cr *CarRequest) bool {
+		if userId != -1 {
+			return cr.UserId == userId
+		}
+		return (city == "" || cr.City == city) && (carType == "" || cr.CarType == carType) && cr.Active == active
+	}), nil
+}
+
+func (r *memoryCarRequests) GetCarRequestByUser(userId int) ([]*CarRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedCarRequests(func(cr *CarRequest) bool {
+		return cr.UserId == userId && cr.Active
+	}), nil
+}
+
+func (r *memoryCarRequests) GetAllCarRequestsByUser(userId int) ([]*CarRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedCarRequests(func(cr *CarRequest) bool {
+		return cr.UserId == userId
+	}), nil
+}
+
+func (r *memoryCarRequests) GetAllCarRequestByDriver(userId int) ([]*CarRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedCarRequests(func(cr *CarRequest) bool {
+		if !cr.CarId.Valid {
+			return false
+		}
+		car, ok := r.s.cars[int(cr.CarId.Int64)]
+		return ok && car.UserId == userId
+	}), nil
+}
+
+func (r *memoryCarRequests) Update(carRequest *CarRequest) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.carRequests[carRequest.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.UserId = carRequest.UserId
+	stored.CarType = carRequest.CarType
+	stored.City = carRequest.City
+	stored.Address = carRequest.Address
+	stored.Rating = carRequest.Rating
+	stored.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (r *memoryCarRequests) Transition(carRequest *CarRequest, to string) error {
+	if !CanTransition(carRequest.Status, to) {
+		return ErrInvalidTransition
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.carRequests[carRequest.ID]
+	if !ok || stored.Status != carRequest.Status {
+		return ErrInvalidTransition
+	}
+
+	// like the unique index of the Postgres table
+	if ongoingStatuses[to] && !ongoingStatuses[stored.Status] && carRequest.CarId.Valid &&
+		r.s.hasOngoingRide(int(carRequest.CarId.Int64)) {
+		return ErrCarBusy
+	}
+
+	now := time.Now()
+	stored.CarId = carRequest.CarId
+	stored.FinalFare = carRequest.FinalFare
+	stored.Currency = carRequest.Currency
+	stored.stamp(to, now)
+	carRequest.stamp(to, now)
+
+	return nil
+}
+
+func (r *memoryCarRequests) ExpireCarRequests(createdBefore time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var expired int64
+	now := time.Now()
+	for _, cr := range r.s.carRequests {
+		if cr.Status == StatusRequested && cr.CreatedAt.Before(createdBefore) {
+			cr.stamp(StatusExpired, now)
+			expired++
+		}
+	}
+
+	return expired, nil
+}
+
+func (r *memoryCarRequests) CountOpenCarRequests(city, carType string, since time.Time) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for _, cr := range r.s.carRequests {
+		if cr.City == city && cr.CarType == carType && cr.Status == StatusRequested && cr.CreatedAt.After(since) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *memoryCarRequests) AnonymizeByUser(userId int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var anonymized int64
+	for _, cr := range r.s.carRequests {
+		if cr.UserId != userId {
+			continue
+		}
+
+		cr.UserId = 0
+		cr.Address = ""
+		cr.PickupLat = nil
+		cr.PickupLng = nil
+		cr.DropoffLat = nil
+		cr.DropoffLng = nil
+		cr.UpdatedAt = time.Now()
+		anonymized++
+	}
+
+	return anonymized, nil
+}
+
+func (r *memoryCars) InsertCar(car Car) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.lastCar++
+	now := time.Now()
+
+	stored := Car{
+		ID:        r.s.lastCar,
+		UserId:    car.UserId,
+		CarName:   car.CarName,
+		City:      car.City,
+		CarType:   car.CarType,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.s.cars[stored.ID] = &stored
+
+	return stored.ID, nil
+}
+
+func (r *memoryCars) GetCarByID(id int) (*Car, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	car, ok := r.s.cars[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *car
+	return &copied, nil
+}
+
+func (r *memoryCars) GetAllCars(userId int) ([]*Car, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.sortedCars(func(c *Car) bool {
+		return c.UserId == userId
+	}), nil
+}
+
+func (r *memoryCars) Update(car *Car) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.cars[car.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.UserId = car.UserId
+	stored.CarName = car.CarName
+	stored.City = car.City
+	stored.CarType = car.CarType
+	stored.Active = car.Active
+	stored.UpdatedAt = time.Now()
+
+	return nil
+}
+
+func (r *memoryCars) UpdateLocation(car *Car, lat, lng float64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	car.Latitude = &lat
+	car.Longitude = &lng
+	car.LocationUpdatedAt = &now
+
+	if stored, ok := r.s.cars[car.ID]; ok {
+		stored.Latitude = car.Latitude
+		stored.Longitude = car.Longitude
+		stored.LocationUpdatedAt = car.LocationUpdatedAt
+	}
+
+	return nil
+}
+
+func (r *memoryCars) DeleteCar(car *Car) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.cars, car.ID)
+	return nil
+}
+
+func (r *memoryCars) DeleteByUser(userId int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var deleted int64
+	for id, car := range r.s.cars {
+		if car.UserId == userId {
+			delete(r.s.cars, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryCars) CountAvailableCars(city, carType string) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	count := 0
+	for _, car := range r.s.cars {
+		if car.Active && car.City == city && car.CarType == carType && !r.s.hasOngoingRide(car.ID) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r *memoryCars) HasOngoingRide(carId int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.hasOngoingRide(carId), nil
+}
+
+func (s *memoryStore) hasOngoingRide(carId int) bool {
+	for _, cr := range s.carRequests {
+		if cr.CarId.Valid && int(cr.CarId.Int64) == carId && ongoingStatuses[cr.Status] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryCars) GetDispatchCandidates(city, carType string) ([]*Car, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	cars := r.s.sortedCars(func(c *Car) bool {
+		return c.Active && c.City == city && c.CarType == carType && !r.s.driverBusy(c.UserId)
+	})
+
+	// drivers who waited the longest since their last ride first, those without rides
+	// before everyone else
+	sort.SliceStable(cars, func(i, j int) bool {
+		a, b := r.s.lastRideAt(cars[i].UserId), r.s.lastRideAt(cars[j].UserId)
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.Before(*b)
+	})
+
+	return cars, nil
+}
+
+func (r *memoryCars) GetNearestAvailableCars(lat, lng, radiusKm float64, carType string, limit int) ([]*NearbyCar, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	seenAfter := time.Now().Add(-LocationMaxAge)
+
+	var nearby []*NearbyCar
+	for _, car := range r.s.sortedCars(func(c *Car) bool {
+		return c.Active && (carType == "" || c.CarType == carType) &&
+			c.Latitude != nil && c.Longitude != nil &&
+			c.LocationUpdatedAt != nil && c.LocationUpdatedAt.After(seenAfter) &&
+			!r.s.driverBusy(c.UserId)
+	}) {
+		distance := DistanceKm(lat, lng, *car.Latitude, *car.Longitude)
+		if distance > radiusKm {
+			continue
+		}
+
+		nearby = append(nearby, &NearbyCar{
+			Car:        *car,
+			DistanceKm: distance,
+			ETASeconds: int(EstimateETA(distance).Seconds()),
+		})
+	}
+
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return nearby[i].DistanceKm < nearby[j].DistanceKm
+	})
+	if len(nearby) > limit {
+		nearby = nearby[:limit]
+	}
+
+	return nearby, nil
+}
+
+func (r *memoryRateCards) GetRateCard(city, carType string) (*RateCard, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var best *RateCard
+	bestRank := 4
+	for _, card := range r.s.rateCards {
+		if (card.City != city && card.City != "*") || (card.CarType != carType && card.CarType != "*") {
+			continue
+		}
+
+		// specific cities before specific car types before the catch all
+		rank := 0
+		if card.City == "*" {
+			rank += 2
+		}
+		if card.CarType == "*" {
+			rank++
+		}
+		if rank < bestRank {
+			best, bestRank = card, rank
+		}
+	}
+
+	if best == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *best
+	return &copied, nil
+}
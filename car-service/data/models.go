@@ -3,60 +3,200 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"github.com/jackc/pgconn"
+	"math"
 	"strconv"
 	"time"
 )
 
 const dbTimeout = time.Second * 3
 
-var db *sql.DB
-
 // New is the function used to create an instance of the data package. It returns the type
-// Model, which embeds all the types we want to be available to our application.
+// Model, which embeds all the repositories we want to be available to our application,
+// backed by the Postgres database dbPool.
 func New(dbPool *sql.DB) Models {
-	db = dbPool
-
 	return Models{
-		CarRequest: CarRequest{},
-		Car:        Car{},
+		CarRequest: &postgresCarRequests{db: dbPool},
+		Car:        &postgresCars{db: dbPool},
+		RateCard:   &postgresRateCards{db: dbPool},
 	}
 }
 
-// Models is the type for this package. Note that any model that is included as a member
-// in this type is available to us throughout the application, anywhere that the
-// app variable is used, provided that the model is also added in the New function.
+// Models is the type for this package. Note that any repository that is included as a
+// member in this type is available to us throughout the application, anywhere that the
+// app variable is used, provided that it is also added in the New and NewMemory functions.
 type Models struct {
-	CarRequest CarRequest
-	Car        Car
+	CarRequest CarRequestRepository
+	Car        CarRepository
+	RateCard   RateCardRepository
+}
+
+type postgresCarRequests struct {
+	db *sql.DB
+}
+
+type postgresCars struct {
+	db *sql.DB
+}
+
+type postgresRateCards struct {
+	db *sql.DB
 }
 
 type CarRequest struct {
-	ID        int           `json:"id"`
-	UserId    int           `json:"user_id"`
-	UserName  string        `json:"user_name"`
-	CarType   string        `json:"car_type"`
-	CarId     sql.NullInt64 `json:"car_id"`
-	City      string        `json:"city"`
-	Address   string        `json:"address"`
-	Active    bool          `json:"active"`
-	Rating    int           `json:"rating"`
-	CreatedAt time.Time     `json:"created_at"`
-	UpdatedAt time.Time     `json:"updated_at"`
+	ID       int           `json:"id"`
+	UserId   int           `json:"user_id"`
+	UserName string        `json:"user_name"` // looked up in the authentication service, not stored
+	CarType  string        `json:"car_type"`
+	CarId    sql.NullInt64 `json:"car_id"`
+	City     string        `json:"city"`
+	Address  string        `json:"address"`
+	Active   bool          `json:"active"`
+	Rating   int           `json:"rating"`
+	Status   string        `json:"status"`
+
+	PickupLat  *float64 `json:"pickup_lat,omitempty"`
+	PickupLng  *float64 `json:"pickup_lng,omitempty"`
+	DropoffLat *float64 `json:"dropoff_lat,omitempty"`
+	DropoffLng *float64 `json:"dropoff_lng,omitempty"`
+
+	// fares are in the minor unit of Currency
+	EstimatedFare *int64 `json:"estimated_fare,omitempty"`
+	FinalFare     *int64 `json:"final_fare,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+
+	SurgeMultiplier float64 `json:"surge_multiplier"`
+
+	AcceptedAt       *time.Time `json:"accepted_at,omitempty"`
+	DriverArrivingAt *time.Time `json:"driver_arriving_at,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	ExpiredAt        *time.Time `json:"expired_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type Car struct {
-	ID        int       `json:"id"`
-	UserId    int       `json:"user_id"`
-	CarName   string    `json:"car_name"`
-	City      string    `json:"city"`
-	CarType   string    `json:"car_type"`
-	Active    bool      `json:"active"`
+	ID      int    `json:"id"`
+	UserId  int    `json:"user_id,omitempty"`
+	CarName string `json:"car_name"`
+	City    string `json:"city"`
+	CarType string `json:"car_type"`
+	Active  bool   `json:"active"`
+
+	Latitude          *float64   `json:"latitude,omitempty"`
+	Longitude         *float64   `json:"longitude,omitempty"`
+	LocationUpdatedAt *time.Time `json:"location_updated_at,omitempty"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// NearbyCar is a car found around a location, with its distance and the estimated time
+// it needs to get there.
+type NearbyCar struct {
+	Car
+	DistanceKm float64 `json:"distance_km"`
+	ETASeconds int     `json:"eta_seconds"`
+}
+
+// RateCard holds the prices of rides of one car type in one city. A city or car type of "*"
+// matches any city or car type. Amounts are in the minor unit of Currency.
+type RateCard struct {
+	ID          int       `json:"id"`
+	City        string    `json:"city"`
+	CarType     string    `json:"car_type"`
+	Currency    string    `json:"currency"`
+	BaseFare    int64     `json:"base_fare"`
+	PerKm       int64     `json:"per_km"`
+	PerMinute   int64     `json:"per_minute"`
+	MinimumFare int64     `json:"minimum_fare"`
+	BookingFee  int64     `json:"booking_fee"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// carRequestColumns is the column list selected by every car request query, in the order
+// expected by scanCarRequest.
+const carRequestColumns = `id, user_id, car_type, car_id, city, address, active, rating, status,
+	pickup_lat, pickup_lng, dropoff_lat, dropoff_lng, estimated_fare, final_fare, coalesce(currency, ''), surge_multiplier,
+	accepted_at, driver_arriving_at, started_at, completed_at, cancelled_at, expired_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanCarRequest reads one car request selected with carRequestColumns.
+func scanCarRequest(row rowScanner) (*CarRequest, error) {
+	var carRequest CarRequest
+	err := row.Scan(
+		&carRequest.ID,
+		&carRequest.UserId,
+		&carRequest.CarType,
+		&carRequest.CarId,
+		&carRequest.City,
+		&carRequest.Address,
+		&carRequest.Active,
+		&carRequest.Rating,
+		&carRequest.Status,
+		&carRequest.PickupLat,
+		&carRequest.PickupLng,
+		&carRequest.DropoffLat,
+		&carRequest.DropoffLng,
+		&carRequest.EstimatedFare,
+		&carRequest.FinalFare,
+		&carRequest.Currency,
+		&carRequest.SurgeMultiplier,
+		&carRequest.AcceptedAt,
+		&carRequest.DriverArrivingAt,
+		&carRequest.StartedAt,
+		&carRequest.CompletedAt,
+		&carRequest.CancelledAt,
+		&carRequest.ExpiredAt,
+		&carRequest.CreatedAt,
+		&carRequest.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &carRequest, nil
+}
+
+// carColumns is the column list selected by every car query, in the order expected by scanCar.
+const carColumns = `id, user_id, car_name, city, car_type, active, latitude, longitude, location_updated_at,
+	created_at, updated_at`
+
+// scanCar reads one car selected with carColumns, followed by any extra destinations.
+func scanCar(row rowScanner, extra ...any) (*Car, error) {
+	var car Car
+	dest := []any{
+		&car.ID,
+		&car.UserId,
+		&car.CarName,
+		&car.City,
+		&car.CarType,
+		&car.Active,
+		&car.Latitude,
+		&car.Longitude,
+		&car.LocationUpdatedAt,
+		&car.CreatedAt,
+		&car.UpdatedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &car, nil
+}
+
 // GetAllCarRequestByCity returns active car requests by city and car type
-func (c *CarRequest) GetAllCarRequestByCity(city, carType string, active bool, userId int) ([]*CarRequest, error) {
+func (r *postgresCarRequests) GetAllCarRequestByCity(city, carType string, active bool, userId int) ([]*CarRequest, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -65,39 +205,39 @@ func (c *CarRequest) GetAllCarRequestByCity(city, carType string, active bool, u
 
 	if userId != -1 {
 		query := `
-			SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+			SELECT ` + carRequestColumns + `
 			FROM car_requests
 			WHERE user_id = $1
     	`
-		rows, err = db.QueryContext(ctx, query, userId)
+		rows, err = r.db.QueryContext(ctx, query, userId)
 	} else if len(city) > 0 && len(carType) > 0 {
 		query := `
-			SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+			SELECT ` + carRequestColumns + `
 			FROM car_requests
 			WHERE city = $1 AND car_type = $2 AND active = $3
     	`
-		rows, err = db.QueryContext(ctx, query, city, carType, active)
+		rows, err = r.db.QueryContext(ctx, query, city, carType, active)
 	} else if len(city) > 0 && len(carType) == 0 {
 		query := `
-			SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+			SELECT ` + carRequestColumns + `
 			FROM car_requests
 			WHERE city = $1 AND active = $2
     	`
-		rows, err = db.QueryContext(ctx, query, city, active)
+		rows, err = r.db.QueryContext(ctx, query, city, active)
 	} else if len(city) == 0 && len(carType) > 0 {
 		query := `
-			SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+			SELECT ` + carRequestColumns + `
 			FROM car_requests
 			WHERE car_type = $1 AND active = $2
     	`
-		rows, err = db.QueryContext(ctx, query, carType, active)
+		rows, err = r.db.QueryContext(ctx, query, carType, active)
 	} else {
 		query := `
-			SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+			SELECT ` + carRequestColumns + `
 			FROM car_requests
 			WHERE active = $1
     	`
-		rows, err = db.QueryContext(ctx, query, active)
+		rows, err = r.db.QueryContext(ctx, query, active)
 	}
 
 	if err != nil {
@@ -108,32 +248,19 @@ func (c *CarRequest) GetAllCarRequestByCity(city, carType string, active bool, u
 	var carRequests []*CarRequest
 
 	for rows.Next() {
-		var carRequest CarRequest
-		err := rows.Scan(
-			&carRequest.ID,
-			&carRequest.UserId,
-			&carRequest.UserName,
-			&carRequest.CarType,
-			&carRequest.CarId,
-			&carRequest.City,
-			&carRequest.Address,
-			&carRequest.Active,
-			&carRequest.Rating,
-			&carRequest.CreatedAt,
-			&carRequest.UpdatedAt,
-		)
+		carRequest, err := scanCarRequest(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		carRequests = append(carRequests, &carRequest)
+		carRequests = append(carRequests, carRequest)
 	}
 
 	return carRequests, nil
 }
 
 // GetAllCarRequestByCity returns active car requests by user_id
-func (c *CarRequest) GetCarRequestByUser(userId int) ([]*CarRequest, error) {
+func (r *postgresCarRequests) GetCarRequestByUser(userId int) ([]*CarRequest, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -141,11 +268,11 @@ func (c *CarRequest) GetCarRequestByUser(userId int) ([]*CarRequest, error) {
 	var err error
 
 	query := `
-		SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+		SELECT ` + carRequestColumns + `
 		FROM car_requests
 		WHERE user_id = $1 AND active = true
 	`
-	rows, err = db.QueryContext(ctx, query, userId)
+	rows, err = r.db.QueryContext(ctx, query, userId)
 
 	if err != nil {
 		return nil, err
@@ -155,31 +282,49 @@ func (c *CarRequest) GetCarRequestByUser(userId int) ([]*CarRequest, error) {
 	var carRequests []*CarRequest
 
 	for rows.Next() {
-		var carRequest CarRequest
-		err := rows.Scan(
-			&carRequest.ID,
-			&carRequest.UserId,
-			&carRequest.UserName,
-			&carRequest.CarType,
-			&carRequest.CarId,
-			&carRequest.City,
-			&carRequest.Address,
-			&carRequest.Active,
-			&carRequest.Rating,
-			&carRequest.CreatedAt,
-			&carRequest.UpdatedAt,
-		)
+		carRequest, err := scanCarRequest(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		carRequests = append(carRequests, &carRequest)
+		carRequests = append(carRequests, carRequest)
 	}
 
 	return carRequests, nil
 }
 
-func (u *Car) InsertCar(car Car) (int, error) {
+// GetAllCarRequestsByUser returns every car request of the rider, finished ones included
+func (r *postgresCarRequests) GetAllCarRequestsByUser(userId int) ([]*CarRequest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+		SELECT ` + carRequestColumns + `
+		FROM car_requests
+		WHERE user_id = $1
+		ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var carRequests []*CarRequest
+
+	for rows.Next() {
+		carRequest, err := scanCarRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		carRequests = append(carRequests, carRequest)
+	}
+
+	return carRequests, rows.Err()
+}
+
+func (r *postgresCars) InsertCar(car Car) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -187,7 +332,7 @@ func (u *Car) InsertCar(car Car) (int, error) {
 	stmt := `insert into cars (user_id, city, car_name, car_type, created_at, updated_at)
 		values ($1, $2, $3, $4, $5, $6) returning id`
 
-	err := db.QueryRowContext(ctx, stmt,
+	err := r.db.QueryRowContext(ctx, stmt,
 		car.UserId,
 		car.City,
 		car.CarName,
@@ -203,23 +348,31 @@ func (u *Car) InsertCar(car Car) (int, error) {
 	return newID, nil
 }
 
-func (cr *CarRequest) InsertCarRequest(carRequest CarRequest) (int, error) {
+func (r *postgresCarRequests) InsertCarRequest(carRequest CarRequest) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	var newID int
-	stmt := `INSERT INTO car_requests (user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at)
-             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+	stmt := `INSERT INTO car_requests (user_id, car_type, car_id, city, address, active, rating, status,
+                 pickup_lat, pickup_lng, dropoff_lat, dropoff_lng, estimated_fare, currency, surge_multiplier, created_at, updated_at)
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id`
 
-	err := db.QueryRowContext(ctx, stmt,
+	err := r.db.QueryRowContext(ctx, stmt,
 		carRequest.UserId,
-		carRequest.UserName,
 		carRequest.CarType,
 		nil,
 		carRequest.City,
 		carRequest.Address,
 		true,
 		0,
+		StatusRequested,
+		carRequest.PickupLat,
+		carRequest.PickupLng,
+		carRequest.DropoffLat,
+		carRequest.DropoffLng,
+		carRequest.EstimatedFare,
+		carRequest.Currency,
+		carRequest.SurgeMultiplier,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -232,17 +385,17 @@ func (cr *CarRequest) InsertCarRequest(carRequest CarRequest) (int, error) {
 }
 
 // GetAllCars returns cars by user ID
-func (c *Car) GetAllCars(userId int) ([]*Car, error) {
+func (r *postgresCars) GetAllCars(userId int) ([]*Car, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	query := `
-		SELECT id, user_id, car_name, city, car_type, active, created_at, updated_at
+		SELECT ` + carColumns + `
 		FROM cars
 		WHERE user_id = $1
 	`
 
-	rows, err := db.QueryContext(ctx, query, userId)
+	rows, err := r.db.QueryContext(ctx, query, userId)
 	if err != nil {
 		return nil, err
 	}
@@ -251,58 +404,33 @@ func (c *Car) GetAllCars(userId int) ([]*Car, error) {
 	var cars []*Car
 
 	for rows.Next() {
-		var car Car
-		err := rows.Scan(
-			&car.ID,
-			&car.UserId,
-			&car.CarName,
-			&car.City,
-			&car.CarType,
-			&car.Active,
-			&car.CreatedAt,
-			&car.UpdatedAt,
-		)
+		car, err := scanCar(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		cars = append(cars, &car)
+		cars = append(cars, car)
 	}
 
 	return cars, nil
 }
 
 // GetCarByID retrieves a car by its ID.
-func (c *Car) GetCarByID(id int) (*Car, error) {
+func (r *postgresCars) GetCarByID(id int) (*Car, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	query := `
-        SELECT id, user_id, car_name, city, car_type, created_at, updated_at
+        SELECT ` + carColumns + `
         FROM cars
         WHERE id = $1
     `
 
-	var car Car
-	err := db.QueryRowContext(ctx, query, id).Scan(
-		&car.ID,
-		&car.UserId,
-		&car.CarName,
-		&car.City,
-		&car.CarType,
-		&car.CreatedAt,
-		&car.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &car, nil
+	return scanCar(r.db.QueryRowContext(ctx, query, id))
 }
 
 // Update updates a car's information in the database.
-func (c *Car) Update() error {
+func (r *postgresCars) Update(car *Car) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -318,14 +446,14 @@ func (c *Car) Update() error {
         WHERE id = $7
     `
 
-	_, err := db.ExecContext(ctx, stmt,
-		c.UserId,
-		c.CarName,
-		c.City,
-		c.CarType,
-		c.Active,
+	_, err := r.db.ExecContext(ctx, stmt,
+		car.UserId,
+		car.CarName,
+		car.City,
+		car.CarType,
+		car.Active,
 		time.Now(),
-		c.ID,
+		car.ID,
 	)
 
 	if err != nil {
@@ -336,80 +464,397 @@ func (c *Car) Update() error {
 }
 
 // GetCarRequestByID retrieves a car request by its ID.
-func (cr *CarRequest) GetCarRequestByID(id int) (*CarRequest, error) {
+func (r *postgresCarRequests) GetCarRequestByID(id int) (*CarRequest, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	query := `
-        SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+        SELECT ` + carRequestColumns + `
         FROM car_requests
         WHERE id = $1
     `
 
-	var carRequest CarRequest
-	err := db.QueryRowContext(ctx, query, id).Scan(
-		&carRequest.ID,
-		&carRequest.UserId,
-		&carRequest.UserName,
-		&carRequest.CarType,
-		&carRequest.CarId,
-		&carRequest.City,
-		&carRequest.Address,
-		&carRequest.Active,
-		&carRequest.Rating,
-		&carRequest.CreatedAt,
-		&carRequest.UpdatedAt,
+	return scanCarRequest(r.db.QueryRowContext(ctx, query, id))
+}
+
+// Update updates a car request's information in the database. The ride status, the
+// assigned car and the active flag are only changed through Transition.
+func (r *postgresCarRequests) Update(carRequest *CarRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE car_requests
+        SET
+            user_id = $1,
+            car_type = $2,
+            city = $3,
+            address = $4,
+            rating = $5,
+            updated_at = $6
+        WHERE id = $7
+    `
+
+	_, err := r.db.ExecContext(ctx, stmt,
+		carRequest.UserId,
+		carRequest.CarType,
+		carRequest.City,
+		carRequest.Address,
+		carRequest.Rating,
+		time.Now(),
+		carRequest.ID,
 	)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &carRequest, nil
+	return nil
 }
 
-// Update updates a car request's information in the database.
-func (cr *CarRequest) Update() error {
+// Transition moves the car request to status to, stamping the matching timestamp column
+// and storing the final fare held by carRequest. The update only applies if the row is
+// still in the status held by carRequest, so two concurrent transitions can not both
+// succeed; the loser gets ErrInvalidTransition. Assigning a car already on another ride
+// fails with ErrCarBusy, which a unique index enforces against concurrent accepts.
+func (r *postgresCarRequests) Transition(carRequest *CarRequest, to string) error {
+	if !CanTransition(carRequest.Status, to) {
+		return ErrInvalidTransition
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	stmt := `
         UPDATE car_requests
         SET
-            user_id = $1,
-            user_name = $2,
-            car_type = $3,
-            car_id = $4,
-            city = $5,
-            address = $6,
-            active = $7,
-            rating = $8,
-            updated_at = $9
-        WHERE id = $10
+            status = $1,
+            active = $2,
+            car_id = $3,
+            ` + statusTimestampColumn[to] + ` = $4,
+            updated_at = $4,
+            final_fare = $5,
+            currency = $6
+        WHERE id = $7 AND status = $8
     `
 
-	_, err := db.ExecContext(ctx, stmt,
-		cr.UserId,
-		cr.UserName,
-		cr.CarType,
-		cr.CarId,
-		cr.City,
-		cr.Address,
-		cr.Active,
-		cr.Rating,
-		time.Now(),
-		cr.ID,
+	now := time.Now()
+	active := !IsTerminalStatus(to)
+	result, err := r.db.ExecContext(ctx, stmt,
+		to,
+		active,
+		carRequest.CarId,
+		now,
+		carRequest.FinalFare,
+		carRequest.Currency,
+		carRequest.ID,
+		carRequest.Status,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "car_requests_ongoing_car_id_idx" {
+		return ErrCarBusy
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidTransition
+	}
+
+	carRequest.stamp(to, now)
+
+	return nil
+}
+
+// stamp records in the car request that it reached status to at the given time.
+func (cr *CarRequest) stamp(to string, now time.Time) {
+	cr.Status = to
+	cr.Active = !IsTerminalStatus(to)
+	cr.UpdatedAt = now
+	switch to {
+	case StatusAccepted:
+		cr.AcceptedAt = &now
+	case StatusDriverArriving:
+		cr.DriverArrivingAt = &now
+	case StatusInProgress:
+		cr.StartedAt = &now
+	case StatusCompleted:
+		cr.CompletedAt = &now
+	case StatusCancelledByRider, StatusCancelledByDriver:
+		cr.CancelledAt = &now
+	case StatusExpired:
+		cr.ExpiredAt = &now
+	}
+}
+
+// ExpireCarRequests marks every car request that is still waiting for a driver and was
+// created before the given time as expired. It returns the number of expired requests.
+func (r *postgresCarRequests) ExpireCarRequests(createdBefore time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE car_requests
+        SET status = $1, active = false, expired_at = $2, updated_at = $2
+        WHERE status = $3 AND created_at < $4
+    `
+
+	result, err := r.db.ExecContext(ctx, stmt, StatusExpired, time.Now(), StatusRequested, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// CountOpenCarRequests returns how many car requests of the city and car type created since
+// the given time are still waiting for a driver.
+func (r *postgresCarRequests) CountOpenCarRequests(city, carType string, since time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT COUNT(*) FROM car_requests
+        WHERE city = $1 AND car_type = $2 AND status = $3 AND created_at > $4
+    `
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, city, carType, StatusRequested, since).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountAvailableCars returns how many active cars of the city and car type are not busy
+// with a ride.
+func (r *postgresCars) CountAvailableCars(city, carType string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT COUNT(*) FROM cars c
+        WHERE c.active = true AND c.city = $1 AND c.car_type = $2
+          AND NOT EXISTS (
+              SELECT 1 FROM car_requests r
+              WHERE r.car_id = c.id AND r.status IN ($3, $4, $5)
+          )
+    `
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, city, carType, StatusAccepted, StatusDriverArriving, StatusInProgress).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// HasOngoingRide reports whether the car is assigned to a car request that has been
+// accepted but not yet completed or cancelled.
+func (r *postgresCars) HasOngoingRide(carId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM car_requests
+            WHERE car_id = $1 AND status IN ($2, $3, $4)
+        )
+    `
+
+	var ongoing bool
+	err := r.db.QueryRowContext(ctx, query, carId, StatusAccepted, StatusDriverArriving, StatusInProgress).Scan(&ongoing)
+	if err != nil {
+		return false, err
+	}
+
+	return ongoing, nil
+}
+
+// GetDispatchCandidates returns the active cars of the given city and car type whose driver
+// is not busy with another ride. Cars whose driver has waited the longest since their last
+// ride come first.
+func (r *postgresCars) GetDispatchCandidates(city, carType string) ([]*Car, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT ` + carColumns + `
+        FROM cars c
+        WHERE c.active = true AND c.city = $1 AND c.car_type = $2
+          AND NOT EXISTS (
+              SELECT 1 FROM car_requests r
+              JOIN cars dc ON dc.id = r.car_id
+              WHERE dc.user_id = c.user_id AND r.status IN ($3, $4, $5)
+          )
+        ORDER BY (
+            SELECT MAX(COALESCE(r.completed_at, r.cancelled_at, r.accepted_at))
+            FROM car_requests r
+            JOIN cars dc ON dc.id = r.car_id
+            WHERE dc.user_id = c.user_id
+        ) ASC NULLS FIRST, c.id
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, city, carType, StatusAccepted, StatusDriverArriving, StatusInProgress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cars []*Car
+
+	for rows.Next() {
+		car, err := scanCar(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		cars = append(cars, car)
+	}
+
+	return cars, nil
+}
+
+// GetNearestAvailableCars returns at most limit active cars of the given type (any type
+// when carType is empty) within radiusKm of the location, nearest first. Only cars that reported their position in the
+// last LocationMaxAge and whose driver is not busy with another ride are considered.
+func (r *postgresCars) GetNearestAvailableCars(lat, lng, radiusKm float64, carType string, limit int) ([]*NearbyCar, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	// the bounding box lets postgres use the location index before computing distances
+	latDelta := radiusKm / 111.0
+	lngDelta := radiusKm / (111.0 * math.Max(math.Cos(radians(lat)), 0.01))
+
+	query := `
+        SELECT * FROM (
+            SELECT ` + carColumns + `,
+                2 * 6371 * asin(sqrt(
+                    power(sin(radians(latitude - $1) / 2), 2) +
+                    cos(radians($1)) * cos(radians(latitude)) * power(sin(radians(longitude - $2) / 2), 2)
+                )) AS distance_km
+            FROM cars c
+            WHERE c.active = true AND ($3 = '' OR c.car_type = $3)
+              AND c.latitude BETWEEN $4 AND $5 AND c.longitude BETWEEN $6 AND $7
+              AND c.location_updated_at > $8
+              AND NOT EXISTS (
+                  SELECT 1 FROM car_requests r
+                  JOIN cars dc ON dc.id = r.car_id
+                  WHERE dc.user_id = c.user_id AND r.status IN ($9, $10, $11)
+              )
+        ) nearby
+        WHERE distance_km <= $12
+        ORDER BY distance_km
+        LIMIT $13
+    `
+
+	rows, err := r.db.QueryContext(ctx, query,
+		lat,
+		lng,
+		carType,
+		lat-latDelta,
+		lat+latDelta,
+		lng-lngDelta,
+		lng+lngDelta,
+		time.Now().Add(-LocationMaxAge),
+		StatusAccepted,
+		StatusDriverArriving,
+		StatusInProgress,
+		radiusKm,
+		limit,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cars []*NearbyCar
 
+	for rows.Next() {
+		var distance float64
+		car, err := scanCar(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+
+		cars = append(cars, &NearbyCar{
+			Car:        *car,
+			DistanceKm: distance,
+			ETASeconds: int(EstimateETA(distance).Seconds()),
+		})
+	}
+
+	return cars, nil
+}
+
+// UpdateLocation stores the current position of the car.
+func (r *postgresCars) UpdateLocation(car *Car, lat, lng float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE cars
+        SET latitude = $1, longitude = $2, location_updated_at = $3
+        WHERE id = $4
+    `
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, stmt, lat, lng, now, car.ID)
 	if err != nil {
 		return err
 	}
 
+	car.Latitude = &lat
+	car.Longitude = &lng
+	car.LocationUpdatedAt = &now
+
 	return nil
 }
 
+// GetRateCard returns the rate card for the city and car type, falling back to the "*"
+// rate cards when there is no specific one.
+func (r *postgresRateCards) GetRateCard(city, carType string) (*RateCard, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	query := `
+        SELECT id, city, car_type, currency, base_fare, per_km, per_minute, minimum_fare, booking_fee, created_at, updated_at
+        FROM rate_cards
+        WHERE (city = $1 OR city = '*') AND (car_type = $2 OR car_type = '*')
+        ORDER BY city = '*', car_type = '*'
+        LIMIT 1
+    `
+
+	var rateCard RateCard
+	err := r.db.QueryRowContext(ctx, query, city, carType).Scan(
+		&rateCard.ID,
+		&rateCard.City,
+		&rateCard.CarType,
+		&rateCard.Currency,
+		&rateCard.BaseFare,
+		&rateCard.PerKm,
+		&rateCard.PerMinute,
+		&rateCard.MinimumFare,
+		&rateCard.BookingFee,
+		&rateCard.CreatedAt,
+		&rateCard.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateCard, nil
+}
+
 // DeleteCar deletes a car from the database based on its ID.
-func (c *Car) DeleteCar() error {
+func (r *postgresCars) DeleteCar(car *Car) error {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
@@ -418,7 +863,7 @@ func (c *Car) DeleteCar() error {
         WHERE id = $1
     `
 
-	_, err := db.ExecContext(ctx, query, c.ID)
+	_, err := r.db.ExecContext(ctx, query, car.ID)
 	if err != nil {
 		return err
 	}
@@ -427,35 +872,25 @@ func (c *Car) DeleteCar() error {
 }
 
 // GetAllCarRequestByCity returns active car requests by city and car type
-func (c *CarRequest) GetAllCarRequestByDriver(userId int) ([]*CarRequest, error) {
+func (r *postgresCarRequests) GetAllCarRequestByDriver(userId int) ([]*CarRequest, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
 	defer cancel()
 
 	var cars []*Car
 
 	// Fetch all the cars for the given user ID
-	rows, err := db.QueryContext(ctx, "SELECT id, user_id, car_name, city, car_type, active, created_at, updated_at FROM cars WHERE user_id = $1", userId)
+	rows, err := r.db.QueryContext(ctx, "SELECT "+carColumns+" FROM cars WHERE user_id = $1", userId)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var car Car
-		err := rows.Scan(
-			&car.ID,
-			&car.UserId,
-			&car.CarName,
-			&car.City,
-			&car.CarType,
-			&car.Active,
-			&car.CreatedAt,
-			&car.UpdatedAt,
-		)
+		car, err := scanCar(rows)
 		if err != nil {
 			return nil, err
 		}
-		cars = append(cars, &car)
+		cars = append(cars, car)
 	}
 
 	var carIDs []int
@@ -468,35 +903,22 @@ func (c *CarRequest) GetAllCarRequestByDriver(userId int) ([]*CarRequest, error)
 	// Fetch car requests based on the retrieved car IDs
 	if len(carIDs) > 0 {
 		query := `
-            SELECT id, user_id, user_name, car_type, car_id, city, address, active, rating, created_at, updated_at
+            SELECT ` + carRequestColumns + `
             FROM car_requests
             WHERE car_id IN (` + formatIDs(carIDs) + `)
         `
-		rows, err := db.QueryContext(ctx, query)
+		rows, err := r.db.QueryContext(ctx, query)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 
 		for rows.Next() {
-			var carRequest CarRequest
-			err := rows.Scan(
-				&carRequest.ID,
-				&carRequest.UserId,
-				&carRequest.UserName,
-				&carRequest.CarType,
-				&carRequest.CarId,
-				&carRequest.City,
-				&carRequest.Address,
-				&carRequest.Active,
-				&carRequest.Rating,
-				&carRequest.CreatedAt,
-				&carRequest.UpdatedAt,
-			)
+			carRequest, err := scanCarRequest(rows)
 			if err != nil {
 				return nil, err
 			}
-			carRequests = append(carRequests, &carRequest)
+			carRequests = append(carRequests, carRequest)
 		}
 	}
 
@@ -514,3 +936,44 @@ func formatIDs(ids []int) string {
 	}
 	return formattedIDs
 }
+
+// AnonymizeByUser removes the personal data of the rider from their car requests, which are
+// kept for the history of the drivers and for accounting. It returns the number of car
+// requests anonymized.
+func (r *postgresCarRequests) AnonymizeByUser(userId int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	stmt := `
+        UPDATE car_requests
+        SET
+            user_id = 0,
+            address = '',
+            pickup_lat = NULL,
+            pickup_lng = NULL,
+            dropoff_lat = NULL,
+            dropoff_lng = NULL,
+            updated_at = $1
+        WHERE user_id = $2
+    `
+
+	result, err := r.db.ExecContext(ctx, stmt, time.Now(), userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteByUser deletes every car of the driver. It returns the number of cars deleted.
+func (r *postgresCars) DeleteByUser(userId int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM cars WHERE user_id = $1`, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
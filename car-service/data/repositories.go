@@ -0,0 +1,52 @@
+package data
+
+import "time"
+
+// CarRequestRepository stores car requests and moves them through the ride statuses.
+// Lookups of a car request that does not exist fail with sql.ErrNoRows.
+type CarRequestRepository interface {
+	InsertCarRequest(carRequest CarRequest) (int, error)
+	GetCarRequestByID(id int) (*CarRequest, error)
+
+	// GetAllCarRequestByCity returns the car requests of the user when userId is not -1,
+	// and otherwise those of the city and car type, either of which may be empty to match
+	// any, that are active or not.
+	GetAllCarRequestByCity(city, carType string, active bool, userId int) ([]*CarRequest, error)
+
+	// GetCarRequestByUser returns the active car requests of the rider.
+	GetCarRequestByUser(userId int) ([]*CarRequest, error)
+
+	// GetAllCarRequestsByUser returns every car request of the rider, whatever its status.
+	GetAllCarRequestsByUser(userId int) ([]*CarRequest, error)
+
+	// GetAllCarRequestByDriver returns the car requests assigned to the cars of the driver.
+	GetAllCarRequestByDriver(userId int) ([]*CarRequest, error)
+
+	Update(carRequest *CarRequest) error
+	Transition(carRequest *CarRequest, to string) error
+	ExpireCarRequests(createdBefore time.Time) (int64, error)
+	CountOpenCarRequests(city, carType string, since time.Time) (int, error)
+	AnonymizeByUser(userId int) (int64, error)
+}
+
+// CarRepository stores the cars of drivers and where they are. Lookups of a car that does
+// not exist fail with sql.ErrNoRows.
+type CarRepository interface {
+	InsertCar(car Car) (int, error)
+	GetCarByID(id int) (*Car, error)
+	GetAllCars(userId int) ([]*Car, error)
+	Update(car *Car) error
+	UpdateLocation(car *Car, lat, lng float64) error
+	DeleteCar(car *Car) error
+	DeleteByUser(userId int) (int64, error)
+	CountAvailableCars(city, carType string) (int, error)
+	HasOngoingRide(carId int) (bool, error)
+	GetDispatchCandidates(city, carType string) ([]*Car, error)
+	GetNearestAvailableCars(lat, lng, radiusKm float64, carType string, limit int) ([]*NearbyCar, error)
+}
+
+// RateCardRepository looks up the prices of rides. It fails with sql.ErrNoRows when no
+// rate card matches.
+type RateCardRepository interface {
+	GetRateCard(city, carType string) (*RateCard, error)
+}
@@ -0,0 +1,59 @@
+package data
+
+import "errors"
+
+// Ride statuses a car request moves through during its lifecycle.
+const (
+	StatusRequested         = "requested"
+	StatusAccepted          = "accepted"
+	StatusDriverArriving    = "driver_arriving"
+	StatusInProgress        = "in_progress"
+	StatusCompleted         = "completed"
+	StatusCancelledByRider  = "cancelled_by_rider"
+	StatusCancelledByDriver = "cancelled_by_driver"
+	StatusExpired           = "expired"
+)
+
+// ErrInvalidTransition is returned when a car request can not move from its current status
+// to the requested one, either because the transition is not allowed or because the
+// request was changed by someone else in the meantime.
+var ErrInvalidTransition = errors.New("invalid ride status transition")
+
+// ErrCarBusy is returned when a car request is assigned to a car already on another ride.
+var ErrCarBusy = errors.New("the car is already assigned to another ride")
+
+// rideTransitions lists, for every status, the statuses a car request may move to next.
+// Terminal statuses have no entry.
+var rideTransitions = map[string][]string{
+	StatusRequested:      {StatusAccepted, StatusCancelledByRider, StatusExpired},
+	StatusAccepted:       {StatusDriverArriving, StatusInProgress, StatusCancelledByRider, StatusCancelledByDriver},
+	StatusDriverArriving: {StatusInProgress, StatusCancelledByRider, StatusCancelledByDriver},
+	StatusInProgress:     {StatusCompleted},
+}
+
+// statusTimestampColumn maps a status to the car_requests column recording when it was reached.
+var statusTimestampColumn = map[string]string{
+	StatusAccepted:          "accepted_at",
+	StatusDriverArriving:    "driver_arriving_at",
+	StatusInProgress:        "started_at",
+	StatusCompleted:         "completed_at",
+	StatusCancelledByRider:  "cancelled_at",
+	StatusCancelledByDriver: "cancelled_at",
+	StatusExpired:           "expired_at",
+}
+
+// CanTransition reports whether a car request in status from may move to status to.
+func CanTransition(from, to string) bool {
+	for _, next := range rideTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminalStatus reports whether no further transitions are possible from status.
+func IsTerminalStatus(status string) bool {
+	_, ok := rideTransitions[status]
+	return !ok
+}
@@ -0,0 +1,279 @@
+// Package dispatch matches new car requests with drivers. When a car request is created the
+// dispatcher looks up the free active cars of the requested type, nearest to the pickup
+// point first (or those of the same city when the request has no pickup coordinates),
+// offers the ride to their drivers one at a time in that order and moves on to the next
+// driver when an offer is declined or times out.
+//
+// Pending offers are kept in the memory of the replica that created the car request, and
+// are lost when it restarts: the car service must run as a single replica until they are
+// persisted.
+package dispatch
+
+import (
+	"car-service/data"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOfferNotFound is returned when a driver answers an offer that does not exist, is not
+// addressed to them, or has already timed out.
+var ErrOfferNotFound = errors.New("offer not found")
+
+const (
+	// searchRadiusKm is how far from the pickup point cars are looked for.
+	searchRadiusKm = 10.0
+
+	// maxCandidates caps the number of drivers a single car request is offered to.
+	maxCandidates = 20
+)
+
+// Offer is a car request proposed to a single driver for one of their cars.
+type Offer struct {
+	ID           int       `json:"id"`
+	CarRequestId int       `json:"car_request_id"`
+	CarId        int       `json:"car_id"`
+	DriverId     int       `json:"driver_id"`
+	Rank         int       `json:"rank"`
+	City         string    `json:"city"`
+	Address      string    `json:"address"`
+	CarType      string    `json:"car_type"`
+	PickupLat    *float64  `json:"pickup_lat,omitempty"`
+	PickupLng    *float64  `json:"pickup_lng,omitempty"`
+	DistanceKm   float64   `json:"distance_km,omitempty"`
+	ETASeconds   int       `json:"eta_seconds,omitempty"`
+	OfferedAt    time.Time `json:"offered_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+
+	answers chan answer
+}
+
+// answer is a driver's reply to an offer. The dispatcher reports the outcome of an
+// acceptance on result.
+type answer struct {
+	accept bool
+	result chan error
+}
+
+// Dispatcher offers car requests to drivers.
+type Dispatcher struct {
+	Models       data.Models
+	OfferTimeout time.Duration
+
+	mu       sync.Mutex
+	nextID   int
+	offers   map[int]*Offer
+	inFlight map[int]context.CancelFunc
+}
+
+// New returns a dispatcher that gives every driver offerTimeout to answer an offer.
+func New(models data.Models, offerTimeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		Models:       models,
+		OfferTimeout: offerTimeout,
+		offers:       make(map[int]*Offer),
+		inFlight:     make(map[int]context.CancelFunc),
+	}
+}
+
+// Dispatch starts offering the car request to drivers in the background.
+func (d *Dispatcher) Dispatch(carRequestId int) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d.mu.Lock()
+	if _, ok := d.inFlight[carRequestId]; ok {
+		d.mu.Unlock()
+		cancel()
+		return
+	}
+	d.inFlight[carRequestId] = cancel
+	d.mu.Unlock()
+
+	go func() {
+		defer d.Withdraw(carRequestId)
+		d.run(ctx, carRequestId)
+	}()
+}
+
+// Withdraw stops dispatching the car request, for instance because the rider cancelled it.
+func (d *Dispatcher) Withdraw(carRequestId int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cancel, ok := d.inFlight[carRequestId]; ok {
+		cancel()
+		delete(d.inFlight, carRequestId)
+	}
+}
+
+// OffersForDriver returns the offers currently waiting for an answer from the driver.
+func (d *Dispatcher) OffersForDriver(driverId int) []Offer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	offers := []Offer{}
+	for _, offer := range d.offers {
+		if offer.DriverId == driverId {
+			offers = append(offers, *offer)
+		}
+	}
+
+	return offers
+}
+
+// Respond records the driver's answer to an offer. When the offer is accepted it returns
+// once the car request has been assigned, or with the reason the assignment failed.
+func (d *Dispatcher) Respond(offerId, driverId int, accept bool) error {
+	d.mu.Lock()
+	offer, ok := d.offers[offerId]
+	if !ok || offer.DriverId != driverId {
+		d.mu.Unlock()
+		return ErrOfferNotFound
+	}
+
+	// the answer is queued while holding the lock so that an offer timing out at the same
+	// moment either sees it or is already gone
+	delete(d.offers, offerId)
+	reply := answer{accept: accept, result: make(chan error, 1)}
+	offer.answers <- reply
+	d.mu.Unlock()
+
+	if !accept {
+		return nil
+	}
+
+	return <-reply.result
+}
+
+// run offers the car request to each candidate in turn until one of them accepts it, the
+// request leaves the requested status, or there are no candidates left.
+func (d *Dispatcher) run(ctx context.Context, carRequestId int) {
+	carRequest, err := d.Models.CarRequest.GetCarRequestByID(carRequestId)
+	if err != nil {
+		log.Printf("dispatch: car request %d: %v\n", carRequestId, err)
+		return
+	}
+
+	candidates, err := d.candidates(carRequest)
+	if err != nil {
+		log.Printf("dispatch: car request %d: %v\n", carRequestId, err)
+		return
+	}
+
+	offered := make(map[int]bool)
+	for _, car := range candidates {
+		// drivers with several cars only get the ride offered once
+		if offered[car.UserId] {
+			continue
+		}
+		offered[car.UserId] = true
+
+		// the request may have been cancelled or accepted through another path
+		carRequest, err = d.Models.CarRequest.GetCarRequestByID(carRequestId)
+		if err != nil || carRequest.Status != data.StatusRequested {
+			return
+		}
+
+		assigned, stop := d.offer(ctx, carRequest, car, len(offered))
+		if assigned || stop {
+			return
+		}
+	}
+
+	log.Printf("dispatch: no driver accepted car request %d\n", carRequestId)
+}
+
+// offer proposes the car request to the driver of car and waits for their answer. It
+// reports whether the ride got assigned and whether dispatching should stop altogether.
+func (d *Dispatcher) offer(ctx context.Context, carRequest *data.CarRequest, car *data.NearbyCar, rank int) (assigned, stop bool) {
+	now := time.Now()
+
+	d.mu.Lock()
+	d.nextID++
+	offer := &Offer{
+		ID:           d.nextID,
+		CarRequestId: carRequest.ID,
+		CarId:        car.ID,
+		DriverId:     car.UserId,
+		Rank:         rank,
+		City:         carRequest.City,
+		Address:      carRequest.Address,
+		CarType:      carRequest.CarType,
+		PickupLat:    carRequest.PickupLat,
+		PickupLng:    carRequest.PickupLng,
+		DistanceKm:   car.DistanceKm,
+		ETASeconds:   car.ETASeconds,
+		OfferedAt:    now,
+		ExpiresAt:    now.Add(d.OfferTimeout),
+		answers:      make(chan answer, 1),
+	}
+	d.offers[offer.ID] = offer
+	d.mu.Unlock()
+
+	timer := time.NewTimer(d.OfferTimeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-offer.answers:
+		if !reply.accept {
+			return false, false
+		}
+
+		err := d.assign(carRequest, &car.Car)
+		reply.result <- err
+		if err == nil {
+			return true, true
+		}
+		// the ride is gone; otherwise only this car could not take it
+		return false, errors.Is(err, data.ErrInvalidTransition)
+	case <-timer.C:
+	case <-ctx.Done():
+		stop = true
+	}
+
+	d.mu.Lock()
+	delete(d.offers, offer.ID)
+	// the driver may have answered right before the offer was removed
+	select {
+	case reply := <-offer.answers:
+		reply.result <- ErrOfferNotFound
+	default:
+	}
+	d.mu.Unlock()
+
+	return false, stop
+}
+
+// candidates returns the cars the car request should be offered to, best first.
+func (d *Dispatcher) candidates(carRequest *data.CarRequest) ([]*data.NearbyCar, error) {
+	if carRequest.PickupLat != nil && carRequest.PickupLng != nil {
+		return d.Models.Car.GetNearestAvailableCars(*carRequest.PickupLat, *carRequest.PickupLng,
+			searchRadiusKm, carRequest.CarType, maxCandidates)
+	}
+
+	cars, err := d.Models.Car.GetDispatchCandidates(carRequest.City, carRequest.CarType)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*data.NearbyCar
+	for _, car := range cars {
+		candidates = append(candidates, &data.NearbyCar{Car: *car})
+	}
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+
+	return candidates, nil
+}
+
+// assign gives the car request to car, provided the car is still free: it fails with
+// data.ErrCarBusy otherwise.
+func (d *Dispatcher) assign(carRequest *data.CarRequest, car *data.Car) error {
+	carRequest.CarId.Int64 = int64(car.ID)
+	carRequest.CarId.Valid = true
+
+	return d.Models.CarRequest.Transition(carRequest, data.StatusAccepted)
+}
@@ -0,0 +1,3 @@
+DROP TABLE public.cars;
+
+DROP SEQUENCE public.car_id_seq;
@@ -28,4 +28,11 @@ ALTER TABLE ONLY public.cars
     ADD CONSTRAINT cars_pkey PRIMARY KEY (id);
 
 ALTER TABLE public.cars
-    ADD COLUMN active boolean DEFAULT false;
\ No newline at end of file
+    ADD COLUMN active boolean DEFAULT false;
+
+ALTER TABLE public.cars
+    ADD COLUMN latitude double precision,
+    ADD COLUMN longitude double precision,
+    ADD COLUMN location_updated_at timestamp without time zone;
+
+CREATE INDEX cars_location_idx ON public.cars (latitude, longitude) WHERE active;
@@ -0,0 +1,3 @@
+DROP TABLE public.car_requests;
+
+DROP SEQUENCE public.car_request_id_seq;
@@ -0,0 +1,72 @@
+CREATE SEQUENCE public.car_request_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.car_request_id_seq OWNER TO postgres;
+
+SET default_tablespace = '';
+SET default_table_access_method = heap;
+
+CREATE TABLE public.car_requests (
+                                     id integer DEFAULT nextval('public.car_request_id_seq'::regclass) NOT NULL,
+                                     user_id integer,
+                                     user_name character varying(255),
+                                     car_type character varying(255),
+                                     car_id integer,
+                                     city character varying(255),
+                                     address character varying(255),
+                                     active boolean DEFAULT true,
+                                     rating integer DEFAULT 0,
+                                     created_at timestamp without time zone,
+                                     updated_at timestamp without time zone
+);
+
+ALTER TABLE public.car_requests OWNER TO postgres;
+
+SELECT pg_catalog.setval('public.car_request_id_seq', 1, true);
+
+ALTER TABLE ONLY public.car_requests
+    ADD CONSTRAINT car_requests_pkey PRIMARY KEY (id);
+
+
+ALTER TABLE public.car_requests
+    ADD COLUMN status character varying(32) DEFAULT 'requested' NOT NULL,
+    ADD COLUMN accepted_at timestamp without time zone,
+    ADD COLUMN driver_arriving_at timestamp without time zone,
+    ADD COLUMN started_at timestamp without time zone,
+    ADD COLUMN completed_at timestamp without time zone,
+    ADD COLUMN cancelled_at timestamp without time zone,
+    ADD COLUMN expired_at timestamp without time zone;
+
+-- derive the status of existing rows from the old active / car_id pair
+UPDATE public.car_requests
+SET status = CASE
+                 WHEN active AND car_id IS NULL THEN 'requested'
+                 WHEN active THEN 'accepted'
+                 WHEN car_id IS NOT NULL THEN 'completed'
+                 ELSE 'expired'
+             END;
+
+ALTER TABLE public.car_requests
+    ADD CONSTRAINT car_requests_status_check CHECK (status IN ('requested', 'accepted', 'driver_arriving', 'in_progress',
+                                                               'completed', 'cancelled_by_rider', 'cancelled_by_driver', 'expired'));
+
+ALTER TABLE public.car_requests
+    ADD COLUMN pickup_lat double precision,
+    ADD COLUMN pickup_lng double precision,
+    ADD COLUMN dropoff_lat double precision,
+    ADD COLUMN dropoff_lng double precision;
+
+-- fares are stored in the minor unit of the currency (cents)
+ALTER TABLE public.car_requests
+    ADD COLUMN estimated_fare bigint,
+    ADD COLUMN final_fare bigint,
+    ADD COLUMN currency character varying(3);
+
+ALTER TABLE public.car_requests
+    ADD COLUMN surge_multiplier double precision DEFAULT 1 NOT NULL;
+
+CREATE INDEX car_requests_open_idx ON public.car_requests (city, car_type, created_at) WHERE status = 'requested';
@@ -0,0 +1,3 @@
+DROP TABLE public.rate_cards;
+
+DROP SEQUENCE public.rate_card_id_seq;
@@ -0,0 +1,40 @@
+CREATE SEQUENCE public.rate_card_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER TABLE public.rate_card_id_seq OWNER TO postgres;
+
+SET default_tablespace = '';
+SET default_table_access_method = heap;
+
+-- amounts are in the minor unit of the currency (cents); '*' matches any city or car type
+CREATE TABLE public.rate_cards (
+                                   id integer DEFAULT nextval('public.rate_card_id_seq'::regclass) NOT NULL,
+                                   city character varying(255) NOT NULL,
+                                   car_type character varying(255) NOT NULL,
+                                   currency character varying(3) NOT NULL,
+                                   base_fare bigint NOT NULL,
+                                   per_km bigint NOT NULL,
+                                   per_minute bigint NOT NULL,
+                                   minimum_fare bigint NOT NULL,
+                                   booking_fee bigint NOT NULL,
+                                   created_at timestamp without time zone,
+                                   updated_at timestamp without time zone
+);
+
+ALTER TABLE public.rate_cards OWNER TO postgres;
+
+SELECT pg_catalog.setval('public.rate_card_id_seq', 1, true);
+
+ALTER TABLE ONLY public.rate_cards
+    ADD CONSTRAINT rate_cards_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY public.rate_cards
+    ADD CONSTRAINT rate_cards_city_car_type_key UNIQUE (city, car_type);
+
+INSERT INTO "public"."rate_cards"("city","car_type","currency","base_fare","per_km","per_minute","minimum_fare","booking_fee","created_at","updated_at")
+VALUES
+    (E'*',E'*',E'RON',500,250,50,1000,200,E'2023-11-01 00:00:00',E'2023-11-01 00:00:00');
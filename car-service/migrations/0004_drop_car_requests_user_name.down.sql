@@ -0,0 +1,2 @@
+-- names are not restored, they were never copied back from the authentication service
+ALTER TABLE public.car_requests ADD COLUMN user_name character varying(255);
@@ -0,0 +1,3 @@
+-- the name of the rider belongs to the authentication service, which the car service now
+-- asks for it when showing car requests
+ALTER TABLE public.car_requests DROP COLUMN user_name;
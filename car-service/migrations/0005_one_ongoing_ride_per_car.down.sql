@@ -0,0 +1 @@
+DROP INDEX public.car_requests_ongoing_car_id_idx;
@@ -0,0 +1,4 @@
+-- a car takes one ride at a time: concurrent accepts of two car requests with the same car
+-- can not both succeed
+CREATE UNIQUE INDEX car_requests_ongoing_car_id_idx ON public.car_requests (car_id)
+    WHERE status IN ('accepted', 'driver_arriving', 'in_progress');
@@ -0,0 +1,93 @@
+// Package pricing computes what a ride costs from the rate card of its city and car type.
+// All amounts are in the minor unit of the rate card currency (cents).
+package pricing
+
+import (
+	"car-service/data"
+	"math"
+	"time"
+)
+
+// roadFactor converts a straight-line distance into an estimate of the distance driven.
+const roadFactor = 1.3
+
+// Fare is the breakdown of the price of a ride.
+type Fare struct {
+	Currency        string  `json:"currency"`
+	BaseFare        int64   `json:"base_fare"`
+	DistanceFare    int64   `json:"distance_fare"`
+	TimeFare        int64   `json:"time_fare"`
+	BookingFee      int64   `json:"booking_fee"`
+	SurgeMultiplier float64 `json:"surge_multiplier"`
+	SurgeAmount     int64   `json:"surge_amount"`
+	MinimumApplied  bool    `json:"minimum_applied"`
+	Total           int64   `json:"total"`
+	DistanceKm      float64 `json:"distance_km"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+// Calculate prices a ride of distanceKm lasting duration with the given rate card and surge
+// multiplier. The surge multiplies the metered part of the ride, the minimum fare applies to
+// the surged amount and the booking fee is always added on top.
+func Calculate(card *data.RateCard, distanceKm float64, duration time.Duration, surge float64) Fare {
+	if surge < 1 {
+		surge = 1
+	}
+
+	fare := Fare{
+		Currency:        card.Currency,
+		BaseFare:        card.BaseFare,
+		DistanceFare:    round(float64(card.PerKm) * distanceKm),
+		TimeFare:        round(float64(card.PerMinute) * duration.Minutes()),
+		BookingFee:      card.BookingFee,
+		SurgeMultiplier: surge,
+		DistanceKm:      math.Round(distanceKm*100) / 100,
+		DurationSeconds: int(duration.Seconds()),
+	}
+
+	metered := fare.BaseFare + fare.DistanceFare + fare.TimeFare
+	fare.SurgeAmount = round(float64(metered)*surge) - metered
+	metered += fare.SurgeAmount
+	if metered < card.MinimumFare {
+		metered = card.MinimumFare
+		fare.MinimumApplied = true
+	}
+	fare.Total = metered + fare.BookingFee
+
+	return fare
+}
+
+// Estimate prices a ride between two points before it happens, assuming the trip follows
+// the road network and drives at the average city speed.
+func Estimate(card *data.RateCard, pickupLat, pickupLng, dropoffLat, dropoffLng, surge float64) Fare {
+	distance := RouteDistanceKm(pickupLat, pickupLng, dropoffLat, dropoffLng)
+	return Calculate(card, distance, data.EstimateETA(distance), surge)
+}
+
+// Final prices a completed ride with the surge multiplier the rider accepted. The distance is
+// estimated from the pickup and dropoff points when both are known; the duration is the
+// time the ride was in progress.
+func Final(card *data.RateCard, carRequest *data.CarRequest, completedAt time.Time) Fare {
+	var distance float64
+	if carRequest.PickupLat != nil && carRequest.PickupLng != nil &&
+		carRequest.DropoffLat != nil && carRequest.DropoffLng != nil {
+		distance = RouteDistanceKm(*carRequest.PickupLat, *carRequest.PickupLng,
+			*carRequest.DropoffLat, *carRequest.DropoffLng)
+	}
+
+	var duration time.Duration
+	if carRequest.StartedAt != nil {
+		duration = completedAt.Sub(*carRequest.StartedAt)
+	}
+
+	return Calculate(card, distance, duration, carRequest.SurgeMultiplier)
+}
+
+// RouteDistanceKm estimates the distance driven between two points.
+func RouteDistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	return data.DistanceKm(lat1, lng1, lat2, lng2) * roadFactor
+}
+
+func round(amount float64) int64 {
+	return int64(math.Round(amount))
+}
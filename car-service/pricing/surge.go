@@ -0,0 +1,104 @@
+package pricing
+
+import (
+	"car-service/data"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxSurgeMultiplier caps how much more expensive rides may get.
+	MaxSurgeMultiplier = 3.0
+
+	// surgeSensitivity is how much the multiplier grows for each extra open request per
+	// available car.
+	surgeSensitivity = 0.5
+)
+
+// Surge is the multiplier applied to fares of one city and car type, with the demand and
+// supply it was computed from.
+type Surge struct {
+	City       string    `json:"city"`
+	CarType    string    `json:"car_type"`
+	Multiplier float64   `json:"surge_multiplier"`
+	Demand     int       `json:"demand"`
+	Supply     int       `json:"supply"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// SurgeMultiplier turns demand (open requests) and supply (available cars) into a fare
+// multiplier between 1 and MaxSurgeMultiplier, rounded to one decimal.
+func SurgeMultiplier(demand, supply int) float64 {
+	if demand == 0 {
+		return 1
+	}
+	if supply == 0 {
+		return MaxSurgeMultiplier
+	}
+
+	ratio := float64(demand) / float64(supply)
+	multiplier := 1 + (ratio-1)*surgeSensitivity
+	multiplier = math.Max(1, math.Min(multiplier, MaxSurgeMultiplier))
+
+	return math.Round(multiplier*10) / 10
+}
+
+// SurgeCalculator computes surge multipliers over a sliding window of recent requests and
+// caches them for a short while so that every estimate does not hit the database.
+type SurgeCalculator struct {
+	Models data.Models
+	Window time.Duration
+	TTL    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]Surge
+}
+
+// NewSurgeCalculator returns a calculator counting the requests of the last window and
+// reusing a multiplier for ttl.
+func NewSurgeCalculator(models data.Models, window, ttl time.Duration) *SurgeCalculator {
+	return &SurgeCalculator{
+		Models: models,
+		Window: window,
+		TTL:    ttl,
+		cache:  make(map[string]Surge),
+	}
+}
+
+// Current returns the surge for the city and car type.
+func (s *SurgeCalculator) Current(city, carType string) (Surge, error) {
+	key := city + "\x00" + carType
+
+	s.mu.Lock()
+	surge, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && time.Since(surge.ComputedAt) < s.TTL {
+		return surge, nil
+	}
+
+	demand, err := s.Models.CarRequest.CountOpenCarRequests(city, carType, time.Now().Add(-s.Window))
+	if err != nil {
+		return Surge{}, err
+	}
+
+	supply, err := s.Models.Car.CountAvailableCars(city, carType)
+	if err != nil {
+		return Surge{}, err
+	}
+
+	surge = Surge{
+		City:       city,
+		CarType:    carType,
+		Multiplier: SurgeMultiplier(demand, supply),
+		Demand:     demand,
+		Supply:     supply,
+		ComputedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.cache[key] = surge
+	s.mu.Unlock()
+
+	return surge, nil
+}
@@ -0,0 +1,106 @@
+// Package users looks up the display data of users in the authentication service, which owns
+// it. The car service only stores user ids and asks for names when it shows car requests.
+package users
+
+import (
+	"common/authclient"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeletedName is shown instead of the name of riders whose account was deleted.
+const DeletedName = "Deleted user"
+
+// maxBatch is how many users the authentication service looks up in one call.
+const maxBatch = 100
+
+type cachedName struct {
+	name      string
+	fetchedAt time.Time
+}
+
+// Directory returns the display names of users, caching them for TTL so that lists of car
+// requests do not cost one call per user. A renamed user shows their new name once the
+// cached one expires.
+type Directory struct {
+	Auth *authclient.Client
+	TTL  time.Duration
+
+	mu    sync.Mutex
+	names map[int]cachedName
+}
+
+// NewDirectory returns a directory of the users of the authentication service.
+func NewDirectory(client *authclient.Client, ttl time.Duration) *Directory {
+	return &Directory{
+		Auth:  client,
+		TTL:   ttl,
+		names: make(map[int]cachedName),
+	}
+}
+
+// Names returns the display names of the users with the given ids, asking the
+// authentication service for the ones not cached with the bearer token of the caller.
+// Users that no longer exist are missing from the result.
+func (d *Directory) Names(ctx context.Context, token string, ids []int) (map[int]string, error) {
+	names := make(map[int]string, len(ids))
+	var missing []int
+	seen := make(map[int]bool, len(ids))
+
+	d.mu.Lock()
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		cached, ok := d.names[id]
+		if ok && time.Since(cached.fetchedAt) < d.TTL {
+			names[id] = cached.name
+			continue
+		}
+		missing = append(missing, id)
+	}
+	d.mu.Unlock()
+
+	sort.Ints(missing)
+
+	for start := 0; start < len(missing); start += maxBatch {
+		end := start + maxBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		fetched, err := d.fetch(ctx, token, missing[start:end])
+		if err != nil {
+			return names, err
+		}
+
+		now := time.Now()
+		d.mu.Lock()
+		for id, name := range fetched {
+			d.names[id] = cachedName{name: name, fetchedAt: now}
+			names[id] = name
+		}
+		d.mu.Unlock()
+	}
+
+	return names, nil
+}
+
+func (d *Directory) fetch(ctx context.Context, token string, ids []int) (map[int]string, error) {
+	users, err := d.Auth.UserNames(ctx, token, ids)
+	if err != nil {
+		return nil, fmt.Errorf("authentication service: %w", err)
+	}
+
+	names := make(map[int]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+
+	return names, nil
+}
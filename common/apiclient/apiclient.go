@@ -0,0 +1,202 @@
+// Package apiclient calls the services of the project, which all answer with the same
+// {"error", "message", "data"} JSON envelope. The typed clients in authclient and carclient
+// are built on it.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBodySize bounds the answers read from a service.
+const maxBodySize = 10 << 20
+
+// Errors answered by a service match these with errors.Is, by status code.
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooManyRequests = errors.New("too many requests")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:      ErrBadRequest,
+	http.StatusUnauthorized:    ErrUnauthorized,
+	http.StatusForbidden:       ErrForbidden,
+	http.StatusNotFound:        ErrNotFound,
+	http.StatusConflict:        ErrConflict,
+	http.StatusTooManyRequests: ErrTooManyRequests,
+}
+
+// Error is an error answered by a service, kept with its status code, headers and data so
+// that it can be passed on to the caller.
+type Error struct {
+	Status  int
+	Message string
+	Header  http.Header
+	Data    json.RawMessage
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is the sentinel error of the status code.
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.Status] == target
+}
+
+// Client calls one service, following Policy when it is slow or failing.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	Policy  Policy
+}
+
+// New returns a client of the service reachable at baseURL, giving up on calls that take
+// longer than timeout.
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: timeout},
+		Policy:  DefaultPolicy,
+	}
+}
+
+// Do calls path with body, when not nil, encoded as JSON. A failure answered by the service
+// is returned as an *Error, and when result is not nil the data of a successful answer is
+// decoded into it.
+func (c *Client) Do(ctx context.Context, method, path string, header http.Header, body, result any) error {
+	response, err := c.Send(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var envelope struct {
+		Error   bool            `json:"error"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(response.Body, maxBodySize)).Decode(&envelope)
+	if err != nil {
+		if response.StatusCode >= http.StatusBadRequest {
+			return &Error{Status: response.StatusCode, Message: http.StatusText(response.StatusCode), Header: response.Header}
+		}
+		return fmt.Errorf("%s %s answered %d with an unreadable body: %w", method, path, response.StatusCode, err)
+	}
+
+	if response.StatusCode >= http.StatusBadRequest || envelope.Error {
+		return &Error{Status: response.StatusCode, Message: envelope.Message, Header: response.Header, Data: envelope.Data}
+	}
+
+	if result != nil && len(envelope.Data) > 0 {
+		return json.Unmarshal(envelope.Data, result)
+	}
+
+	return nil
+}
+
+// Send calls path with body, when not nil, encoded as JSON, and returns the answer whatever
+// its status, for the caller to read and close. Idempotent calls are tried again as Policy
+// allows, and calls to a service whose circuit is open fail with ErrCircuitOpen.
+func (c *Client) Send(ctx context.Context, method, path string, header http.Header, body any) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	upstream := upstreamOf(c.BaseURL)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			upstream.metrics.Retries.Add(1)
+		}
+
+		if !upstream.breaker.allow(c.Policy) {
+			upstream.metrics.Rejected.Add(1)
+			return nil, fmt.Errorf("%s %s: %w", method, path, ErrCircuitOpen)
+		}
+
+		request, err := c.newRequest(ctx, method, path, header, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		upstream.metrics.Requests.Add(1)
+		response, err := c.HTTP.Do(request)
+
+		// a caller giving up says nothing about the health of the service
+		if err != nil && ctx.Err() != nil {
+			upstream.breaker.abandon()
+			return nil, err
+		}
+
+		failure := failed(response, err)
+		upstream.breaker.record(failure, c.Policy)
+		if failure {
+			upstream.metrics.Failures.Add(1)
+			if isTimeout(err) {
+				upstream.metrics.Timeouts.Add(1)
+			}
+		}
+
+		if !failure || attempt >= c.Policy.Retries || !isIdempotent(request) || !retryable(response, err) {
+			return response, err
+		}
+
+		if response != nil {
+			io.Copy(io.Discard, io.LimitReader(response.Body, maxBodySize))
+			response.Body.Close()
+		}
+
+		err = sleep(ctx, c.Policy.backoff(attempt+1))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, header http.Header, payload []byte) (*http.Request, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Accept", "application/json")
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return request, nil
+}
+
+// Bearer returns the header authenticating a call with the token.
+func Bearer(token string) http.Header {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return header
+}
@@ -0,0 +1,152 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) *Client {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"error":false,"message":"ok","data":{"auth":%q}}`, r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("/surge", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, `{"error":true,"message":"surge pricing is in effect","data":{"surge_multiplier":1.5}}`)
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return New(server.URL+"/", time.Second)
+}
+
+func TestDoDecodesData(t *testing.T) {
+	client := newServer(t)
+
+	var result struct {
+		Auth string `json:"auth"`
+	}
+	err := client.Do(context.Background(), http.MethodGet, "/ok", Bearer("abc"), nil, &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Auth != "Bearer abc" {
+		t.Fatalf("got authorization %q, want the bearer token", result.Auth)
+	}
+}
+
+func TestDoReturnsServiceErrors(t *testing.T) {
+	client := newServer(t)
+
+	err := client.Do(context.Background(), http.MethodPost, "/surge", nil, map[string]any{}, nil)
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || !errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want a conflict", err)
+	}
+	if serviceErr.Message != "surge pricing is in effect" || string(serviceErr.Data) != `{"surge_multiplier":1.5}` {
+		t.Fatalf("got %+v, want the message and data of the service", serviceErr)
+	}
+
+	err = client.Do(context.Background(), http.MethodGet, "/down", nil, nil, nil)
+	if !errors.As(err, &serviceErr) || serviceErr.Status != http.StatusBadGateway {
+		t.Fatalf("got error %v, want the status of an answer without envelope", err)
+	}
+}
+
+// flaky returns a client of a service failing with 503 the first failures calls.
+func flaky(t *testing.T, failures int) (*Client, *atomic.Int64) {
+	t.Helper()
+
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= int64(failures) {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"error":false,"message":"ok"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := New(server.URL, time.Second)
+	client.Policy = Policy{Retries: 2, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, FailureThreshold: 10, Cooldown: time.Minute}
+	return client, &calls
+}
+
+func TestIdempotentCallsAreRetried(t *testing.T) {
+	client, calls := flaky(t, 2)
+
+	err := client.Do(context.Background(), http.MethodGet, "/", nil, nil, nil)
+	if err != nil || calls.Load() != 3 {
+		t.Fatalf("got error %v after %d calls, want success on the third", err, calls.Load())
+	}
+	if client.Metrics().Retries.Load() != 2 || client.Metrics().Failures.Load() != 2 {
+		t.Fatalf("got %d retries and %d failures, want 2 of each", client.Metrics().Retries.Load(), client.Metrics().Failures.Load())
+	}
+
+	client, calls = flaky(t, 1)
+	err = client.Do(context.Background(), http.MethodPost, "/", Idempotent(nil), nil, nil)
+	if err != nil || calls.Load() != 2 {
+		t.Fatalf("got error %v after %d calls, want a POST marked idempotent retried", err, calls.Load())
+	}
+}
+
+func TestOtherCallsAreNotRetried(t *testing.T) {
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		client, calls := flaky(t, 1)
+
+		err := client.Do(context.Background(), method, "/", nil, map[string]any{}, nil)
+		var serviceErr *Error
+		if !errors.As(err, &serviceErr) || serviceErr.Status != http.StatusServiceUnavailable || calls.Load() != 1 {
+			t.Fatalf("got error %v after %d calls of a %s, want a single call", err, calls.Load(), method)
+		}
+	}
+}
+
+func TestCircuitOpensAfterRepeatedFailures(t *testing.T) {
+	client, calls := flaky(t, 3)
+	client.Policy = Policy{FailureThreshold: 3, Cooldown: 50 * time.Millisecond}
+
+	for i := 0; i < 3; i++ {
+		client.Do(context.Background(), http.MethodGet, "/", nil, nil, nil)
+	}
+
+	err := client.Do(context.Background(), http.MethodGet, "/", nil, nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) || calls.Load() != 3 {
+		t.Fatalf("got error %v after %d calls, want the fourth call rejected", err, calls.Load())
+	}
+	if client.Metrics().Rejected.Load() != 1 {
+		t.Fatalf("got %d rejected calls, want 1", client.Metrics().Rejected.Load())
+	}
+
+	// once the cool down is over a probe succeeds and closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		err = client.Do(context.Background(), http.MethodGet, "/", nil, nil, nil)
+		if err != nil {
+			t.Fatalf("got error %v after the cool down, want the circuit closed", err)
+		}
+	}
+}
+
+func TestBackoffIsBounded(t *testing.T) {
+	policy := Policy{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for attempt := 1; attempt < 70; attempt++ {
+		if wait := policy.backoff(attempt); wait < 0 || wait >= 300*time.Millisecond {
+			t.Fatalf("got a wait of %s before retry %d, want it below the maximum", wait, attempt)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling a service that failed too many times in a
+// row, until its cool down is over.
+var ErrCircuitOpen = errors.New("circuit breaker open: the service is failing")
+
+// Policy is how a client copes with a slow or failing service.
+type Policy struct {
+	// Retries is how many times a failed idempotent call is tried again: a GET, HEAD or
+	// OPTIONS, or a call marked Idempotent. Calls fail when the service can not be reached
+	// or answers 502, 503 or 504.
+	Retries int
+
+	// Backoff is the longest wait before the first retry, doubled for each following one
+	// up to MaxBackoff. The actual wait is picked at random below it, so that clients do
+	// not retry in step.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// after FailureThreshold failed calls in a row the circuit opens, and calls fail with
+	// ErrCircuitOpen for Cooldown before one call is let through to probe the service
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// DefaultPolicy is the policy of the clients returned by New.
+var DefaultPolicy = Policy{
+	Retries:          2,
+	Backoff:          100 * time.Millisecond,
+	MaxBackoff:       time.Second,
+	FailureThreshold: 5,
+	Cooldown:         10 * time.Second,
+}
+
+// Metrics count the calls made to one service.
+type Metrics struct {
+	Requests atomic.Int64 // calls made, retries included
+	Failures atomic.Int64 // calls that could not reach the service or answered 5xx
+	Timeouts atomic.Int64 // failures that timed out
+	Retries  atomic.Int64 // calls tried again
+	Rejected atomic.Int64 // calls not made because the circuit was open
+}
+
+// breaker is the circuit breaker of one service.
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a call may be made. Once the cool down of an open circuit is over a
+// single call is let through, and its outcome closes or opens the circuit again.
+func (b *breaker) allow(policy Policy) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < policy.Cooldown {
+		return false
+	}
+
+	b.probing = true
+	return true
+}
+
+func (b *breaker) record(failed bool, policy Policy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		return
+	}
+
+	b.failures++
+	if policy.FailureThreshold > 0 && b.failures >= policy.FailureThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon forgets a call that was given up before the service answered.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openedAt.IsZero():
+		return "closed"
+	case b.probing:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// upstream is what the clients of one service share, so that a service failing for one
+// client is not called by the others either.
+type upstream struct {
+	breaker breaker
+	metrics Metrics
+}
+
+var (
+	upstreamsMu sync.Mutex
+	upstreams   = map[string]*upstream{}
+
+	// the metrics of every service called are published with expvar, under "upstreams"
+	upstreamVars = expvar.NewMap("upstreams")
+)
+
+func upstreamOf(baseURL string) *upstream {
+	upstreamsMu.Lock()
+	defer upstreamsMu.Unlock()
+
+	u, ok := upstreams[baseURL]
+	if !ok {
+		u = &upstream{}
+		upstreams[baseURL] = u
+		upstreamVars.Set(baseURL, expvar.Func(func() any {
+			return map[string]any{
+				"requests": u.metrics.Requests.Load(),
+				"failures": u.metrics.Failures.Load(),
+				"timeouts": u.metrics.Timeouts.Load(),
+				"retries":  u.metrics.Retries.Load(),
+				"rejected": u.metrics.Rejected.Load(),
+				"circuit":  u.breaker.state(),
+			}
+		}))
+	}
+
+	return u
+}
+
+// Metrics returns the metrics of the service the client calls, shared with every other
+// client of the same service.
+func (c *Client) Metrics() *Metrics {
+	return &upstreamOf(c.BaseURL).metrics
+}
+
+// Idempotent marks a call that is safe to repeat although its method is not, such as a POST
+// that only reads or a DELETE that erases whatever is left, so that it is retried. PUT and
+// DELETE are not retried otherwise, since many of them move a ride on or change a status,
+// which a repeat would fail or do twice. It follows net/http in using an Idempotency-Key
+// header without value, which is not sent.
+func Idempotent(header http.Header) http.Header {
+	if header == nil {
+		header = http.Header{}
+	}
+	header["Idempotency-Key"] = nil
+	return header
+}
+
+func isIdempotent(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	_, ok := request.Header["Idempotency-Key"]
+	return ok
+}
+
+// failed reports whether the outcome of a call counts against the service.
+func failed(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return response.StatusCode >= http.StatusInternalServerError
+}
+
+// retryable reports whether a call that failed may succeed if tried again.
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns how long to wait before the retry numbered attempt, from 1.
+func (p Policy) backoff(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+
+	limit := p.Backoff
+	for i := 1; i < attempt && limit < p.MaxBackoff; i++ {
+		limit *= 2
+	}
+	if p.MaxBackoff > 0 && limit > p.MaxBackoff {
+		limit = p.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
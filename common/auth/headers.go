@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Identity headers set by the broker on the requests it forwards, from the token it
+// verified. They come with the gateway secret the broker shares with the services, which
+// only trust them from requests carrying it: see TrustedProxy.
+const (
+	HeaderUserID        = "X-User-Id"
+	HeaderUserName      = "X-User-Name"
+	HeaderUserEmail     = "X-User-Email"
+	HeaderUserType      = "X-User-Type"
+	HeaderPermissions   = "X-User-Permissions"
+	HeaderGatewaySecret = "X-Gateway-Secret"
+)
+
+var identityHeaders = []string{HeaderUserID, HeaderUserName, HeaderUserEmail, HeaderUserType, HeaderPermissions, HeaderGatewaySecret}
+
+// SetIdentityHeaders replaces the identity headers of header with those of the principal
+// and the gateway secret. They are only removed when principal is nil or secret is empty.
+func SetIdentityHeaders(header http.Header, principal *Principal, secret string) {
+	for _, name := range identityHeaders {
+		header.Del(name)
+	}
+	if principal == nil || secret == "" {
+		return
+	}
+
+	header.Set(HeaderUserID, strconv.Itoa(principal.UserID))
+	header.Set(HeaderUserName, url.QueryEscape(principal.Name))
+	header.Set(HeaderUserEmail, principal.Email)
+	header.Set(HeaderUserType, principal.Type)
+	header.Set(HeaderPermissions, strings.Join(principal.Permissions, " "))
+	header.Set(HeaderGatewaySecret, secret)
+}
+
+// TrustedProxy authenticates the requests forwarded by the broker from their identity
+// headers, when they carry the gateway secret, so that Middleware does not verify their
+// token again. The identity headers of other requests are removed, and they go on like
+// requests from clients. An empty secret trusts no request.
+func TrustedProxy(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := principalFromHeaders(r.Header, secret)
+			for _, name := range identityHeaders {
+				r.Header.Del(name)
+			}
+			if ok {
+				r = r.WithContext(NewContext(r.Context(), principal))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func principalFromHeaders(header http.Header, secret string) (*Principal, bool) {
+	given := header.Get(HeaderGatewaySecret)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(given), []byte(secret)) != 1 {
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(header.Get(HeaderUserID))
+	if err != nil {
+		return nil, false
+	}
+	name, err := url.QueryUnescape(header.Get(HeaderUserName))
+	if err != nil {
+		return nil, false
+	}
+
+	return &Principal{
+		UserID:      id,
+		Name:        name,
+		Email:       header.Get(HeaderUserEmail),
+		Type:        header.Get(HeaderUserType),
+		Permissions: strings.Fields(header.Get(HeaderPermissions)),
+	}, true
+}
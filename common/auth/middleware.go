@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Middleware authenticates every request with the bearer token of its Authorization header
+// and stores the principal in the request context. Requests without a valid token are
+// answered with 401 Unauthorized, unless TrustedProxy already authenticated them.
+func Middleware(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticate(v, r)
+			if err != nil {
+				writeError(w, err, http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+		})
+	}
+}
+
+// Optional is like Middleware but lets requests without an Authorization header through
+// anonymously. Requests with an invalid token are still rejected.
+func Optional(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			Middleware(v)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole only lets through requests authenticated as one of the given roles, and
+// answers the others with 403 Forbidden. It must be mounted after Middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return p.HasRole(roles...) })
+}
+
+// RequirePermission only lets through requests authenticated as a user granted the
+// permission, and answers the others with 403 Forbidden. It must be mounted after
+// Middleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return p.Can(permission) })
+}
+
+func require(allowed func(*Principal) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok {
+				writeError(w, errors.New("missing authorization header"), http.StatusUnauthorized)
+				return
+			}
+
+			if !allowed(principal) {
+				writeError(w, errors.New("your account is not allowed to do this"), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Current returns the principal of a request that went through Middleware. It panics when
+// the route is not protected, which is a programming error.
+func Current(r *http.Request) *Principal {
+	principal, ok := FromContext(r.Context())
+	if !ok {
+		panic("auth: " + r.URL.Path + " is not behind the authentication middleware")
+	}
+	return principal
+}
+
+// BearerToken returns the token of the Authorization header of the request, or "" when it
+// carries none, to call other services on behalf of the user.
+func BearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
+
+func authenticate(v *Verifier, r *http.Request) (*Principal, error) {
+	if principal, ok := FromContext(r.Context()); ok {
+		return principal, nil
+	}
+
+	bearer := r.Header.Get("Authorization")
+	if bearer == "" {
+		return nil, errors.New("missing authorization header")
+	}
+
+	tokenString, ok := strings.CutPrefix(bearer, "Bearer ")
+	if !ok || tokenString == "" {
+		return nil, errors.New("malformed authorization header")
+	}
+
+	principal, err := v.Verify(r.Context(), tokenString)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidToken) {
+			log.Println("Error verifying token:", err)
+		}
+		return nil, ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+// writeError answers with the JSON error envelope used by every service.
+func writeError(w http.ResponseWriter, err error, status int) {
+	payload := struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}{true, err.Error()}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
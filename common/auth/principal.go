@@ -0,0 +1,54 @@
+// Package auth authenticates requests carrying a token issued by the authentication service.
+// Tokens are verified locally against the service's published keys, and the authenticated
+// user is made available to handlers as a Principal in the request context.
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Principal is the user a request was authenticated as.
+type Principal struct {
+	UserID      int       `json:"user_id"`
+	Name        string    `json:"username"`
+	Email       string    `json:"email"`
+	Type        string    `json:"type"`
+	Permissions []string  `json:"permissions"`
+	TokenID     string    `json:"-"`
+	IssuedAt    time.Time `json:"-"`
+	ExpiresAt   time.Time `json:"-"`
+}
+
+// HasRole reports whether the principal has one of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Type == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the principal was granted the permission.
+func (p *Principal) Can(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok
+}
@@ -0,0 +1,67 @@
+package auth
+
+// Roles a user can have. The role is stored as the user type in the authentication service
+// and carried by tokens in the type claim.
+const (
+	RoleCustomer = "customer"
+	RoleDriver   = "driver"
+	RoleAdmin    = "admin"
+	RoleSupport  = "support"
+)
+
+// Permissions granted by roles. Services check permissions rather than roles, so that what
+// a role may do is decided in one place.
+const (
+	// PermRequestRides allows requesting, cancelling and rating one's own rides.
+	PermRequestRides = "rides:request"
+
+	// PermDriveRides allows registering cars, receiving offers and driving rides.
+	PermDriveRides = "rides:drive"
+
+	// PermReadAllRides allows reading car requests of other users.
+	PermReadAllRides = "rides:read_all"
+
+	// PermCancelAnyRide allows cancelling rides on behalf of their rider.
+	PermCancelAnyRide = "rides:cancel_any"
+
+	// PermReadUsers allows reading user accounts, such as those locked out of signing in.
+	PermReadUsers = "users:read"
+
+	// PermListUsers allows listing every user account.
+	PermListUsers = "users:list"
+
+	// PermManageUsers allows deleting user accounts.
+	PermManageUsers = "users:manage"
+
+	// PermReadUserNames allows reading the display names of other users, which services
+	// show next to the data they own instead of storing user data themselves.
+	PermReadUserNames = "users:read_names"
+
+	// PermReadMetrics allows reading the metrics a service publishes on /debug/vars, such
+	// as the health of the services it calls.
+	PermReadMetrics = "metrics:read"
+)
+
+var rolePermissions = map[string][]string{
+	RoleCustomer: {PermRequestRides},
+	RoleDriver:   {PermDriveRides, PermReadAllRides, PermReadUserNames},
+	RoleSupport:  {PermReadAllRides, PermCancelAnyRide, PermReadUsers, PermReadUserNames, PermReadMetrics},
+	RoleAdmin:    {PermReadAllRides, PermCancelAnyRide, PermReadUsers, PermListUsers, PermManageUsers, PermReadUserNames, PermReadMetrics},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// SelfAssignableRole reports whether users may pick role when they register. Admin and
+// support accounts are created by an admin.
+func SelfAssignableRole(role string) bool {
+	return role == RoleCustomer || role == RoleDriver
+}
+
+// PermissionsFor returns the permissions granted by role, none for unknown roles.
+func PermissionsFor(role string) []string {
+	return append([]string{}, rolePermissions[role]...)
+}
@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"common/apiclient"
+	"common/authclient"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, revoked or signed with
+// an unknown key.
+var ErrInvalidToken = errors.New("invalid token")
+
+const (
+	// keysMinRefresh limits how often an unknown kid may trigger a JWKS download.
+	keysMinRefresh = 30 * time.Second
+
+	// defaultRevocationsTTL is how long the list of revoked tokens is trusted.
+	defaultRevocationsTTL = 15 * time.Second
+)
+
+// Verifier checks tokens issued by the authentication service. Tokens carrying a kid are
+// verified locally with the keys from the JWKS endpoint, and rejected when listed as
+// revoked or issued before the cutoff of their user; the revocation list is reloaded every
+// RevocationsTTL, so a revoked token stops working within that delay. Tokens signed with the shared HS256 secret have no kid
+// and are checked by calling the check_token endpoint instead.
+type Verifier struct {
+	Auth           *authclient.Client
+	RevocationsTTL time.Duration
+
+	// mu guards the keys and revocation list, which are downloaded without holding it so
+	// that verifying tokens never waits on the authentication service. keysRefresh and
+	// revokedRefresh let one download of each run at a time.
+	mu               sync.Mutex
+	keys             map[string]any
+	keysFetchedAt    time.Time
+	revoked          map[string]time.Time
+	cutoffs          map[int]time.Time
+	revokedFetchedAt time.Time
+
+	keysRefresh    sync.Mutex
+	revokedRefresh sync.Mutex
+}
+
+// NewVerifier returns a verifier for tokens of the authentication service reachable at
+// authServiceURL.
+func NewVerifier(authServiceURL string) *Verifier {
+	return &Verifier{
+		Auth:           authclient.New(authServiceURL, 5*time.Second),
+		RevocationsTTL: defaultRevocationsTTL,
+	}
+}
+
+// Verify checks the token and returns the principal it was issued to.
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*Principal, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if _, ok := token.Header["kid"].(string); !ok {
+		return v.checkRemotely(ctx, tokenString)
+	}
+
+	token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	}, jwt.WithValidMethods([]string{"RS256", "ES256"}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	principal, err := principalFromClaims(token.Claims.(jwt.MapClaims))
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := v.isRevoked(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+// key returns the public key matching the kid of the token, downloading the JWKS again
+// when the kid is unknown, which happens after the authentication service rotated keys.
+func (v *Verifier) key(ctx context.Context, token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok, _ := v.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+
+	v.keysRefresh.Lock()
+	defer v.keysRefresh.Unlock()
+
+	// the keys may have been downloaded while waiting for the previous download
+	key, ok, fetchedAt := v.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+	if time.Since(fetchedAt) < keysMinRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := v.fetchKeys(ctx)
+
+	v.mu.Lock()
+	v.keysFetchedAt = time.Now()
+	if err == nil {
+		v.keys = keys
+	}
+	v.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// cachedKey returns the key downloaded for kid, if any, and when the keys were downloaded.
+func (v *Verifier) cachedKey(kid string) (any, bool, time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	return key, ok, v.keysFetchedAt
+}
+
+// isRevoked reports whether the token of the principal is on the revocation list of the
+// authentication service, or was issued before the cutoff of its user. When the list can
+// not be reloaded the previous one is kept, and tokens are rejected rather than trusted
+// until a first list has been loaded.
+func (v *Verifier) isRevoked(ctx context.Context, principal *Principal) (bool, error) {
+	revoked, cutoffs, err := v.revocations(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := revoked[principal.TokenID]; ok {
+		return true, nil
+	}
+	cutoff, ok := cutoffs[principal.UserID]
+	return ok && principal.IssuedAt.Before(cutoff), nil
+}
+
+// revocations returns the revocation list, reloaded when it is older than RevocationsTTL.
+// The maps returned are only read: a reload replaces them.
+func (v *Verifier) revocations(ctx context.Context) (map[string]time.Time, map[int]time.Time, error) {
+	revoked, cutoffs, fresh := v.cachedRevocations()
+	if fresh {
+		return revoked, cutoffs, nil
+	}
+
+	v.revokedRefresh.Lock()
+	defer v.revokedRefresh.Unlock()
+
+	// the list may have been reloaded while waiting for the previous reload
+	revoked, cutoffs, fresh = v.cachedRevocations()
+	if fresh {
+		return revoked, cutoffs, nil
+	}
+
+	fetchedRevoked, fetchedCutoffs, err := v.fetchRevocations(ctx)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.revokedFetchedAt = time.Now()
+	if err == nil {
+		v.revoked, v.cutoffs = fetchedRevoked, fetchedCutoffs
+	}
+	if v.revoked == nil {
+		return nil, nil, err
+	}
+
+	return v.revoked, v.cutoffs, nil
+}
+
+// cachedRevocations returns the revocation list last loaded, and whether it is recent
+// enough to be used without reloading it.
+func (v *Verifier) cachedRevocations() (map[string]time.Time, map[int]time.Time, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fresh := v.revoked != nil && time.Since(v.revokedFetchedAt) < v.RevocationsTTL
+	return v.revoked, v.cutoffs, fresh
+}
+
+// JSONWebKey is one entry of a JWKS document.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]any, error) {
+	var jwks struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+
+	err := v.get(ctx, "/.well-known/jwks.json", &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any)
+	for _, k := range jwks.Keys {
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// PublicKey returns the RSA or P-256 public key described by the entry.
+func (k JSONWebKey) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// fetchRevocations returns the expiry of the revoked tokens by id, and the cutoffs of the
+// users whose earlier tokens are revoked.
+func (v *Verifier) fetchRevocations(ctx context.Context) (map[string]time.Time, map[int]time.Time, error) {
+	var response struct {
+		Data struct {
+			RevokedTokens []struct {
+				TokenID   string    `json:"jti"`
+				ExpiresAt time.Time `json:"expires_at"`
+			} `json:"revoked_tokens"`
+			RevokedUsers []struct {
+				UserID       int       `json:"user_id"`
+				IssuedBefore time.Time `json:"issued_before"`
+			} `json:"revoked_users"`
+		} `json:"data"`
+	}
+
+	err := v.get(ctx, "/revoked_tokens", &response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revoked := make(map[string]time.Time)
+	for _, token := range response.Data.RevokedTokens {
+		revoked[token.TokenID] = token.ExpiresAt
+	}
+
+	cutoffs := make(map[int]time.Time)
+	for _, user := range response.Data.RevokedUsers {
+		cutoffs[user.UserID] = user.IssuedBefore
+	}
+
+	return revoked, cutoffs, nil
+}
+
+// checkRemotely asks the authentication service to check a token it can not verify locally.
+func (v *Verifier) checkRemotely(ctx context.Context, tokenString string) (*Principal, error) {
+	info, err := v.Auth.CheckToken(ctx, tokenString)
+	var serviceErr *apiclient.Error
+	if errors.As(err, &serviceErr) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		UserID:      info.UserID,
+		Name:        info.Username,
+		Email:       info.Email,
+		Type:        info.Type,
+		Permissions: info.Permissions,
+	}
+	if principal.Permissions == nil {
+		principal.Permissions = PermissionsFor(principal.Type)
+	}
+
+	return principal, nil
+}
+
+func (v *Verifier) get(ctx context.Context, path string, data any) error {
+	response, err := v.Auth.Send(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("GET %s: unexpected status %d", path, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(data)
+}
+
+// principalFromClaims reads the principal out of verified token claims without trusting
+// their types.
+func principalFromClaims(claims jwt.MapClaims) (*Principal, error) {
+	id, ok := claims["id"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{UserID: int(id)}
+	principal.Name, _ = claims["username"].(string)
+	principal.Email, _ = claims["email"].(string)
+	principal.Type, _ = claims["type"].(string)
+	principal.TokenID, _ = claims["jti"].(string)
+	principal.IssuedAt = IssuedAt(claims)
+	principal.Permissions = permissionsFromClaims(claims, principal.Type)
+
+	// tokens without an expiry would stay valid forever
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, ErrInvalidToken
+	}
+	principal.ExpiresAt = exp.Time
+
+	return principal, nil
+}
+
+// IssuedAt returns the iat claim of the token to the millisecond, which jwt truncates to
+// the second, or the zero time for tokens without one.
+func IssuedAt(claims jwt.MapClaims) time.Time {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(math.Round(iat * 1000)))
+}
+
+// permissionsFromClaims returns the permissions listed in the token, or those of the role
+// for tokens issued before permissions were embedded.
+func permissionsFromClaims(claims jwt.MapClaims, role string) []string {
+	list, ok := claims["permissions"].([]any)
+	if !ok {
+		return PermissionsFor(role)
+	}
+
+	permissions := []string{}
+	for _, permission := range list {
+		if p, ok := permission.(string); ok {
+			permissions = append(permissions, p)
+		}
+	}
+
+	return permissions
+}
@@ -0,0 +1,158 @@
+// Package authclient calls the authentication service on behalf of other services.
+package authclient
+
+import (
+	"common/apiclient"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User is an account of the authentication service.
+type User struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name,omitempty"`
+	LastName  string    `json:"last_name,omitempty"`
+	City      string    `json:"city"`
+	Type      string    `json:"type"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Credentials sign a user in.
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Session is what signing in returns: the tokens of the user, or the token to finish
+// signing in with when the account has two factor authentication enabled.
+type Session struct {
+	User         *User  `json:"user,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+}
+
+// Registration creates an account.
+type Registration struct {
+	FirstName            string `json:"first_name,omitempty"`
+	LastName             string `json:"last_name,omitempty"`
+	Email                string `json:"email"`
+	Password             string `json:"password"`
+	PasswordConfirmation string `json:"password_confirmation"`
+	City                 string `json:"city"`
+	Type                 string `json:"type"`
+}
+
+// UserUpdate changes the profile of a user.
+type UserUpdate struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	City      string `json:"city"`
+}
+
+// TokenInfo is what the authentication service knows about a valid access token.
+type TokenInfo struct {
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	UserID      int      `json:"user_id"`
+	Type        string   `json:"type"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserName is the display name of a user.
+type UserName struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Client calls the authentication service.
+type Client struct {
+	*apiclient.Client
+}
+
+// New returns a client of the authentication service reachable at baseURL.
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{apiclient.New(baseURL, timeout)}
+}
+
+// Authenticate signs a user in. clientIP, when set, is forwarded so that failed attempts
+// are throttled per client rather than per calling service.
+func (c *Client) Authenticate(ctx context.Context, credentials Credentials, clientIP string) (*Session, error) {
+	header := http.Header{}
+	if clientIP != "" {
+		header.Set("X-Forwarded-For", clientIP)
+	}
+
+	var session Session
+	err := c.Do(ctx, http.MethodPost, "/authenticate", header, credentials, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// Register creates an account, which stays inactive until its email is verified.
+func (c *Client) Register(ctx context.Context, registration Registration) (*User, error) {
+	var user User
+	err := c.Do(ctx, http.MethodPost, "/register", nil, registration, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateUser changes the profile of the user with the given id.
+func (c *Client) UpdateUser(ctx context.Context, token string, id int, update UserUpdate) (*User, error) {
+	var user User
+	err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/users/%d", id), apiclient.Bearer(token), update, &user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CheckToken asks the authentication service whether the access token is valid. Checking
+// changes nothing, so the call is retried although it is a POST.
+func (c *Client) CheckToken(ctx context.Context, token string) (*TokenInfo, error) {
+	var info TokenInfo
+	err := c.Do(ctx, http.MethodPost, "/check_token", apiclient.Idempotent(apiclient.Bearer(token)), nil, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// UserNames returns the display names of the users with the given ids. Users that no
+// longer exist are missing from the result.
+func (c *Client) UserNames(ctx context.Context, token string, ids []int) ([]UserName, error) {
+	fields := make([]string, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.Itoa(id)
+	}
+
+	var response struct {
+		Users []UserName `json:"users"`
+	}
+	path := fmt.Sprintf("/users/names?ids=%s", url.QueryEscape(strings.Join(fields, ",")))
+	err := c.Do(ctx, http.MethodGet, path, apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Users, nil
+}
@@ -0,0 +1,466 @@
+// Package carclient calls the car service on behalf of other services.
+package carclient
+
+import (
+	"common/apiclient"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// NullInt is an optional id, encoded the way the car service encodes them.
+type NullInt struct {
+	Int64 int64
+	Valid bool
+}
+
+// CarRequest is a ride requested by a user.
+type CarRequest struct {
+	ID       int     `json:"id"`
+	UserId   int     `json:"user_id"`
+	UserName string  `json:"user_name"`
+	CarType  string  `json:"car_type"`
+	CarId    NullInt `json:"car_id"`
+	City     string  `json:"city"`
+	Address  string  `json:"address"`
+	Active   bool    `json:"active"`
+	Rating   int     `json:"rating"`
+	Status   string  `json:"status"`
+
+	PickupLat  *float64 `json:"pickup_lat,omitempty"`
+	PickupLng  *float64 `json:"pickup_lng,omitempty"`
+	DropoffLat *float64 `json:"dropoff_lat,omitempty"`
+	DropoffLng *float64 `json:"dropoff_lng,omitempty"`
+
+	// fares are in the minor unit of Currency
+	EstimatedFare *int64 `json:"estimated_fare,omitempty"`
+	FinalFare     *int64 `json:"final_fare,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+
+	SurgeMultiplier float64 `json:"surge_multiplier"`
+
+	AcceptedAt       *time.Time `json:"accepted_at,omitempty"`
+	DriverArrivingAt *time.Time `json:"driver_arriving_at,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+	ExpiredAt        *time.Time `json:"expired_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewCarRequest requests a ride for the user the token was issued to.
+type NewCarRequest struct {
+	CarType    string   `json:"car_type"`
+	City       string   `json:"city"`
+	Address    string   `json:"address"`
+	PickupLat  *float64 `json:"pickup_lat,omitempty"`
+	PickupLng  *float64 `json:"pickup_lng,omitempty"`
+	DropoffLat *float64 `json:"dropoff_lat,omitempty"`
+	DropoffLng *float64 `json:"dropoff_lng,omitempty"`
+
+	// SurgeMultiplier is the multiplier the rider was shown and accepted, when surge
+	// pricing is in effect.
+	SurgeMultiplier *float64 `json:"surge_multiplier,omitempty"`
+}
+
+// CarRequestFilter selects the car requests to list. Empty fields do not filter.
+type CarRequestFilter struct {
+	CarType string
+	City    string
+	Active  bool
+}
+
+// Car is a car of a driver.
+type Car struct {
+	ID      int    `json:"id"`
+	UserId  int    `json:"user_id"`
+	CarName string `json:"car_name"`
+	City    string `json:"city"`
+	CarType string `json:"car_type"`
+	Active  bool   `json:"active"`
+
+	Latitude          *float64   `json:"latitude,omitempty"`
+	Longitude         *float64   `json:"longitude,omitempty"`
+	LocationUpdatedAt *time.Time `json:"location_updated_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewCar adds a car to the driver the token was issued to.
+type NewCar struct {
+	CarName string `json:"car_name"`
+	City    string `json:"city"`
+	CarType string `json:"car_type"`
+}
+
+// CarRequestUpdate changes a car request of the rider the token was issued to.
+type CarRequestUpdate struct {
+	Rating int `json:"rating"`
+}
+
+// CarUpdate changes a car of the driver the token was issued to. Fields left nil keep their
+// value.
+type CarUpdate struct {
+	CarName *string `json:"car_name,omitempty"`
+	City    *string `json:"city,omitempty"`
+	CarType *string `json:"car_type,omitempty"`
+	Active  *bool   `json:"active,omitempty"`
+}
+
+// Location is where a car is.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// NearbyCar is an available car around a location. Its position and distance are rounded,
+// and it does not tell who drives it.
+type NearbyCar struct {
+	ID         int      `json:"id"`
+	CarName    string   `json:"car_name"`
+	City       string   `json:"city"`
+	CarType    string   `json:"car_type"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+	DistanceKm float64  `json:"distance_km"`
+	ETASeconds int      `json:"eta_seconds"`
+}
+
+// NearbyFilter selects the available cars to look for around a location. A zero RadiusKm
+// uses the default radius of the car service, and an empty CarType matches any.
+type NearbyFilter struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	CarType   string
+}
+
+// Offer is a car request offered to a driver by the dispatcher, until it expires.
+type Offer struct {
+	ID           int       `json:"id"`
+	CarRequestId int       `json:"car_request_id"`
+	CarId        int       `json:"car_id"`
+	DriverId     int       `json:"driver_id"`
+	Rank         int       `json:"rank"`
+	City         string    `json:"city"`
+	Address      string    `json:"address"`
+	CarType      string    `json:"car_type"`
+	PickupLat    *float64  `json:"pickup_lat,omitempty"`
+	PickupLng    *float64  `json:"pickup_lng,omitempty"`
+	DistanceKm   float64   `json:"distance_km,omitempty"`
+	ETASeconds   int       `json:"eta_seconds,omitempty"`
+	OfferedAt    time.Time `json:"offered_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// FareRequest is a ride to price before requesting it.
+type FareRequest struct {
+	City       string  `json:"city"`
+	CarType    string  `json:"car_type"`
+	PickupLat  float64 `json:"pickup_lat"`
+	PickupLng  float64 `json:"pickup_lng"`
+	DropoffLat float64 `json:"dropoff_lat"`
+	DropoffLng float64 `json:"dropoff_lng"`
+}
+
+// Fare is the breakdown of the price of a ride. Amounts are in the minor unit of Currency.
+type Fare struct {
+	Currency        string  `json:"currency"`
+	BaseFare        int64   `json:"base_fare"`
+	DistanceFare    int64   `json:"distance_fare"`
+	TimeFare        int64   `json:"time_fare"`
+	BookingFee      int64   `json:"booking_fee"`
+	SurgeMultiplier float64 `json:"surge_multiplier"`
+	SurgeAmount     int64   `json:"surge_amount"`
+	MinimumApplied  bool    `json:"minimum_applied"`
+	Total           int64   `json:"total"`
+	DistanceKm      float64 `json:"distance_km"`
+	DurationSeconds int     `json:"duration_seconds"`
+}
+
+// Surge is the fare multiplier of rides of a car type in a city, from the open car requests
+// and the available cars there.
+type Surge struct {
+	City       string    `json:"city"`
+	CarType    string    `json:"car_type"`
+	Multiplier float64   `json:"surge_multiplier"`
+	Demand     int       `json:"demand"`
+	Supply     int       `json:"supply"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// Client calls the car service.
+type Client struct {
+	*apiclient.Client
+}
+
+// New returns a client of the car service reachable at baseURL.
+func New(baseURL string, timeout time.Duration) *Client {
+	return &Client{apiclient.New(baseURL, timeout)}
+}
+
+// CreateCarRequest requests a ride. While surge pricing is in effect and the request did
+// not accept the multiplier, it fails with apiclient.ErrConflict and the surge as data.
+func (c *Client) CreateCarRequest(ctx context.Context, token string, request NewCarRequest) (*CarRequest, error) {
+	var carRequest CarRequest
+	err := c.Do(ctx, http.MethodPost, "/car_requests", apiclient.Bearer(token), request, &carRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &carRequest, nil
+}
+
+// ListCarRequests returns the car requests matching the filter that the token may see.
+func (c *Client) ListCarRequests(ctx context.Context, token string, filter CarRequestFilter) ([]CarRequest, error) {
+	query := url.Values{}
+	query.Set("car_type", filter.CarType)
+	query.Set("city", filter.City)
+	query.Set("active", strconv.FormatBool(filter.Active))
+
+	var response struct {
+		CarRequests []CarRequest `json:"car_requests"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/car_requests?"+query.Encode(), apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.CarRequests, nil
+}
+
+// GetCarRequest returns the car request with the given id, when the token may see it.
+func (c *Client) GetCarRequest(ctx context.Context, token string, id int) (*CarRequest, error) {
+	var carRequest CarRequest
+	err := c.Do(ctx, http.MethodGet, fmt.Sprintf("/car_requests/%d", id), apiclient.Bearer(token), nil, &carRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &carRequest, nil
+}
+
+// UpdateCarRequest rates a completed ride of the rider the token was issued to.
+func (c *Client) UpdateCarRequest(ctx context.Context, token string, id int, update CarRequestUpdate) (*CarRequest, error) {
+	var carRequest CarRequest
+	err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/car_requests/%d", id), apiclient.Bearer(token), update, &carRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &carRequest, nil
+}
+
+// AcceptCarRequest assigns the car with the given id, of the driver the token was issued to,
+// to a car request waiting for a driver.
+func (c *Client) AcceptCarRequest(ctx context.Context, token string, id, carID int) (*CarRequest, error) {
+	body := struct {
+		CarId int `json:"car_id"`
+	}{carID}
+
+	return c.moveCarRequest(ctx, token, id, "accept", body)
+}
+
+// MarkDriverArriving tells the rider that the driver the token was issued to is on the way.
+func (c *Client) MarkDriverArriving(ctx context.Context, token string, id int) (*CarRequest, error) {
+	return c.moveCarRequest(ctx, token, id, "arriving", nil)
+}
+
+// StartRide starts a ride of the driver the token was issued to, once the rider is on board.
+func (c *Client) StartRide(ctx context.Context, token string, id int) (*CarRequest, error) {
+	return c.moveCarRequest(ctx, token, id, "start", nil)
+}
+
+// CompleteRide ends a ride of the driver the token was issued to and prices it.
+func (c *Client) CompleteRide(ctx context.Context, token string, id int) (*CarRequest, error) {
+	return c.moveCarRequest(ctx, token, id, "complete", nil)
+}
+
+// CancelCarRequest cancels a car request of the rider the token was issued to, a ride of the
+// driver, or any car request for support.
+func (c *Client) CancelCarRequest(ctx context.Context, token string, id int) (*CarRequest, error) {
+	return c.moveCarRequest(ctx, token, id, "cancel", nil)
+}
+
+// moveCarRequest moves a car request to its next status through the given step. Steps fail
+// with apiclient.ErrConflict when the car request is not in a status allowing them.
+func (c *Client) moveCarRequest(ctx context.Context, token string, id int, step string, body any) (*CarRequest, error) {
+	var carRequest CarRequest
+	err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/car_requests/%d/%s", id, step), apiclient.Bearer(token), body, &carRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &carRequest, nil
+}
+
+// ListDriverCarRequests returns the car requests the driver the token was issued to accepted,
+// newest first.
+func (c *Client) ListDriverCarRequests(ctx context.Context, token string) ([]CarRequest, error) {
+	var response struct {
+		CarRequests []CarRequest `json:"car_requests"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/driver_car_requests", apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.CarRequests, nil
+}
+
+// ListCars returns the cars of the driver the token was issued to.
+func (c *Client) ListCars(ctx context.Context, token string) ([]Car, error) {
+	var response struct {
+		Cars []Car `json:"cars"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/cars", apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Cars, nil
+}
+
+// CreateCar adds a car to the driver the token was issued to.
+func (c *Client) CreateCar(ctx context.Context, token string, car NewCar) (*Car, error) {
+	var created Car
+	err := c.Do(ctx, http.MethodPost, "/cars", apiclient.Bearer(token), car, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// UpdateCar changes a car of the driver the token was issued to.
+func (c *Client) UpdateCar(ctx context.Context, token string, id int, update CarUpdate) (*Car, error) {
+	var car Car
+	err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/cars/%d", id), apiclient.Bearer(token), update, &car)
+	if err != nil {
+		return nil, err
+	}
+
+	return &car, nil
+}
+
+// DeleteCar removes a car of the driver the token was issued to.
+func (c *Client) DeleteCar(ctx context.Context, token string, id int) error {
+	return c.Do(ctx, http.MethodDelete, fmt.Sprintf("/cars/%d", id), apiclient.Bearer(token), nil, nil)
+}
+
+// UpdateCarLocation stores where a car of the driver the token was issued to is.
+func (c *Client) UpdateCarLocation(ctx context.Context, token string, id int, location Location) (*Car, error) {
+	var car Car
+	err := c.Do(ctx, http.MethodPut, fmt.Sprintf("/cars/%d/location", id), apiclient.Bearer(token), location, &car)
+	if err != nil {
+		return nil, err
+	}
+
+	return &car, nil
+}
+
+// NearbyCars returns the available cars closest to a location.
+func (c *Client) NearbyCars(ctx context.Context, token string, filter NearbyFilter) ([]NearbyCar, error) {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(filter.Latitude, 'f', -1, 64))
+	query.Set("lng", strconv.FormatFloat(filter.Longitude, 'f', -1, 64))
+	if filter.RadiusKm > 0 {
+		query.Set("radius_km", strconv.FormatFloat(filter.RadiusKm, 'f', -1, 64))
+	}
+	if filter.CarType != "" {
+		query.Set("car_type", filter.CarType)
+	}
+
+	var response struct {
+		Cars []NearbyCar `json:"cars"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/cars/nearby?"+query.Encode(), apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Cars, nil
+}
+
+// ListOffers returns the offers waiting for an answer of the driver the token was issued to.
+func (c *Client) ListOffers(ctx context.Context, token string) ([]Offer, error) {
+	var response struct {
+		Offers []Offer `json:"offers"`
+	}
+	err := c.Do(ctx, http.MethodGet, "/offers", apiclient.Bearer(token), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Offers, nil
+}
+
+// AcceptOffer takes the ride of an offer made to the driver the token was issued to. It
+// fails with apiclient.ErrNotFound when the offer expired or was not made to the driver.
+func (c *Client) AcceptOffer(ctx context.Context, token string, id int) error {
+	return c.Do(ctx, http.MethodPut, fmt.Sprintf("/offers/%d/accept", id), apiclient.Bearer(token), nil, nil)
+}
+
+// DeclineOffer turns down an offer made to the driver the token was issued to, which the
+// dispatcher then makes to the next driver.
+func (c *Client) DeclineOffer(ctx context.Context, token string, id int) error {
+	return c.Do(ctx, http.MethodPut, fmt.Sprintf("/offers/%d/decline", id), apiclient.Bearer(token), nil, nil)
+}
+
+// EstimateFare prices a ride before it is requested, with the current surge multiplier.
+func (c *Client) EstimateFare(ctx context.Context, token string, request FareRequest) (*Fare, error) {
+	var fare Fare
+	err := c.Do(ctx, http.MethodPost, "/fare_estimate", apiclient.Idempotent(apiclient.Bearer(token)), request, &fare)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fare, nil
+}
+
+// GetSurge returns the current surge multiplier of rides of a car type in a city.
+func (c *Client) GetSurge(ctx context.Context, token, city, carType string) (*Surge, error) {
+	query := url.Values{}
+	query.Set("city", city)
+	query.Set("car_type", carType)
+
+	var surge Surge
+	err := c.Do(ctx, http.MethodGet, "/surge?"+query.Encode(), apiclient.Bearer(token), nil, &surge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &surge, nil
+}
+
+// ExportUserData returns everything the car service stores about the user the token was
+// issued to.
+func (c *Client) ExportUserData(ctx context.Context, token string) (json.RawMessage, error) {
+	var export json.RawMessage
+	err := c.Do(ctx, http.MethodGet, "/users/me/data", apiclient.Bearer(token), nil, &export)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// DeleteMyData erases the ride data of the user the token was issued to. It fails with
+// apiclient.ErrConflict while the user has a ride under way. Erasing again erases nothing,
+// so the call is retried.
+func (c *Client) DeleteMyData(ctx context.Context, token string) error {
+	return c.Do(ctx, http.MethodDelete, "/users/me/data", apiclient.Idempotent(apiclient.Bearer(token)), nil, nil)
+}
+
+// DeleteUserData erases the ride data of another user, for administrators. Like
+// DeleteMyData, it is retried.
+func (c *Client) DeleteUserData(ctx context.Context, token string, userID int) error {
+	return c.Do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d/data", userID), apiclient.Idempotent(apiclient.Bearer(token)), nil, nil)
+}
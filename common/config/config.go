@@ -0,0 +1,156 @@
+// Package config loads the settings of a service from an optional YAML file and from the
+// environment, so the same binary runs under docker-compose, locally or in tests.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the optional YAML settings file.
+const FileEnv = "CONFIG_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load fills settings, a pointer to a struct whose fields are tagged with the `yaml` key and
+// the `env` variable they are read from. Fields keep the defaults they were given unless the
+// file named by CONFIG_FILE sets them, and environment variables override both. Fields may
+// be strings, booleans, integers or durations such as "5s".
+func Load(settings any) error {
+	v := reflect.ValueOf(settings)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: settings must be a pointer to a struct, not %T", settings)
+	}
+
+	if path := os.Getenv(FileEnv); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(contents))
+		dec.KnownFields(true)
+		err = dec.Decode(settings)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+
+	return LoadEnv(settings, "")
+}
+
+// LoadEnv sets the fields of settings from the environment variables named by prefix and
+// their env tag, such as the settings of one of several providers with a prefix naming it.
+// Fields without a variable keep their value.
+func LoadEnv(settings any, prefix string) error {
+	v := reflect.ValueOf(settings)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: settings must be a pointer to a struct, not %T", settings)
+	}
+
+	var errs []error
+	t := v.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("env")
+		if tag == "" {
+			continue
+		}
+		name := prefix + tag
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := set(v.Elem().Field(i), value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// set parses value into the field.
+func set(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+
+	return nil
+}
+
+// Required checks that a setting was given a value.
+func Required(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+	return nil
+}
+
+// URL checks that a setting is an absolute http or https URL, such as the base URL of
+// another service.
+func URL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s: %q is not an http(s) URL", name, value)
+	}
+	return nil
+}
+
+// Port checks that a setting is a TCP port number.
+func Port(name string, port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("%s: %d is not a port number", name, port)
+	}
+	return nil
+}
+
+// Positive checks that a duration setting is greater than zero.
+func Positive(name string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s: %s should be greater than zero", name, d)
+	}
+	return nil
+}
+
+// Between checks that a number setting is within min and max, both included.
+func Between(name string, n, min, max int) error {
+	if n < min || n > max {
+		return fmt.Errorf("%s: %d should be between %d and %d", name, n, min, max)
+	}
+	return nil
+}
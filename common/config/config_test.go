@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type settings struct {
+	Port    int           `yaml:"port" env:"TEST_PORT"`
+	URL     string        `yaml:"url" env:"TEST_URL"`
+	Timeout time.Duration `yaml:"timeout" env:"TEST_TIMEOUT"`
+	Debug   bool          `yaml:"debug" env:"TEST_DEBUG"`
+}
+
+func writeFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "settings.yaml")
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvironmentOverridesFileAndDefaults(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "port: 8080\nurl: http://from-file\ntimeout: 3s\n"))
+	t.Setenv("TEST_URL", "http://from-env")
+
+	s := settings{Port: 80, Timeout: time.Second, Debug: true}
+	err := Load(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := settings{Port: 8080, URL: "http://from-env", Timeout: 3 * time.Second, Debug: true}
+	if s != want {
+		t.Fatalf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestLoadRejectsBadValues(t *testing.T) {
+	t.Setenv("TEST_PORT", "eighty")
+	t.Setenv("TEST_TIMEOUT", "10")
+
+	err := Load(&settings{})
+	if err == nil || !strings.Contains(err.Error(), "TEST_PORT") || !strings.Contains(err.Error(), "TEST_TIMEOUT") {
+		t.Fatalf("got error %v, want both bad variables named", err)
+	}
+}
+
+func TestLoadEnvWithPrefix(t *testing.T) {
+	t.Setenv("MOCK_TEST_URL", "http://mock")
+	t.Setenv("TEST_URL", "http://unprefixed")
+
+	s := settings{Port: 80}
+	err := LoadEnv(&s, "MOCK_")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := settings{Port: 80, URL: "http://mock"}
+	if s != want {
+		t.Fatalf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	t.Setenv(FileEnv, writeFile(t, "prot: 8080\n"))
+
+	err := Load(&settings{})
+	if err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Fatalf("got error %v, want the unknown key named", err)
+	}
+}
+
+func TestValidators(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		fail bool
+	}{
+		{Required("DSN", "host=db"), false},
+		{Required("DSN", ""), true},
+		{URL("CAR_SERVICE_URL", "http://car-service"), false},
+		{URL("CAR_SERVICE_URL", "https://cars.example.com:8443/api"), false},
+		{URL("CAR_SERVICE_URL", "car-service"), true},
+		{URL("CAR_SERVICE_URL", "ftp://car-service"), true},
+		{Port("PORT", 80), false},
+		{Port("PORT", 0), true},
+		{Port("PORT", 70000), true},
+		{Positive("READ_TIMEOUT", time.Second), false},
+		{Positive("READ_TIMEOUT", 0), true},
+		{Between("PASSWORD_MIN_CLASSES", 4, 1, 4), false},
+		{Between("PASSWORD_MIN_CLASSES", 0, 1, 4), true},
+	} {
+		if (test.err != nil) != test.fail {
+			t.Errorf("got error %v, want failure %t", test.err, test.fail)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+module common
+
+go 1.21.1
+
+require (
+	github.com/golang-jwt/jwt/v5 v5.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// usage documents the migrate subcommand of the services.
+const usage = `usage: migrate <command>
+
+commands:
+  up                  apply every pending migration
+  down [steps]        revert the most recent migrations (default 1)
+  status              list the migrations and when they were applied
+  baseline <version>  mark the migrations up to version as applied without running them,
+                      for databases created by hand before migrations existed`
+
+// OnStart prepares the database when a service starts. Migrations are applied when apply
+// is true, the MIGRATE_ON_START setting of the services. Deployments applying them with the
+// migrate subcommand instead turn it off; the schema must then already match the binary.
+func OnStart(ctx context.Context, m *Migrator, apply bool) error {
+	if !apply {
+		return m.Check(ctx)
+	}
+
+	return m.Up(ctx)
+}
+
+// Command runs the migrate subcommand with its arguments, writing its output to out.
+func Command(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "up":
+		err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s is at migration %d\n", m.Service, m.Latest())
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		return m.Down(ctx, steps)
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%4d  %-40s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+
+	case "baseline":
+		if len(args) < 2 {
+			return errors.New("baseline needs the version the database is at")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 1 || version > m.Latest() {
+			return fmt.Errorf("invalid version %q, it should be between 1 and %d", args[1], m.Latest())
+		}
+		return m.Baseline(ctx, version)
+
+	default:
+		return errors.New(usage)
+	}
+}
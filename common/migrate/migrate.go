@@ -0,0 +1,389 @@
+// Package migrate applies the versioned schema migrations every service embeds.
+//
+// Migrations are files named <version>_<name>.up.sql and <version>_<name>.down.sql, where
+// version is a positive number, applied in version order. Applied versions are recorded per
+// service in the schema_migrations table, and a Postgres advisory lock makes sure that
+// replicas starting at the same time do not apply them twice.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDatabaseAhead is returned when the database has migrations applied that the binary
+// does not know about, which means an older binary runs against a newer schema.
+var ErrDatabaseAhead = errors.New("the database schema is newer than this binary")
+
+// ErrPending is returned by Check when migrations are waiting to be applied.
+var ErrPending = errors.New("the database schema is older than this binary")
+
+// Migration is one schema change and the statements undoing it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it was applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations of one service.
+type Migrator struct {
+	DB         *sql.DB
+	Service    string
+	Migrations []Migration
+}
+
+// New loads the migrations of the service from the root of fsys.
+func New(db *sql.DB, service string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, Service: service, Migrations: migrations}, nil
+}
+
+// Load reads the migrations at the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s should end in .up.sql or .down.sql", file)
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s should be named <version>_<name>.%s.sql", file, direction)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up migration", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration, or 0 when there is none.
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Up applies every pending migration. It fails with ErrDatabaseAhead, before changing
+// anything, when the database is newer than the binary.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkAhead(applied)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			log.Printf("Applying migration %d_%s\n", migration.Version, migration.Name)
+
+			err = m.apply(ctx, conn, migration.Up,
+				`insert into schema_migrations (service, version, name, applied_at) values ($1, $2, $3, $4)`,
+				m.Service, migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the given number of most recent migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkAhead(applied)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.Migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s can not be reverted, it has no down migration", migration.Version, migration.Name)
+			}
+
+			log.Printf("Reverting migration %d_%s\n", migration.Version, migration.Name)
+
+			err = m.apply(ctx, conn, migration.Down,
+				`delete from schema_migrations where service = $1 and version = $2`,
+				m.Service, migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Baseline records every migration up to version as applied without running it, for
+// databases whose schema was created by hand before migrations existed.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			_, err = conn.ExecContext(ctx,
+				`insert into schema_migrations (service, version, name, applied_at) values ($1, $2, $3, $4)`,
+				m.Service, migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Marked migration %d_%s as applied\n", migration.Version, migration.Name)
+		}
+
+		return nil
+	})
+}
+
+// Status returns every migration, known to the binary or only to the database, and when
+// it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.Migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+				delete(applied, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+
+		// migrations applied by a newer binary
+		for version, appliedAt := range applied {
+			appliedAt := appliedAt
+			statuses = append(statuses, Status{Migration: Migration{Version: version, Name: "(unknown)"}, AppliedAt: &appliedAt})
+		}
+
+		return nil
+	})
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, err
+}
+
+// Check fails with ErrDatabaseAhead when the database is newer than the binary, and with
+// ErrPending when migrations are waiting to be applied. It is meant for services started
+// without applying migrations themselves.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if status.Version > m.Latest() {
+			return fmt.Errorf("%w: migration %d is applied, this binary knows migrations up to %d", ErrDatabaseAhead, status.Version, m.Latest())
+		}
+		if status.AppliedAt == nil {
+			return fmt.Errorf("%w: migration %d_%s is pending", ErrPending, status.Version, status.Name)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) checkAhead(applied map[int]time.Time) error {
+	for version := range applied {
+		if version > m.Latest() {
+			return fmt.Errorf("%w: migration %d is applied, this binary knows migrations up to %d", ErrDatabaseAhead, version, m.Latest())
+		}
+	}
+	return nil
+}
+
+// locked runs fn on a connection holding the advisory lock of the service, creating the
+// schema_migrations table first if needed.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	lockID := m.lockID()
+
+	_, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer func() {
+		// a fresh context, so that the lock is released even when ctx was cancelled
+		_, err := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, lockID)
+		if err != nil {
+			log.Println("Error releasing migration lock:", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `create table if not exists schema_migrations (
+		service character varying(64) NOT NULL,
+		version bigint NOT NULL,
+		name character varying(255) NOT NULL,
+		applied_at timestamp without time zone NOT NULL,
+		PRIMARY KEY (service, version)
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// lockID derives the advisory lock key from the service name, so that services sharing a
+// database do not wait on each other.
+func (m *Migrator) lockID() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("migrate:" + m.Service))
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations where service = $1`, m.Service)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// apply runs the statements of a migration and records it in one transaction, so that a
+// failing migration leaves nothing half done.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, statements, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, statements)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
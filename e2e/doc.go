@@ -0,0 +1,5 @@
+// Package e2e runs the authentication, car and broker services together, in process and
+// on in-memory stores, to test scenarios that span several services. It only has tests:
+//
+//	cd e2e && go test ./...
+package e2e
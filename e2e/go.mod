@@ -0,0 +1,24 @@
+module e2e
+
+go 1.21.1
+
+require (
+	UberProject v0.0.0
+	authentification v0.0.0
+	car-service v0.0.0
+	common v0.0.0
+)
+
+require (
+	github.com/go-chi/chi/v5 v5.0.10 // indirect
+	github.com/go-chi/cors v1.2.1 // indirect
+	github.com/golang-jwt/jwt/v5 v5.0.0 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+)
+
+replace (
+	UberProject => ../broker-service
+	authentification => ../authentication-service
+	car-service => ../car-service
+	common => ../common
+)
@@ -0,0 +1,352 @@
+package e2e
+
+import (
+	cardata "car-service/data"
+	"common/auth"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRideFromRegistrationToRating(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Rita", "rita@example.com", auth.RoleCustomer)
+	s.register(t, "Dana", "dana@example.com", auth.RoleDriver)
+	rider := s.signIn(t, "rita@example.com")
+	driver := s.signIn(t, "dana@example.com")
+
+	// the driver adds a car through the broker, then starts driving it
+	s.submit(t, driver.Token, map[string]any{
+		"action":     "create_car",
+		"create_car": map[string]any{"car_name": "Dacia Logan", "city": "Bucharest", "car_type": "standard"},
+	}).expect(t, http.StatusAccepted)
+
+	var cars struct {
+		Cars []struct {
+			ID int `json:"id"`
+		} `json:"cars"`
+	}
+	s.submit(t, driver.Token, map[string]any{"action": "list_cars"}).expect(t, http.StatusAccepted).decode(t, &cars)
+	if len(cars.Cars) != 1 {
+		t.Fatalf("got %d cars, want the one created through the broker", len(cars.Cars))
+	}
+	carID := cars.Cars[0].ID
+
+	s.submit(t, driver.Token, map[string]any{
+		"action":     "update_car",
+		"update_car": map[string]any{"id": carID, "active": true},
+	}).expect(t, http.StatusAccepted)
+	s.submit(t, driver.Token, map[string]any{
+		"action":              "update_car_location",
+		"update_car_location": map[string]any{"id": carID, "latitude": 44.43, "longitude": 26.10},
+	}).expect(t, http.StatusAccepted)
+
+	// the rider requests a ride through the broker
+	var requested cardata.CarRequest
+	s.submit(t, rider.Token, map[string]any{
+		"action":             "request_car",
+		"create_car_request": map[string]any{"car_type": "standard", "city": "Bucharest", "address": "Piata Unirii"},
+	}).expect(t, http.StatusAccepted).decode(t, &requested)
+	if requested.UserId != rider.User.ID {
+		t.Fatalf("got car request of user %d, want %d", requested.UserId, rider.User.ID)
+	}
+
+	// the driver finds it through the broker, with the name the auth service knows
+	var open struct {
+		CarRequests []cardata.CarRequest `json:"car_requests"`
+	}
+	do(t, s.Broker, "GET", "/car_requests?car_type=standard&city=Bucharest", driver.Token, nil).
+		expect(t, http.StatusAccepted).decode(t, &open)
+	if len(open.CarRequests) != 1 || open.CarRequests[0].ID != requested.ID || open.CarRequests[0].UserName != "Rita Test" {
+		t.Fatalf("got car requests %+v, want the one of Rita Test", open.CarRequests)
+	}
+
+	// the driver is assigned and drives the ride through the broker
+	var assigned cardata.CarRequest
+	s.submit(t, driver.Token, map[string]any{
+		"action":             "accept_car_request",
+		"accept_car_request": map[string]any{"id": requested.ID, "car_id": carID},
+	}).expect(t, http.StatusAccepted).decode(t, &assigned)
+	if !assigned.CarId.Valid || assigned.CarId.Int64 != int64(carID) {
+		t.Fatalf("got car request %+v, want it assigned to car %d", assigned, carID)
+	}
+
+	ride := map[string]any{"id": requested.ID}
+	s.submit(t, driver.Token, map[string]any{"action": "complete_ride", "complete_ride": ride}).expect(t, http.StatusConflict)
+	s.submit(t, rider.Token, map[string]any{"action": "start_ride", "start_ride": ride}).expect(t, http.StatusForbidden)
+	for _, step := range []string{"driver_arriving", "start_ride", "complete_ride"} {
+		var moved cardata.CarRequest
+		s.submit(t, driver.Token, map[string]any{"action": step, step: ride}).expect(t, http.StatusAccepted).decode(t, &moved)
+		if moved.ID != requested.ID {
+			t.Fatalf("got car request %+v after %s, want %d", moved, step, requested.ID)
+		}
+	}
+
+	var driven struct {
+		CarRequests []cardata.CarRequest `json:"car_requests"`
+	}
+	s.submit(t, driver.Token, map[string]any{"action": "driver_car_requests"}).
+		expect(t, http.StatusAccepted).decode(t, &driven)
+	if len(driven.CarRequests) != 1 || driven.CarRequests[0].ID != requested.ID {
+		t.Fatalf("got car requests %+v, want the one driven", driven.CarRequests)
+	}
+
+	// only the rider rates the ride
+	rate := map[string]any{
+		"action":             "update_car_request",
+		"update_car_request": map[string]any{"id": requested.ID, "rating": 5},
+	}
+	s.submit(t, driver.Token, rate).expect(t, http.StatusForbidden)
+	s.submit(t, rider.Token, rate).expect(t, http.StatusAccepted)
+
+	var rated cardata.CarRequest
+	s.submit(t, rider.Token, map[string]any{
+		"action":          "get_car_request",
+		"get_car_request": map[string]any{"id": requested.ID},
+	}).expect(t, http.StatusAccepted).decode(t, &rated)
+	if rated.Rating != 5 || rated.Status != cardata.StatusCompleted {
+		t.Fatalf("got car request %+v, want it completed and rated 5", rated)
+	}
+}
+
+func TestBrokerChecksPayloads(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Dana", "dana@example.com", auth.RoleDriver)
+	driver := s.signIn(t, "dana@example.com")
+
+	var invalid struct {
+		Errors map[string]string `json:"errors"`
+	}
+	s.submit(t, driver.Token, map[string]any{
+		"action":     "create_car",
+		"create_car": map[string]any{"car_name": 42, "city": "Bucharest", "colour": "red"},
+	}).expect(t, http.StatusBadRequest).decode(t, &invalid)
+	want := map[string]string{
+		"car_name": "must be of type string",
+		"car_type": "is required",
+		"colour":   "is not a field of create_car",
+	}
+	if fmt.Sprint(invalid.Errors) != fmt.Sprint(want) {
+		t.Fatalf("got errors %v, want %v", invalid.Errors, want)
+	}
+
+	s.submit(t, driver.Token, map[string]any{"action": "fly"}).expect(t, http.StatusBadRequest)
+
+	var listed struct {
+		Actions []struct {
+			Name    string `json:"name"`
+			Payload []struct {
+				Name     string `json:"name"`
+				Required bool   `json:"required"`
+			} `json:"payload"`
+		} `json:"actions"`
+	}
+	do(t, s.Broker, "GET", "/actions", "", nil).expect(t, http.StatusOK).decode(t, &listed)
+	for _, action := range listed.Actions {
+		if action.Name == "update_car" && len(action.Payload) == 5 && action.Payload[0].Name == "id" && action.Payload[0].Required &&
+			!action.Payload[4].Required {
+			return
+		}
+	}
+	t.Fatalf("got actions %+v, want update_car listed with its payload", listed.Actions)
+}
+
+func TestBrokerPricesAndDispatchesRides(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Rita", "rita@example.com", auth.RoleCustomer)
+	s.register(t, "Dana", "dana@example.com", auth.RoleDriver)
+	rider := s.signIn(t, "rita@example.com")
+	driver := s.signIn(t, "dana@example.com")
+
+	s.submit(t, driver.Token, map[string]any{
+		"action":     "create_car",
+		"create_car": map[string]any{"car_name": "Dacia Logan", "city": "Bucharest", "car_type": "standard"},
+	}).expect(t, http.StatusAccepted)
+	var cars struct {
+		Cars []struct {
+			ID int `json:"id"`
+		} `json:"cars"`
+	}
+	s.submit(t, driver.Token, map[string]any{"action": "list_cars"}).expect(t, http.StatusAccepted).decode(t, &cars)
+	carID := cars.Cars[0].ID
+	s.submit(t, driver.Token, map[string]any{
+		"action":     "update_car",
+		"update_car": map[string]any{"id": carID, "active": true},
+	}).expect(t, http.StatusAccepted)
+	s.submit(t, driver.Token, map[string]any{
+		"action":              "update_car_location",
+		"update_car_location": map[string]any{"id": carID, "latitude": 44.4270, "longitude": 26.1020},
+	}).expect(t, http.StatusAccepted)
+
+	// the rider looks around before requesting a ride
+	var nearby struct {
+		Cars []map[string]any `json:"cars"`
+	}
+	s.submit(t, rider.Token, map[string]any{
+		"action":      "nearby_cars",
+		"nearby_cars": map[string]any{"latitude": 44.4268, "longitude": 26.1025, "car_type": "standard"},
+	}).expect(t, http.StatusAccepted).decode(t, &nearby)
+	if len(nearby.Cars) != 1 || nearby.Cars[0]["id"] != float64(carID) || nearby.Cars[0]["user_id"] != nil {
+		t.Fatalf("got nearby cars %+v, want car %d without its driver", nearby.Cars, carID)
+	}
+
+	var surge struct {
+		Multiplier float64 `json:"surge_multiplier"`
+	}
+	s.submit(t, rider.Token, map[string]any{
+		"action": "surge",
+		"surge":  map[string]any{"city": "Bucharest", "car_type": "standard"},
+	}).expect(t, http.StatusAccepted).decode(t, &surge)
+	if surge.Multiplier != 1 {
+		t.Fatalf("got surge multiplier %v, want 1 without demand", surge.Multiplier)
+	}
+
+	ride := map[string]any{
+		"city":        "Bucharest",
+		"car_type":    "standard",
+		"pickup_lat":  44.4268,
+		"pickup_lng":  26.1025,
+		"dropoff_lat": 44.4361,
+		"dropoff_lng": 26.0925,
+	}
+	var fare struct {
+		Total    int64  `json:"total"`
+		Currency string `json:"currency"`
+	}
+	s.submit(t, rider.Token, map[string]any{"action": "fare_estimate", "fare_estimate": ride}).
+		expect(t, http.StatusAccepted).decode(t, &fare)
+	if fare.Total <= 0 || fare.Currency != "RON" {
+		t.Fatalf("got fare %+v, want a positive total in RON", fare)
+	}
+
+	// the dispatcher offers the ride to the nearby driver, who takes it
+	ride["address"] = "Piata Unirii"
+	var requested cardata.CarRequest
+	s.submit(t, rider.Token, map[string]any{"action": "request_car", "create_car_request": ride}).
+		expect(t, http.StatusAccepted).decode(t, &requested)
+
+	var offers struct {
+		Offers []struct {
+			ID           int `json:"id"`
+			CarRequestID int `json:"car_request_id"`
+		} `json:"offers"`
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(offers.Offers) == 0 && time.Now().Before(deadline) {
+		s.submit(t, driver.Token, map[string]any{"action": "list_offers"}).expect(t, http.StatusAccepted).decode(t, &offers)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(offers.Offers) != 1 || offers.Offers[0].CarRequestID != requested.ID {
+		t.Fatalf("got offers %+v, want one for car request %d", offers.Offers, requested.ID)
+	}
+
+	offer := map[string]any{"id": offers.Offers[0].ID}
+	s.submit(t, rider.Token, map[string]any{"action": "accept_offer", "accept_offer": offer}).expect(t, http.StatusForbidden)
+	s.submit(t, driver.Token, map[string]any{"action": "accept_offer", "accept_offer": offer}).expect(t, http.StatusAccepted)
+	s.submit(t, driver.Token, map[string]any{"action": "decline_offer", "decline_offer": offer}).expect(t, http.StatusNotFound)
+
+	// the rider follows the car on its way, then changes their mind
+	var car struct {
+		Latitude *float64 `json:"latitude"`
+	}
+	do(t, s.Broker, "GET", fmt.Sprintf("/api/cars/%d", carID), rider.Token, nil).expect(t, http.StatusAccepted).decode(t, &car)
+	if car.Latitude == nil {
+		t.Fatal("the rider does not see where the car taking their ride is")
+	}
+
+	var cancelled cardata.CarRequest
+	s.submit(t, rider.Token, map[string]any{
+		"action":             "cancel_car_request",
+		"cancel_car_request": map[string]any{"id": requested.ID},
+	}).expect(t, http.StatusAccepted).decode(t, &cancelled)
+	if cancelled.Status != cardata.StatusCancelledByRider {
+		t.Fatalf("got car request %+v, want it cancelled by the rider", cancelled)
+	}
+}
+
+func TestRidersCanNotCreateCars(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Rita", "rita@example.com", auth.RoleCustomer)
+	rider := s.signIn(t, "rita@example.com")
+
+	createCar := map[string]any{
+		"action":     "create_car",
+		"create_car": map[string]any{"car_name": "Dacia Logan", "city": "Bucharest", "car_type": "standard"},
+	}
+	s.submit(t, "", createCar).expect(t, http.StatusUnauthorized)
+	s.submit(t, rider.Token, createCar).expect(t, http.StatusForbidden)
+
+	do(t, s.Cars, "POST", "/cars", rider.Token, createCar["create_car"]).expect(t, http.StatusForbidden)
+}
+
+func TestSignedOutTokensAreRejectedEverywhere(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Rita", "rita@example.com", auth.RoleCustomer)
+	rider := s.signIn(t, "rita@example.com")
+
+	do(t, s.Cars, "GET", "/users/me/data", rider.Token, nil).expect(t, http.StatusOK)
+
+	do(t, s.Auth, "POST", "/logout", rider.Token, map[string]any{"refresh_token": rider.RefreshToken}).
+		expect(t, http.StatusAccepted)
+
+	do(t, s.Cars, "GET", "/users/me/data", rider.Token, nil).expect(t, http.StatusUnauthorized)
+	s.submit(t, rider.Token, map[string]any{
+		"action":             "request_car",
+		"create_car_request": map[string]any{"car_type": "standard", "city": "Bucharest", "address": "Piata Unirii"},
+	}).expect(t, http.StatusUnauthorized)
+}
+
+func TestResetPasswordRevokesTokensEverywhere(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Rita", "rita@example.com", auth.RoleCustomer)
+	rider := s.signIn(t, "rita@example.com")
+
+	do(t, s.Cars, "GET", "/users/me/data", rider.Token, nil).expect(t, http.StatusOK)
+
+	do(t, s.Auth, "POST", "/password/forgot", "", map[string]any{"email": "rita@example.com"}).expect(t, http.StatusAccepted)
+	newPassword := "another-Horse-staple"
+	do(t, s.Auth, "POST", "/password/reset", "", map[string]any{
+		"token":                 s.mailbox.lastToken(t, "rita@example.com"),
+		"password":              newPassword,
+		"password_confirmation": newPassword,
+	}).expect(t, http.StatusAccepted)
+
+	do(t, s.Cars, "GET", "/users/me/data", rider.Token, nil).expect(t, http.StatusUnauthorized)
+
+	var signedIn session
+	do(t, s.Auth, "POST", "/authenticate", "", map[string]any{"email": "rita@example.com", "password": newPassword}).
+		expect(t, http.StatusAccepted).decode(t, &signedIn)
+	do(t, s.Cars, "GET", "/users/me/data", signedIn.Token, nil).expect(t, http.StatusOK)
+}
+
+func TestGatewayServesEveryService(t *testing.T) {
+	s := newStack(t)
+
+	s.register(t, "Dana", "dana@example.com", auth.RoleDriver)
+
+	var signedIn session
+	do(t, s.Broker, "POST", "/api/auth/authenticate", "", map[string]any{"email": "dana@example.com", "password": testPassword}).
+		expect(t, http.StatusAccepted).decode(t, &signedIn)
+
+	do(t, s.Broker, "POST", "/api/cars", signedIn.Token, map[string]any{"car_name": "Dacia Logan", "city": "Bucharest", "car_type": "standard"}).
+		expect(t, http.StatusAccepted)
+
+	var cars struct {
+		Cars []struct {
+			UserID int `json:"user_id"`
+		} `json:"cars"`
+	}
+	do(t, s.Broker, "GET", "/api/cars", signedIn.Token, nil).expect(t, http.StatusAccepted).decode(t, &cars)
+	if len(cars.Cars) != 1 || cars.Cars[0].UserID != signedIn.User.ID {
+		t.Fatalf("got cars %+v, want the one created through the gateway", cars.Cars)
+	}
+
+	do(t, s.Broker, "GET", "/api/car_requests", "", nil).expect(t, http.StatusUnauthorized)
+}
@@ -0,0 +1,305 @@
+package e2e
+
+import (
+	brokerapi "UberProject/api"
+	authapi "authentification/api"
+	"authentification/data"
+	"authentification/mailer"
+	"authentification/passwords"
+	"bytes"
+	carapi "car-service/api"
+	cardata "car-service/data"
+	"car-service/dispatch"
+	"car-service/pricing"
+	"car-service/users"
+	"common/auth"
+	"common/authclient"
+	"common/carclient"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPassword satisfies the default password policy.
+const testPassword = "correct-Horse-battery"
+
+// mailbox keeps the messages the authentication service sends instead of sending them.
+type mailbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *mailbox) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([^\s&]+)`)
+
+// lastToken returns the token of the link in the last message sent to the address.
+func (m *mailbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+
+		match := linkToken.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("no link in %q", m.messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	t.Fatalf("no message sent to %s", to)
+	return ""
+}
+
+// stack is the three services, each on its own test server and wired to the others the
+// way docker-compose wires them.
+type stack struct {
+	Auth   *httptest.Server
+	Cars   *httptest.Server
+	Broker *httptest.Server
+
+	mailbox *mailbox
+}
+
+const gatewaySecret = "e2e-gateway-secret"
+
+// newStack starts the services. The authentication service signs tokens with a fresh
+// ES256 key, so the car and broker services verify them with its JWKS, and both reload
+// the revocation list on every request. The car service trusts the identity forwarded by
+// the gateway of the broker.
+func newStack(t *testing.T) *stack {
+	t.Helper()
+
+	s := &stack{
+		Auth:    httptest.NewUnstartedServer(nil),
+		Cars:    httptest.NewUnstartedServer(nil),
+		Broker:  httptest.NewUnstartedServer(nil),
+		mailbox: &mailbox{},
+	}
+	authURL, carsURL := serverURL(s.Auth), serverURL(s.Cars)
+
+	useSigningKey(t)
+	authApp := &authapi.Config{
+		Models:         data.NewMemory(),
+		Mailer:         s.mailbox,
+		FrontendURL:    "http://frontend.test",
+		PublicURL:      authURL,
+		PasswordPolicy: passwords.DefaultPolicy(),
+		Cars:           carclient.New(carsURL, 5*time.Second),
+	}
+
+	models := cardata.NewMemory()
+	carApp := &carapi.Config{
+		Models:     models,
+		Dispatcher: dispatch.New(models, carapi.OfferTimeout),
+		Surge:      pricing.NewSurgeCalculator(models, carapi.SurgeWindow, 0),
+		Verifier:   verifier(authURL),
+		Users:      users.NewDirectory(authclient.New(authURL, 5*time.Second), time.Minute),
+
+		GatewaySecret: gatewaySecret,
+	}
+
+	brokerApp := &brokerapi.Config{
+		Auth:     authclient.New(authURL, 5*time.Second),
+		Cars:     carclient.New(carsURL, 5*time.Second),
+		Verifier: verifier(authURL),
+
+		GatewaySecret: gatewaySecret,
+	}
+
+	for server, handler := range map[*httptest.Server]http.Handler{
+		s.Auth:   authApp.Routes(),
+		s.Cars:   carApp.Routes(),
+		s.Broker: brokerApp.Routes(),
+	} {
+		server.Config.Handler = handler
+		server.Start()
+		t.Cleanup(server.Close)
+	}
+
+	return s
+}
+
+// serverURL returns the URL an unstarted test server will be reachable at.
+func serverURL(server *httptest.Server) string {
+	return "http://" + server.Listener.Addr().String()
+}
+
+func verifier(authURL string) *auth.Verifier {
+	v := auth.NewVerifier(authURL)
+	v.RevocationsTTL = 0
+	return v
+}
+
+// useSigningKey makes the authentication service sign tokens with a new P-256 key, loaded
+// from a key directory like in production.
+func useSigningKey(t *testing.T) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "e2e.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = authapi.LoadSigningKeys(authapi.SigningKeySettings{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// response is the envelope every service answers with, with the data left to decode.
+type response struct {
+	Status  int             `json:"-"`
+	Error   bool            `json:"error"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (r *response) expect(t *testing.T, status int) *response {
+	t.Helper()
+
+	if r.Status != status {
+		t.Fatalf("got status %d (%s), want %d", r.Status, r.Message, status)
+	}
+	return r
+}
+
+func (r *response) decode(t *testing.T, v any) {
+	t.Helper()
+
+	err := json.Unmarshal(r.Data, v)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", r.Data, err)
+	}
+}
+
+// do sends a request to the server, with the body encoded as JSON and the token as bearer
+// when they are set.
+func do(t *testing.T, server *httptest.Server, method, path, token string, body any) *response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	resp := &response{Status: res.StatusCode}
+	err = json.NewDecoder(res.Body).Decode(resp)
+	if err != nil && err != io.EOF {
+		t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+	}
+
+	return resp
+}
+
+// submit posts an action to the broker.
+func (s *stack) submit(t *testing.T, token string, payload map[string]any) *response {
+	t.Helper()
+
+	return do(t, s.Broker, "POST", "/handle", token, payload)
+}
+
+// session is what signing in returns.
+type session struct {
+	User struct {
+		ID int `json:"id"`
+	} `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// register creates an account of the given type through the broker and verifies its email.
+func (s *stack) register(t *testing.T, firstName, email, userType string) {
+	t.Helper()
+
+	s.submit(t, "", map[string]any{
+		"action": "register",
+		"register": map[string]any{
+			"first_name":            firstName,
+			"last_name":             "Test",
+			"email":                 email,
+			"password":              testPassword,
+			"password_confirmation": testPassword,
+			"city":                  "Bucharest",
+			"type":                  userType,
+		},
+	}).expect(t, http.StatusAccepted)
+
+	do(t, s.Auth, "GET", "/verify_email?token="+url.QueryEscape(s.mailbox.lastToken(t, email)), "", nil).
+		expect(t, http.StatusAccepted)
+}
+
+// signIn signs the user in through the broker.
+func (s *stack) signIn(t *testing.T, email string) session {
+	t.Helper()
+
+	var signedIn session
+	s.submit(t, "", map[string]any{
+		"action": "auth",
+		"auth":   map[string]any{"email": email, "password": testPassword},
+	}).expect(t, http.StatusAccepted).decode(t, &signedIn)
+
+	if signedIn.Token == "" {
+		t.Fatal("signing in returned no token")
+	}
+	return signedIn
+}
@@ -0,0 +1,4 @@
+-- Runs once, when the postgres container starts on an empty data directory. POSTGRES_DB
+-- creates users, the database of the authentication service; the car service gets its own.
+-- Deployments created before the split get it with "make split_db".
+CREATE DATABASE cars;